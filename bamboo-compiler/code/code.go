@@ -0,0 +1,256 @@
+package code
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+)
+
+// 字节码由一个个指令组成 每条指令以一个字节的操作码开头
+// 操作码之后紧跟若干操作数 操作数的宽度由操作码的定义决定
+// 多字节操作数以大端序编码
+// eg. OpConstant 65534 ---> [OpConstant, 0xFF, 0xFE]
+
+// Instructions 指令序列
+type Instructions []byte
+
+// Opcode 操作码
+type Opcode byte
+
+const (
+	OpConstant Opcode = iota // 将常量池中的常量压栈
+
+	OpPop // 弹出栈顶元素
+
+	OpAdd // 算术运算 弹出两个操作数 压入结果
+	OpSub
+	OpMul
+	OpDiv
+	OpMod
+
+	OpEqual // 比较运算
+	OpNotEqual
+	OpLessThan
+	OpGreaterThan
+	OpLessEqual
+	OpGreaterEqual
+
+	OpBitAnd // 位运算
+	OpBitOr
+	OpBitXor
+	OpShiftLeft
+	OpShiftRight
+
+	OpMinus // 前缀运算
+	OpBang
+	OpBitNot
+
+	OpTrue // 压入布尔值与空值
+	OpFalse
+	OpNull
+
+	OpJump          // 无条件跳转到操作数指定的位置
+	OpJumpNotTruthy // 弹出栈顶元素 为假时跳转
+	OpJumpIfArg     // 调用时传入了第一个操作数指定的参数时跳转 用于跳过参数的默认值
+	OpJumpNull      // 栈顶元素为NULL时跳转 不弹出栈顶元素
+
+	OpGetGlobal // 读写全局变量
+	OpSetGlobal
+	OpGetLocal // 读写当前函数的局部变量
+	OpSetLocal
+	OpGetFree    // 读取闭包捕获的变量 操作数为其在捕获列表中的下标
+	OpGetBuiltin // 压入内置函数
+
+	OpAssignGlobal // 赋值语句修改已声明的变量 变量未声明时报错
+	OpAssignLocal
+	OpAssignFree
+	OpRenewCells // 为循环中语句块内被闭包捕获的变量创建新的存储单元 操作数为CompiledFunction.Blocks的下标
+
+	OpArray // 由栈顶的元素构造数组
+	OpHash  // 由栈顶的键值对构造哈希表
+	OpIndex // 索引运算
+	OpSlice // 切片运算 栈顶依次为步长 结束位置 起始位置和被切片的对象
+
+	OpIndexKeep // 索引运算 不弹出对象和索引 用于复合赋值
+	OpSetIndex  // 弹出值 索引和对象 修改对象的元素 压入赋给的值
+
+	OpCall       // 调用函数 操作数为参数个数
+	OpCallSpread // 调用函数 操作数为栈顶的数组个数 这些数组依次拼接为实参
+	OpSpread     // 弹出可迭代对象 压入由其各个值组成的数组
+	OpTailCall   // 尾部位置的OpCall 被调用的是闭包时复用当前的调用帧
+	OpTailCallSpread
+	OpReturnValue // 返回栈顶的值
+	OpReturn      // 返回 没有返回值
+
+	OpClosure // 以常量池中的函数创建闭包
+
+	OpGetIter    // 弹出被遍历的对象 压入其迭代器
+	OpIterNext   // 压入下一个元素的键和值 并跳过其后的OpIterResult 遍历结束时弹出迭代器并跳转 被遍历的是函数时调用该函数
+	OpIterResult // 处理被遍历的函数返回的结果 压入键和值 或在遍历结束时弹出迭代器并跳转
+)
+
+// Definition 操作码的定义 包括可读的名称和各操作数的字节宽度
+type Definition struct {
+	Name          string
+	OperandWidths []int
+}
+
+var definitions = map[Opcode]*Definition{
+	OpConstant:       {"OpConstant", []int{2}},
+	OpPop:            {"OpPop", []int{}},
+	OpAdd:            {"OpAdd", []int{}},
+	OpSub:            {"OpSub", []int{}},
+	OpMul:            {"OpMul", []int{}},
+	OpDiv:            {"OpDiv", []int{}},
+	OpMod:            {"OpMod", []int{}},
+	OpEqual:          {"OpEqual", []int{}},
+	OpNotEqual:       {"OpNotEqual", []int{}},
+	OpLessThan:       {"OpLessThan", []int{}},
+	OpGreaterThan:    {"OpGreaterThan", []int{}},
+	OpLessEqual:      {"OpLessEqual", []int{}},
+	OpGreaterEqual:   {"OpGreaterEqual", []int{}},
+	OpBitAnd:         {"OpBitAnd", []int{}},
+	OpBitOr:          {"OpBitOr", []int{}},
+	OpBitXor:         {"OpBitXor", []int{}},
+	OpShiftLeft:      {"OpShiftLeft", []int{}},
+	OpShiftRight:     {"OpShiftRight", []int{}},
+	OpMinus:          {"OpMinus", []int{}},
+	OpBang:           {"OpBang", []int{}},
+	OpBitNot:         {"OpBitNot", []int{}},
+	OpTrue:           {"OpTrue", []int{}},
+	OpFalse:          {"OpFalse", []int{}},
+	OpNull:           {"OpNull", []int{}},
+	OpJump:           {"OpJump", []int{2}},
+	OpJumpNotTruthy:  {"OpJumpNotTruthy", []int{2}},
+	OpJumpIfArg:      {"OpJumpIfArg", []int{2, 2}},
+	OpJumpNull:       {"OpJumpNull", []int{2}},
+	OpGetGlobal:      {"OpGetGlobal", []int{2}},
+	OpSetGlobal:      {"OpSetGlobal", []int{2}},
+	OpGetLocal:       {"OpGetLocal", []int{2}},
+	OpSetLocal:       {"OpSetLocal", []int{2}},
+	OpGetFree:        {"OpGetFree", []int{2}},
+	OpAssignGlobal:   {"OpAssignGlobal", []int{2}},
+	OpAssignLocal:    {"OpAssignLocal", []int{2}},
+	OpAssignFree:     {"OpAssignFree", []int{2}},
+	OpRenewCells:     {"OpRenewCells", []int{2}},
+	OpGetBuiltin:     {"OpGetBuiltin", []int{1}},
+	OpArray:          {"OpArray", []int{2}},
+	OpHash:           {"OpHash", []int{2}},
+	OpIndex:          {"OpIndex", []int{}},
+	OpSlice:          {"OpSlice", []int{}},
+	OpIndexKeep:      {"OpIndexKeep", []int{}},
+	OpSetIndex:       {"OpSetIndex", []int{}},
+	OpCall:           {"OpCall", []int{1}},
+	OpCallSpread:     {"OpCallSpread", []int{1}},
+	OpSpread:         {"OpSpread", []int{}},
+	OpTailCall:       {"OpTailCall", []int{1}},
+	OpTailCallSpread: {"OpTailCallSpread", []int{1}},
+	OpReturnValue:    {"OpReturnValue", []int{}},
+	OpReturn:         {"OpReturn", []int{}},
+	OpClosure:        {"OpClosure", []int{2}},
+	OpGetIter:        {"OpGetIter", []int{}},
+	OpIterNext:       {"OpIterNext", []int{2}},
+	OpIterResult:     {"OpIterResult", []int{2}},
+}
+
+// Lookup 查找操作码的定义
+func Lookup(op byte) (*Definition, error) {
+	def, ok := definitions[Opcode(op)]
+	if !ok {
+		return nil, fmt.Errorf("opcode %d undefined", op)
+	}
+	return def, nil
+}
+
+// Make 将操作码和操作数编码为一条指令
+func Make(op Opcode, operands ...int) []byte {
+	def, ok := definitions[op]
+	if !ok {
+		return []byte{}
+	}
+
+	length := 1
+	for _, w := range def.OperandWidths {
+		length += w
+	}
+
+	instruction := make([]byte, length)
+	instruction[0] = byte(op)
+
+	offset := 1
+	for i, o := range operands {
+		width := def.OperandWidths[i]
+		switch width {
+		case 2:
+			binary.BigEndian.PutUint16(instruction[offset:], uint16(o))
+		case 1:
+			instruction[offset] = byte(o)
+		}
+		offset += width
+	}
+	return instruction
+}
+
+// ReadOperands 按定义解码指令的操作数 返回操作数和读取的字节数
+func ReadOperands(def *Definition, ins Instructions) ([]int, int) {
+	operands := make([]int, len(def.OperandWidths))
+	offset := 0
+
+	for i, width := range def.OperandWidths {
+		switch width {
+		case 2:
+			operands[i] = int(ReadUint16(ins[offset:]))
+		case 1:
+			operands[i] = int(ReadUint8(ins[offset:]))
+		}
+		offset += width
+	}
+	return operands, offset
+}
+
+// ReadUint16 读取两字节的操作数
+func ReadUint16(ins Instructions) uint16 {
+	return binary.BigEndian.Uint16(ins)
+}
+
+// ReadUint8 读取单字节的操作数
+func ReadUint8(ins Instructions) uint8 {
+	return uint8(ins[0])
+}
+
+// String 反汇编指令序列 每行一条指令
+// eg. 0000 OpConstant 1
+func (ins Instructions) String() string {
+	var out bytes.Buffer
+
+	i := 0
+	for i < len(ins) {
+		def, err := Lookup(ins[i])
+		if err != nil {
+			fmt.Fprintf(&out, "ERROR: %s\n", err)
+			return out.String()
+		}
+		operands, read := ReadOperands(def, ins[i+1:])
+		fmt.Fprintf(&out, "%04d %s\n", i, ins.fmtInstruction(def, operands))
+		i += 1 + read
+	}
+	return out.String()
+}
+
+func (ins Instructions) fmtInstruction(def *Definition, operands []int) string {
+	operandCount := len(def.OperandWidths)
+	if len(operands) != operandCount {
+		return fmt.Sprintf("ERROR: operand len %d does not match defined %d\n",
+			len(operands), operandCount)
+	}
+
+	switch operandCount {
+	case 0:
+		return def.Name
+	case 1:
+		return fmt.Sprintf("%s %d", def.Name, operands[0])
+	case 2:
+		return fmt.Sprintf("%s %d %d", def.Name, operands[0], operands[1])
+	}
+	return fmt.Sprintf("ERROR: unhandled operandCount for %s\n", def.Name)
+}
@@ -0,0 +1,69 @@
+package code
+
+import "testing"
+
+func TestMake(t *testing.T) {
+	tests := []struct {
+		op       Opcode
+		operands []int
+		expected []byte
+	}{
+		{OpConstant, []int{65534}, []byte{byte(OpConstant), 255, 254}},
+		{OpAdd, []int{}, []byte{byte(OpAdd)}},
+		{OpCall, []int{255}, []byte{byte(OpCall), 255}},
+		{OpJumpIfArg, []int{1, 258}, []byte{byte(OpJumpIfArg), 0, 1, 1, 2}},
+	}
+
+	for _, tt := range tests {
+		instruction := Make(tt.op, tt.operands...)
+		if string(instruction) != string(tt.expected) {
+			t.Errorf("Make(%d, %v): wrong instruction. got=%v, want=%v", tt.op, tt.operands, instruction, tt.expected)
+		}
+	}
+}
+
+func TestReadOperands(t *testing.T) {
+	tests := []struct {
+		op        Opcode
+		operands  []int
+		bytesRead int
+	}{
+		{OpConstant, []int{65535}, 2},
+		{OpGetBuiltin, []int{7}, 1},
+		{OpJumpIfArg, []int{3, 4096}, 4},
+	}
+
+	for _, tt := range tests {
+		instruction := Make(tt.op, tt.operands...)
+		def, err := Lookup(byte(tt.op))
+		if err != nil {
+			t.Fatalf("definition not found: %s", err)
+		}
+		operands, n := ReadOperands(def, instruction[1:])
+		if n != tt.bytesRead {
+			t.Errorf("%s: wrong bytes read. got=%d, want=%d", def.Name, n, tt.bytesRead)
+		}
+		for i, want := range tt.operands {
+			if operands[i] != want {
+				t.Errorf("%s: wrong operand %d. got=%d, want=%d", def.Name, i, operands[i], want)
+			}
+		}
+	}
+}
+
+func TestInstructionsString(t *testing.T) {
+	var ins Instructions
+	for _, instruction := range [][]byte{
+		Make(OpAdd),
+		Make(OpGetLocal, 1),
+		Make(OpConstant, 65535),
+		Make(OpJumpIfArg, 0, 12),
+	} {
+		ins = append(ins, instruction...)
+	}
+
+	expected := "0000 OpAdd\n0001 OpGetLocal 1\n0004 OpConstant 65535\n0007 OpJumpIfArg 0 12\n"
+	if ins.String() != expected {
+		t.Errorf("wrong disassembly.\ngot=%q\nwant=%q", ins.String(), expected)
+	}
+}
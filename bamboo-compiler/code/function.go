@@ -0,0 +1,66 @@
+package code
+
+import (
+	"bamboo/ast"
+	"bamboo/object"
+	"bamboo/token"
+	"fmt"
+	"sort"
+)
+
+const COMPILED_FUNCTION_OBJ = "COMPILED_FUNCTION"
+
+// Location 记录指令对应的源代码区间
+// 虚拟机据此为运行时错误标注出错的位置
+type Location struct {
+	Offset int        // 指令在指令序列中的偏移量
+	Span   token.Span // 产生该指令的节点区间
+	Callee string     // 被调用的函数名 仅用于调用指令
+}
+
+// Capture 闭包创建时捕获的外层变量
+// Local为true时捕获外层函数的局部变量(在顶层代码中为全局变量) 否则捕获外层闭包已捕获的变量
+type Capture struct {
+	Name  string // 变量名 用于错误信息
+	Local bool
+	Index int
+}
+
+// CompiledFunction 编译后的函数 作为常量保存在常量池中
+type CompiledFunction struct {
+	Instructions  Instructions
+	NumLocals     int                  // 局部变量个数 包括参数
+	Name          string               // 函数名 匿名函数和顶层代码为空
+	NumParameters int                  // 参数个数 包括剩余参数
+	MinParameters int                  // 必须传入的参数个数 即没有默认值的参数个数
+	Variadic      bool                 // 最后一个参数是否为剩余参数
+	LocalNames    []string             // 各局部变量的名称 用于错误信息
+	Free          []Capture            // 创建闭包时捕获的外层变量
+	Blocks        [][]int              // 循环中各语句块内被捕获的变量的下标 由OpRenewCells引用
+	Locations     []Location           // 按偏移量升序排列
+	Literal       *ast.FunctionLiteral // 对应的函数字面量 顶层代码为nil
+}
+
+func (cf *CompiledFunction) Type() object.Type {
+	return COMPILED_FUNCTION_OBJ
+}
+
+func (cf *CompiledFunction) Inspect() string {
+	return fmt.Sprintf("CompiledFunction[%p]", cf)
+}
+
+// LocationAt 返回偏移量处指令对应的位置信息
+func (cf *CompiledFunction) LocationAt(offset int) Location {
+	i := sort.Search(len(cf.Locations), func(i int) bool {
+		return cf.Locations[i].Offset > offset
+	})
+	if i == 0 {
+		return Location{}
+	}
+	return cf.Locations[i-1]
+}
+
+// SpanAt 返回偏移量处指令对应的源代码区间
+func (cf *CompiledFunction) SpanAt(offset int) token.Span {
+	return cf.LocationAt(offset).Span
+}
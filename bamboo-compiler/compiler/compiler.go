@@ -0,0 +1,1030 @@
+package compiler
+
+import (
+	"bamboo/ast"
+	"bamboo/compiler/code"
+	"bamboo/diagnostic"
+	"bamboo/evaluator"
+	"bamboo/object"
+	"bamboo/token"
+	"strings"
+)
+
+// 编译器遍历AST 将其翻译为栈式虚拟机执行的字节码
+// 字面量保存在常量池中 指令通过下标引用常量
+// 每个函数字面量编译为一个CompiledFunction 同样保存在常量池中
+// 编译的结果与求值器对同一AST求值的结果保持一致
+
+// 编译错误代码
+const (
+	ErrUnsupportedNode = "C0001" // 无法编译的节点 或超出字节码操作数的表示范围
+)
+
+// 各操作码的操作数所表示的内容 用于超出表示范围时的错误信息
+var operandNames = map[code.Opcode]string{
+	code.OpConstant:       "constant index",
+	code.OpClosure:        "constant index",
+	code.OpJump:           "jump target",
+	code.OpJumpNotTruthy:  "jump target",
+	code.OpJumpNull:       "jump target",
+	code.OpJumpIfArg:      "parameter index or jump target",
+	code.OpIterNext:       "jump target",
+	code.OpIterResult:     "jump target",
+	code.OpGetGlobal:      "global variable index",
+	code.OpSetGlobal:      "global variable index",
+	code.OpAssignGlobal:   "global variable index",
+	code.OpGetLocal:       "local variable index",
+	code.OpSetLocal:       "local variable index",
+	code.OpAssignLocal:    "local variable index",
+	code.OpGetFree:        "captured variable index",
+	code.OpAssignFree:     "captured variable index",
+	code.OpRenewCells:     "loop block index",
+	code.OpGetBuiltin:     "builtin index",
+	code.OpArray:          "array length",
+	code.OpHash:           "hash literal size",
+	code.OpCall:           "argument count",
+	code.OpTailCall:       "argument count",
+	code.OpCallSpread:     "argument segment count",
+	code.OpTailCallSpread: "argument segment count",
+}
+
+// Bytecode 编译的结果 交由虚拟机执行
+type Bytecode struct {
+	Main         *code.CompiledFunction // 顶层代码
+	Constants    []object.Object        // 常量池
+	GlobalNames  []string               // 各全局变量的名称
+	ConstGlobals []bool                 // 各全局变量是否由const声明
+}
+
+// CompilationScope 编译作用域 每个函数各自生成一段指令
+type CompilationScope struct {
+	instructions code.Instructions
+	locations    []code.Location
+	loops        []*loopContext // 由外到内包围当前位置的循环
+	blocks       [][]int        // 循环中各语句块内被闭包捕获的变量 即CompiledFunction.Blocks
+	renew        []int          // 由外到内包围当前位置的语句块在blocks中的下标 不在循环中时为-1
+}
+
+// 循环的编译信息 用于编译break和continue
+type loopContext struct {
+	pending int   // 进入循环时栈中等待使用的值的个数
+	cont    int   // continue跳转的位置
+	breaks  []int // 待回填的break跳转指令
+}
+
+type Compiler struct {
+	constants   []object.Object
+	symbolTable *SymbolTable
+
+	scopes     []CompilationScope
+	scopeIndex int
+
+	// 外层表达式已压栈 尚未使用的值的个数
+	// break和continue出现在表达式中时 跳转前需要弹出这些值
+	pending int
+
+	// 正在编译的各层可选链中 跳转到链末尾的指令
+	chains [][]int
+
+	node ast.Node // 正在编译的节点 用于标记超出操作数表示范围的错误
+	err  error    // 第一个超出操作数表示范围的错误 编译结束时返回
+}
+
+// New 创建编译器
+func New() *Compiler {
+	return &Compiler{
+		constants:   []object.Object{},
+		symbolTable: NewSymbolTable(evaluator.BuiltinNames()),
+		scopes:      []CompilationScope{{}},
+	}
+}
+
+// Compile 编译整个程序 失败时返回*diagnostic.Diagnostic
+func (c *Compiler) Compile(program *ast.Program) error {
+	err := c.compileProgram(program)
+	if c.err != nil {
+		return c.err
+	}
+	return err
+}
+
+func (c *Compiler) compileProgram(program *ast.Program) error {
+	hoisted := c.hoistFunctions(program.Statements)
+	for i, stmt := range program.Statements {
+		if err := c.compile(stmt); err != nil {
+			return err
+		}
+		if _, ok := stmt.(*ast.ExpressionStatement); ok {
+			// 与求值器一样 程序的值为最后一条语句的值
+			if i == len(program.Statements)-1 {
+				c.emit(code.OpReturnValue)
+				return c.compileHoisted(hoisted)
+			}
+			c.emit(code.OpPop)
+		}
+	}
+	c.emit(code.OpReturn)
+	return c.compileHoisted(hoisted)
+}
+
+// Bytecode 返回编译的结果
+func (c *Compiler) Bytecode() *Bytecode {
+	scope := c.scopes[c.scopeIndex]
+	main := &code.CompiledFunction{
+		Instructions: scope.instructions,
+		Locations:    scope.locations,
+		Blocks:       scope.blocks,
+	}
+	return &Bytecode{
+		Main:         main,
+		Constants:    c.constants,
+		GlobalNames:  c.symbolTable.Names(),
+		ConstGlobals: c.symbolTable.ReadOnly(),
+	}
+}
+
+// 编译节点 并记录正在编译的节点
+func (c *Compiler) compile(node ast.Node) error {
+	outer := c.node
+	c.node = node
+	err := c.compileNode(node)
+	c.node = outer
+	return err
+}
+
+func (c *Compiler) compileNode(node ast.Node) error {
+	switch node := node.(type) {
+	case *ast.ExpressionStatement:
+		return c.compile(node.Expression)
+
+	case *ast.LetStatement:
+		// 函数字面量先定义名称 使函数体能够递归引用自身
+		// 其他表达式先求值 使右侧仍能引用外层的同名变量
+		var symbol Symbol
+		_, isFunction := node.Value.(*ast.FunctionLiteral)
+		if isFunction {
+			symbol = c.symbolTable.Define(node.Name.Value, node.IsConst())
+		}
+		if err := c.compile(node.Value); err != nil {
+			return err
+		}
+		if !isFunction {
+			symbol = c.symbolTable.Define(node.Name.Value, node.IsConst())
+		}
+		c.storeSymbol(symbol)
+
+	case *ast.ReturnStatement:
+		if err := c.compile(node.ReturnValue); err != nil {
+			return err
+		}
+		c.emit(code.OpReturnValue)
+
+	case *ast.BlockStatement:
+		return c.compileBlock(node)
+
+	case *ast.BreakStatement, *ast.ContinueStatement:
+		return c.compileBranchStatement(node)
+
+	case *ast.FunctionDeclaration:
+		// 函数声明已在所在语句块的开头提升
+
+	case *ast.IntegerLiteral:
+		var integer object.Object = &object.Integer{Value: node.Value}
+		if node.Big != nil {
+			integer = &object.BigInt{Value: node.Big}
+		}
+		c.emit(code.OpConstant, c.addConstant(integer))
+
+	case *ast.FloatLiteral:
+		float := &object.Float{Value: node.Value}
+		c.emit(code.OpConstant, c.addConstant(float))
+
+	case *ast.StringLiteral:
+		str := &object.String{Value: node.Value}
+		c.emit(code.OpConstant, c.addConstant(str))
+
+	case *ast.Boolean:
+		if node.Value {
+			c.emit(code.OpTrue)
+		} else {
+			c.emit(code.OpFalse)
+		}
+
+	case *ast.NullLiteral:
+		c.emit(code.OpNull)
+
+	case *ast.Identifier:
+		symbol := c.symbolTable.Resolve(node.Value)
+		c.loadSymbol(symbol, node.Span())
+
+	case *ast.PrefixExpression:
+		if err := c.compile(node.Right); err != nil {
+			return err
+		}
+		switch node.Operator {
+		case "!":
+			c.emitAt(node.Span(), code.OpBang)
+		case "-":
+			c.emitAt(node.Span(), code.OpMinus)
+		case "~":
+			c.emitAt(node.Span(), code.OpBitNot)
+		default:
+			return unsupported(node)
+		}
+
+	case *ast.InfixExpression:
+		if node.Operator == "&&" || node.Operator == "||" {
+			return c.compileLogicalExpression(node)
+		}
+		if node.Operator == "??" {
+			return c.compileNullishExpression(node)
+		}
+		op, ok := infixOpcodes[node.Operator]
+		if !ok {
+			return unsupported(node)
+		}
+		if err := c.compileOperand(node.Left); err != nil {
+			return err
+		}
+		if err := c.compile(node.Right); err != nil {
+			return err
+		}
+		c.pending--
+		c.emitAt(node.Span(), op)
+
+	case *ast.AssignExpression:
+		return c.compileAssignExpression(node)
+
+	case *ast.IndexAssignExpression:
+		return c.compileIndexAssignExpression(node)
+
+	case *ast.IfExpression:
+		return c.compileIfExpression(node)
+
+	case *ast.WhileExpression:
+		return c.compileWhileExpression(node)
+
+	case *ast.ForExpression:
+		return c.compileForExpression(node)
+
+	case *ast.FunctionLiteral:
+		return c.compileFunctionLiteral(node)
+
+	case *ast.CallExpression:
+		return c.compileCallExpression(node)
+
+	case *ast.ArrayLiteral:
+		for _, el := range node.Elements {
+			if err := c.compileOperand(el); err != nil {
+				return err
+			}
+		}
+		c.pending -= len(node.Elements)
+		c.emit(code.OpArray, len(node.Elements))
+
+	case *ast.HashLiteral:
+		for key, value := range node.Pairs {
+			if err := c.compileOperand(key); err != nil {
+				return err
+			}
+			if err := c.compileOperand(value); err != nil {
+				return err
+			}
+		}
+		c.pending -= len(node.Pairs) * 2
+		c.emitAt(node.Span(), code.OpHash, len(node.Pairs)*2)
+
+	case *ast.IndexExpression:
+		if err := c.compileOperand(node.Left); err != nil {
+			return err
+		}
+		if node.Optional {
+			chain := len(c.chains) - 1
+			c.chains[chain] = append(c.chains[chain], c.emit(code.OpJumpNull, 9999))
+		}
+		if err := c.compile(node.Index); err != nil {
+			return err
+		}
+		c.pending--
+		c.emitAt(node.Span(), code.OpIndex)
+
+	case *ast.SliceExpression:
+		if err := c.compileOperand(node.Left); err != nil {
+			return err
+		}
+		if node.Optional {
+			chain := len(c.chains) - 1
+			c.chains[chain] = append(c.chains[chain], c.emit(code.OpJumpNull, 9999))
+		}
+		// 省略的部分压入NULL
+		for _, bound := range []ast.Expression{node.Start, node.Stop, node.Step} {
+			if bound == nil {
+				c.emit(code.OpNull)
+				c.pending++
+			} else if err := c.compileOperand(bound); err != nil {
+				return err
+			}
+		}
+		c.pending -= 4
+		c.emitAt(node.Span(), code.OpSlice)
+
+	case *ast.OptionalChain:
+		// 可选访问的对象为NULL时 保留栈顶的NULL跳转到链的末尾
+		c.chains = append(c.chains, nil)
+		if err := c.compile(node.Expression); err != nil {
+			return err
+		}
+		for _, jump := range c.chains[len(c.chains)-1] {
+			c.changeOperand(jump, len(c.currentInstructions()))
+		}
+		c.chains = c.chains[:len(c.chains)-1]
+
+	default:
+		return unsupported(node)
+	}
+	return nil
+}
+
+// 中缀运算符对应的操作码
+var infixOpcodes = map[string]code.Opcode{
+	"+":  code.OpAdd,
+	"-":  code.OpSub,
+	"*":  code.OpMul,
+	"/":  code.OpDiv,
+	"%":  code.OpMod,
+	"==": code.OpEqual,
+	"!=": code.OpNotEqual,
+	"<":  code.OpLessThan,
+	">":  code.OpGreaterThan,
+	"<=": code.OpLessEqual,
+	">=": code.OpGreaterEqual,
+	"&":  code.OpBitAnd,
+	"|":  code.OpBitOr,
+	"^":  code.OpBitXor,
+	"<<": code.OpShiftLeft,
+	">>": code.OpShiftRight,
+}
+
+// 编译逻辑运算 通过跳转实现短路求值 结果为布尔值
+//
+//	a && b:                 a || b:
+//	  a                       a
+//	  JumpNotTruthy false     JumpNotTruthy right
+//	  b                       True
+//	  JumpNotTruthy false     Jump end
+//	  True                  right:
+//	  Jump end                b
+//	false:                    JumpNotTruthy false
+//	  False                   True
+//	end:                      Jump end
+//	                        false:
+//	                          False
+//	                        end:
+func (c *Compiler) compileLogicalExpression(node *ast.InfixExpression) error {
+	if err := c.compile(node.Left); err != nil {
+		return err
+	}
+	var jumps []int // 跳转到压入true处的指令
+	leftJump := c.emit(code.OpJumpNotTruthy, 9999)
+	if node.Operator == "||" {
+		c.emit(code.OpTrue)
+		jumps = append(jumps, c.emit(code.OpJump, 9999))
+		c.changeOperand(leftJump, len(c.currentInstructions()))
+	}
+
+	if err := c.compile(node.Right); err != nil {
+		return err
+	}
+	rightJump := c.emit(code.OpJumpNotTruthy, 9999)
+	c.emit(code.OpTrue)
+	jumps = append(jumps, c.emit(code.OpJump, 9999))
+
+	falsePos := len(c.currentInstructions())
+	if node.Operator == "&&" {
+		c.changeOperand(leftJump, falsePos)
+	}
+	c.changeOperand(rightJump, falsePos)
+	c.emit(code.OpFalse)
+
+	for _, jump := range jumps {
+		c.changeOperand(jump, len(c.currentInstructions()))
+	}
+	return nil
+}
+
+// 编译空值合并运算 左操作数不为NULL时跳过右操作数
+//
+//	a ?? b:
+//	  a
+//	  JumpNull right
+//	  Jump end
+//	right:
+//	  Pop
+//	  b
+//	end:
+func (c *Compiler) compileNullishExpression(node *ast.InfixExpression) error {
+	if err := c.compile(node.Left); err != nil {
+		return err
+	}
+	nullJump := c.emit(code.OpJumpNull, 9999)
+	endJump := c.emit(code.OpJump, 9999)
+	c.changeOperand(nullJump, len(c.currentInstructions()))
+	c.emit(code.OpPop)
+	if err := c.compile(node.Right); err != nil {
+		return err
+	}
+	c.changeOperand(endJump, len(c.currentInstructions()))
+	return nil
+}
+
+// 编译语句块 语句块执行后在栈顶留下它的值
+// 与求值器一样 语句块的值为最后一条表达式语句的值 否则为NULL
+func (c *Compiler) compileBlock(block *ast.BlockStatement) error {
+	hoisted := c.hoistFunctions(block.Statements)
+	for i, stmt := range block.Statements {
+		if err := c.compile(stmt); err != nil {
+			return err
+		}
+		if _, ok := stmt.(*ast.ExpressionStatement); ok {
+			if i == len(block.Statements)-1 {
+				return c.compileHoisted(hoisted)
+			}
+			c.emit(code.OpPop)
+		}
+	}
+	c.emit(code.OpNull)
+	return c.compileHoisted(hoisted)
+}
+
+// 编译表达式并将其值留在栈中 供外层表达式随后使用
+// 调用者使用这些值后负责减少pending
+func (c *Compiler) compileOperand(node ast.Node) error {
+	if err := c.compile(node); err != nil {
+		return err
+	}
+	c.pending++
+	return nil
+}
+
+// 被提升的函数声明 函数体编译后存入常量池中预留的位置
+type hoistedFunction struct {
+	literal  *ast.FunctionLiteral
+	constant int
+}
+
+// 提升语句块中的函数声明 在其他语句之前创建闭包
+// 先定义所有的函数名 使各函数体能够相互引用
+// 函数体在语句块的其余部分之后由compileHoisted编译 使其能够引用语句块中随后定义的变量
+func (c *Compiler) hoistFunctions(statements []ast.Statement) []hoistedFunction {
+	var hoisted []hoistedFunction
+	var symbols []Symbol
+	for _, stmt := range statements {
+		if decl, ok := stmt.(*ast.FunctionDeclaration); ok {
+			hoisted = append(hoisted, hoistedFunction{literal: decl.Function, constant: c.addConstant(nil)})
+			symbols = append(symbols, c.symbolTable.Define(decl.Name.Value, false))
+		}
+	}
+	outer := c.node
+	for i, fn := range hoisted {
+		c.node = fn.literal
+		c.emit(code.OpClosure, fn.constant)
+		c.storeSymbol(symbols[i])
+	}
+	c.node = outer
+	return hoisted
+}
+
+// 编译被提升的函数声明的函数体
+func (c *Compiler) compileHoisted(hoisted []hoistedFunction) error {
+	outer := c.node
+	defer func() { c.node = outer }()
+	for _, fn := range hoisted {
+		c.node = fn.literal
+		compiled, err := c.compileFunction(fn.literal)
+		if err != nil {
+			return err
+		}
+		c.constants[fn.constant] = compiled
+	}
+	return nil
+}
+
+// 编译语句块 语句块是一个新的作用域
+func (c *Compiler) compileScopedBlock(block *ast.BlockStatement) error {
+	c.enterBlock(len(c.scopes[c.scopeIndex].loops) > 0)
+	defer c.leaveBlock()
+	return c.compileBlock(block)
+}
+
+// 进入语句块 renew表示语句块在同一次调用中会重复执行
+// 与求值器每次执行语句块时创建新的环境一样 生成OpRenewCells为其中的变量创建新的存储单元
+// 使每次执行时创建的闭包捕获各自的变量 语句块中被捕获的变量在离开语句块时回填
+func (c *Compiler) enterBlock(renew bool) {
+	c.symbolTable.EnterBlock()
+	scope := &c.scopes[c.scopeIndex]
+	index := -1
+	if renew {
+		index = len(scope.blocks)
+		scope.blocks = append(scope.blocks, nil)
+		c.emit(code.OpRenewCells, index)
+	}
+	scope.renew = append(scope.renew, index)
+}
+
+// 离开语句块
+func (c *Compiler) leaveBlock() {
+	captured := c.symbolTable.LeaveBlock()
+	scope := &c.scopes[c.scopeIndex]
+	if index := scope.renew[len(scope.renew)-1]; index >= 0 {
+		scope.blocks[index] = captured
+	}
+	scope.renew = scope.renew[:len(scope.renew)-1]
+}
+
+// 编译赋值表达式 赋值后将变量的新值压栈作为表达式的值
+// 复合赋值先读取变量的当前值 再计算右侧表达式
+func (c *Compiler) compileAssignExpression(node *ast.AssignExpression) error {
+	symbol := c.symbolTable.ResolveVariable(node.Name.Value)
+	var op code.Opcode
+	if node.Operator != "=" {
+		var ok bool
+		if op, ok = infixOpcodes[strings.TrimSuffix(node.Operator, "=")]; !ok {
+			return unsupported(node)
+		}
+		c.loadSymbol(symbol, node.Name.Span())
+		c.pending++
+	}
+
+	if err := c.compile(node.Value); err != nil {
+		return err
+	}
+	if node.Operator != "=" {
+		c.pending--
+		c.emitAt(node.Span(), op)
+	}
+
+	switch symbol.Scope {
+	case GlobalScope:
+		c.emitAt(node.Span(), code.OpAssignGlobal, symbol.Index)
+	case LocalScope:
+		c.emitAt(node.Span(), code.OpAssignLocal, symbol.Index)
+	case FreeScope:
+		c.emitAt(node.Span(), code.OpAssignFree, symbol.Index)
+	}
+	c.loadSymbol(symbol, node.Span())
+	return nil
+}
+
+// 编译索引赋值表达式 复合赋值时用OpIndexKeep读取元素的当前值
+//
+//	<对象>
+//	<索引>
+//	[OpIndexKeep]
+//	<右侧表达式>
+//	[<运算>]
+//	OpSetIndex
+func (c *Compiler) compileIndexAssignExpression(node *ast.IndexAssignExpression) error {
+	var op code.Opcode
+	if node.Operator != "=" {
+		var ok bool
+		if op, ok = infixOpcodes[strings.TrimSuffix(node.Operator, "=")]; !ok {
+			return unsupported(node)
+		}
+	}
+
+	if err := c.compileOperand(node.Target.Left); err != nil {
+		return err
+	}
+	if err := c.compileOperand(node.Target.Index); err != nil {
+		return err
+	}
+	if node.Operator != "=" {
+		c.emitAt(node.Target.Span(), code.OpIndexKeep)
+		c.pending++
+	}
+
+	if err := c.compile(node.Value); err != nil {
+		return err
+	}
+	if node.Operator != "=" {
+		c.pending--
+		c.emitAt(node.Span(), op)
+	}
+	c.pending -= 2
+	c.emitAt(node.Span(), code.OpSetIndex)
+	return nil
+}
+
+// 编译if表达式
+//
+//	<条件>
+//	OpJumpNotTruthy else
+//	<if语句块>
+//	OpJump end
+//	else: <else语句块>或OpNull
+//	end:
+func (c *Compiler) compileIfExpression(ie *ast.IfExpression) error {
+	if err := c.compile(ie.Condition); err != nil {
+		return err
+	}
+	jumpNotTruthy := c.emit(code.OpJumpNotTruthy, 9999)
+
+	if err := c.compileScopedBlock(ie.Consequence); err != nil {
+		return err
+	}
+	jump := c.emit(code.OpJump, 9999)
+	c.changeOperand(jumpNotTruthy, len(c.currentInstructions()))
+
+	if ie.Alternative == nil {
+		c.emit(code.OpNull)
+	} else if err := c.compileScopedBlock(ie.Alternative); err != nil {
+		return err
+	}
+	c.changeOperand(jump, len(c.currentInstructions()))
+	return nil
+}
+
+// 编译while表达式 循环的值为NULL
+// continue跳转到条件处 break跳转到end
+//
+//	loop: <条件>
+//	OpJumpNotTruthy end
+//	<循环体>
+//	OpPop
+//	OpJump loop
+//	end: OpNull
+func (c *Compiler) compileWhileExpression(we *ast.WhileExpression) error {
+	loop := len(c.currentInstructions())
+	if err := c.compile(we.Condition); err != nil {
+		return err
+	}
+	jumpNotTruthy := c.emit(code.OpJumpNotTruthy, 9999)
+
+	ctx := c.enterLoop(loop)
+	if err := c.compileScopedBlock(we.Body); err != nil {
+		return err
+	}
+	c.leaveLoop()
+	c.emit(code.OpPop)
+	c.emit(code.OpJump, loop)
+
+	end := len(c.currentInstructions())
+	c.changeOperand(jumpNotTruthy, end)
+	for _, jump := range ctx.breaks {
+		c.changeOperand(jump, end)
+	}
+	c.emit(code.OpNull)
+	return nil
+}
+
+// 编译for表达式 循环期间迭代器保存在栈中 循环的值为NULL
+// continue跳转到loop break跳转到done 先弹出迭代器再结束循环
+//
+//	<被遍历的表达式>
+//	OpGetIter
+//	loop: OpIterNext end
+//	OpIterResult end
+//	OpRenewCells
+//	<将值和键存入循环变量>
+//	<循环体>
+//	OpPop
+//	OpJump loop
+//	done: OpPop
+//	end: OpNull
+func (c *Compiler) compileForExpression(fe *ast.ForExpression) error {
+	if err := c.compile(fe.Iterable); err != nil {
+		return err
+	}
+	c.emitAt(fe.Iterable.Span(), code.OpGetIter)
+
+	// 被遍历的是函数时 OpIterNext调用该函数 调用栈中记录这一层调用
+	loop := c.emit(code.OpIterNext, 9999)
+	c.addLocation(code.Location{Offset: loop, Span: fe.Iterable.Span(), Callee: functionName(fe.Iterable)})
+	result := c.emitAt(fe.Iterable.Span(), code.OpIterResult, 9999)
+
+	// 循环变量与循环体属于同一个作用域 每次迭代都是新的变量
+	c.enterBlock(true)
+	defer c.leaveBlock()
+
+	c.storeSymbol(c.symbolTable.Define(fe.Value.Value, false))
+	if fe.Key != nil {
+		c.storeSymbol(c.symbolTable.Define(fe.Key.Value, false))
+	} else {
+		c.emit(code.OpPop)
+	}
+
+	ctx := c.enterLoop(loop)
+	if err := c.compileBlock(fe.Body); err != nil {
+		return err
+	}
+	c.leaveLoop()
+	c.emit(code.OpPop)
+	c.emit(code.OpJump, loop)
+
+	if len(ctx.breaks) > 0 {
+		done := c.emit(code.OpPop)
+		for _, jump := range ctx.breaks {
+			c.changeOperand(jump, done)
+		}
+	}
+	end := len(c.currentInstructions())
+	c.changeOperand(loop, end)
+	c.changeOperand(result, end)
+	c.emit(code.OpNull)
+	return nil
+}
+
+// 进入循环体 cont为continue跳转的位置
+func (c *Compiler) enterLoop(cont int) *loopContext {
+	ctx := &loopContext{pending: c.pending, cont: cont}
+	scope := &c.scopes[c.scopeIndex]
+	scope.loops = append(scope.loops, ctx)
+	return ctx
+}
+
+// 离开循环体
+func (c *Compiler) leaveLoop() {
+	scope := &c.scopes[c.scopeIndex]
+	scope.loops = scope.loops[:len(scope.loops)-1]
+}
+
+// 编译break和continue 弹出外层表达式留在栈中的值后跳转
+// 语法分析器保证二者只出现在循环体中
+func (c *Compiler) compileBranchStatement(node ast.Node) error {
+	loops := c.scopes[c.scopeIndex].loops
+	if len(loops) == 0 {
+		return unsupported(node)
+	}
+	ctx := loops[len(loops)-1]
+
+	for i := ctx.pending; i < c.pending; i++ {
+		c.emit(code.OpPop)
+	}
+	if _, ok := node.(*ast.BreakStatement); ok {
+		ctx.breaks = append(ctx.breaks, c.emit(code.OpJump, 9999))
+	} else {
+		c.emit(code.OpJump, ctx.cont)
+	}
+	return nil
+}
+
+// 编译调用表达式
+// 实参中有展开的可迭代对象时 相邻的普通实参组成一个数组 展开的实参各自转换为数组
+// 由OpCallSpread将这些数组拼接为实参
+// 处于尾部位置的调用使用OpTailCall和OpTailCallSpread
+func (c *Compiler) compileCallExpression(node *ast.CallExpression) error {
+	if err := c.compileOperand(node.Function); err != nil {
+		return err
+	}
+
+	spread := false
+	for _, arg := range node.Arguments {
+		if _, ok := arg.(*ast.SpreadExpression); ok {
+			spread = true
+		}
+	}
+
+	var pos int
+	if !spread {
+		for _, arg := range node.Arguments {
+			if err := c.compileOperand(arg); err != nil {
+				return err
+			}
+		}
+		c.pending -= 1 + len(node.Arguments)
+		op := code.OpCall
+		if node.Tail {
+			op = code.OpTailCall
+		}
+		pos = c.emit(op, len(node.Arguments))
+	} else {
+		segments, run := 0, 0
+		flush := func() {
+			if run > 0 {
+				c.emit(code.OpArray, run)
+				c.pending -= run - 1
+				segments++
+				run = 0
+			}
+		}
+		for _, arg := range node.Arguments {
+			se, ok := arg.(*ast.SpreadExpression)
+			if !ok {
+				if err := c.compileOperand(arg); err != nil {
+					return err
+				}
+				run++
+				continue
+			}
+			flush()
+			if err := c.compileOperand(se.Value); err != nil {
+				return err
+			}
+			c.emitAt(se.Span(), code.OpSpread)
+			segments++
+		}
+		flush()
+		c.pending -= 1 + segments
+		op := code.OpCallSpread
+		if node.Tail {
+			op = code.OpTailCallSpread
+		}
+		pos = c.emit(op, segments)
+	}
+	c.addLocation(code.Location{Offset: pos, Span: node.Span(), Callee: calleeName(node)})
+	return nil
+}
+
+// 编译函数字面量 生成创建闭包的指令
+func (c *Compiler) compileFunctionLiteral(fl *ast.FunctionLiteral) error {
+	fn, err := c.compileFunction(fl)
+	if err != nil {
+		return err
+	}
+	c.emit(code.OpClosure, c.addConstant(fn))
+	return nil
+}
+
+// 将函数字面量编译为CompiledFunction 函数体编译到新的作用域中
+// 函数体的值即为函数的返回值
+//
+// 调用时缺少的参数为NULL 函数开头依次为它们计算默认值
+//
+//	OpJumpIfArg <参数下标> next
+//	<默认值>
+//	OpSetLocal <参数下标>
+//	next:
+func (c *Compiler) compileFunction(fl *ast.FunctionLiteral) (*code.CompiledFunction, error) {
+	c.enterScope()
+
+	var params []Symbol
+	for _, param := range fl.Parameters {
+		params = append(params, c.symbolTable.Define(param.Value, false))
+	}
+	min := len(fl.Parameters)
+	if fl.Variadic {
+		min--
+	}
+	for i, value := range fl.Defaults {
+		if value == nil {
+			continue
+		}
+		if i < min {
+			min = i
+		}
+		jump := c.emit(code.OpJumpIfArg, i, 9999)
+		if err := c.compile(value); err != nil {
+			return nil, err
+		}
+		c.storeSymbol(params[i])
+		c.changeOperand(jump, i, len(c.currentInstructions()))
+	}
+
+	if err := c.compileBlock(fl.Body); err != nil {
+		return nil, err
+	}
+	c.emit(code.OpReturnValue)
+
+	names := c.symbolTable.Names()
+	var free []code.Capture
+	for _, symbol := range c.symbolTable.FreeSymbols() {
+		free = append(free, code.Capture{
+			Name:  symbol.Name,
+			Local: symbol.Scope != FreeScope,
+			Index: symbol.Index,
+		})
+	}
+	scope := c.leaveScope()
+
+	return &code.CompiledFunction{
+		Instructions:  scope.instructions,
+		Locations:     scope.locations,
+		Name:          fl.Name,
+		NumLocals:     len(names),
+		NumParameters: len(fl.Parameters),
+		MinParameters: min,
+		Variadic:      fl.Variadic,
+		LocalNames:    names,
+		Free:          free,
+		Blocks:        scope.blocks,
+		Literal:       fl,
+	}, nil
+}
+
+// 生成读取变量的指令
+func (c *Compiler) loadSymbol(s Symbol, span token.Span) {
+	switch s.Scope {
+	case GlobalScope:
+		c.emitAt(span, code.OpGetGlobal, s.Index)
+	case LocalScope:
+		c.emitAt(span, code.OpGetLocal, s.Index)
+	case FreeScope:
+		c.emitAt(span, code.OpGetFree, s.Index)
+	case BuiltinScope:
+		c.emit(code.OpGetBuiltin, s.Index)
+	}
+}
+
+// 生成写入变量的指令
+func (c *Compiler) storeSymbol(s Symbol) {
+	switch s.Scope {
+	case GlobalScope:
+		c.emit(code.OpSetGlobal, s.Index)
+	case LocalScope:
+		c.emit(code.OpSetLocal, s.Index)
+	}
+}
+
+func (c *Compiler) addConstant(obj object.Object) int {
+	c.constants = append(c.constants, obj)
+	return len(c.constants) - 1
+}
+
+// 生成一条指令 返回指令的位置
+func (c *Compiler) emit(op code.Opcode, operands ...int) int {
+	c.checkOperands(op, operands)
+	ins := code.Make(op, operands...)
+	scope := &c.scopes[c.scopeIndex]
+
+	pos := len(scope.instructions)
+	scope.instructions = append(scope.instructions, ins...)
+	return pos
+}
+
+// 生成一条可能出错的指令 并记录其对应的源代码区间
+func (c *Compiler) emitAt(span token.Span, op code.Opcode, operands ...int) int {
+	pos := c.emit(op, operands...)
+	c.addLocation(code.Location{Offset: pos, Span: span})
+	return pos
+}
+
+func (c *Compiler) addLocation(loc code.Location) {
+	scope := &c.scopes[c.scopeIndex]
+	scope.locations = append(scope.locations, loc)
+}
+
+// 回填跳转指令的操作数
+func (c *Compiler) changeOperand(pos int, operands ...int) {
+	ins := c.currentInstructions()
+	op := code.Opcode(ins[pos])
+	c.checkOperands(op, operands)
+	copy(ins[pos:], code.Make(op, operands...))
+}
+
+// 检查操作数能否以定义的宽度表示 超出范围时记录错误 由Compile返回
+func (c *Compiler) checkOperands(op code.Opcode, operands []int) {
+	def, err := code.Lookup(byte(op))
+	if err != nil || c.err != nil {
+		return
+	}
+	for i, operand := range operands {
+		max := 1<<(8*def.OperandWidths[i]) - 1
+		if operand < 0 || operand > max {
+			var span token.Span
+			if c.node != nil {
+				span = c.node.Span()
+			}
+			c.err = diagnostic.New(ErrUnsupportedNode, span,
+				"%s %d exceeds the bytecode limit of %d", operandNames[op], operand, max)
+			return
+		}
+	}
+}
+
+func (c *Compiler) currentInstructions() code.Instructions {
+	return c.scopes[c.scopeIndex].instructions
+}
+
+// 进入函数作用域
+func (c *Compiler) enterScope() {
+	c.scopes = append(c.scopes, CompilationScope{})
+	c.scopeIndex++
+	c.symbolTable = NewEnclosedSymbolTable(c.symbolTable)
+}
+
+// 离开函数作用域 返回该作用域的编译结果
+func (c *Compiler) leaveScope() CompilationScope {
+	scope := c.scopes[c.scopeIndex]
+	c.scopes = c.scopes[:len(c.scopes)-1]
+	c.scopeIndex--
+	c.symbolTable = c.symbolTable.Outer
+	return scope
+}
+
+// 返回调用表达式中被调用函数的名称 与求值器的调用栈一致
+func calleeName(call *ast.CallExpression) string {
+	return functionName(call.Function)
+}
+
+// 返回表达式所表示的函数的名称 用于调用栈
+func functionName(expr ast.Expression) string {
+	if ident, ok := expr.(*ast.Identifier); ok {
+		return ident.Value
+	}
+	return "<anonymous>"
+}
+
+func unsupported(node ast.Node) error {
+	return diagnostic.New(ErrUnsupportedNode, node.Span(),
+		"`%s` is not supported by the bytecode compiler", node.TokenLiteral())
+}
@@ -0,0 +1,193 @@
+package compiler
+
+import (
+	"bamboo/ast"
+	"bamboo/compiler/code"
+	"bamboo/diagnostic"
+	"bamboo/lexer"
+	"bamboo/object"
+	"bamboo/parser"
+	"fmt"
+	"strings"
+	"testing"
+)
+
+func parse(t *testing.T, input string) *ast.Program {
+	t.Helper()
+	p := parser.New(lexer.New(input))
+	program := p.ParseProgram()
+	if errs := p.Errors(); len(errs) != 0 {
+		t.Fatalf("parser errors for %q: %v", input, errs[0].Message)
+	}
+	return program
+}
+
+func testCompile(t *testing.T, input string) *Bytecode {
+	t.Helper()
+	c := New()
+	if err := c.Compile(parse(t, input)); err != nil {
+		t.Fatalf("compiler error for %q: %v", input, err)
+	}
+	return c.Bytecode()
+}
+
+func concatInstructions(s [][]byte) code.Instructions {
+	var out code.Instructions
+	for _, ins := range s {
+		out = append(out, ins...)
+	}
+	return out
+}
+
+func TestCompileInstructions(t *testing.T) {
+	tests := []struct {
+		input        string
+		constants    []int64
+		instructions [][]byte
+	}{
+		{
+			`1 + 2;`,
+			[]int64{1, 2},
+			[][]byte{
+				code.Make(code.OpConstant, 0),
+				code.Make(code.OpConstant, 1),
+				code.Make(code.OpAdd),
+				code.Make(code.OpReturnValue),
+			},
+		},
+		{
+			`let a = 1; a;`,
+			[]int64{1},
+			[][]byte{
+				code.Make(code.OpConstant, 0),
+				code.Make(code.OpSetGlobal, 0),
+				code.Make(code.OpGetGlobal, 0),
+				code.Make(code.OpReturnValue),
+			},
+		},
+		{
+			`if (true) { 10 }; 3;`,
+			[]int64{10, 3},
+			[][]byte{
+				code.Make(code.OpTrue),
+				code.Make(code.OpJumpNotTruthy, 10),
+				code.Make(code.OpConstant, 0),
+				code.Make(code.OpJump, 11),
+				code.Make(code.OpNull),
+				code.Make(code.OpPop),
+				code.Make(code.OpConstant, 1),
+				code.Make(code.OpReturnValue),
+			},
+		},
+		{
+			// 循环中的语句块为被捕获的变量创建新的存储单元
+			`for (i in [1]) { func() { i } }`,
+			[]int64{1},
+			[][]byte{
+				code.Make(code.OpConstant, 0),
+				code.Make(code.OpArray, 1),
+				code.Make(code.OpGetIter),
+				code.Make(code.OpIterNext, 27),
+				code.Make(code.OpIterResult, 27),
+				code.Make(code.OpRenewCells, 0),
+				code.Make(code.OpSetGlobal, 0),
+				code.Make(code.OpPop),
+				code.Make(code.OpClosure, 1),
+				code.Make(code.OpPop),
+				code.Make(code.OpJump, 7),
+				code.Make(code.OpNull),
+				code.Make(code.OpReturnValue),
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		bytecode := testCompile(t, tt.input)
+		want := concatInstructions(tt.instructions)
+		if got := bytecode.Main.Instructions; got.String() != want.String() {
+			t.Errorf("%q: wrong instructions.\ngot:\n%swant:\n%s", tt.input, got, want)
+		}
+		for i, value := range tt.constants {
+			integer, ok := bytecode.Constants[i].(*object.Integer)
+			if !ok || integer.Value != value {
+				t.Errorf("%q: wrong constant %d. got=%s, want=%d", tt.input, i, bytecode.Constants[i].Inspect(), value)
+			}
+		}
+	}
+}
+
+func TestClosureCaptures(t *testing.T) {
+	bytecode := testCompile(t, `let f = func(x) { let y = x; func() { func() { x + y + z } } }; let z = 1;`)
+
+	// 常量池中依次为最内层 中间层和最外层的函数
+	inner := bytecode.Constants[0].(*code.CompiledFunction)
+	middle := bytecode.Constants[1].(*code.CompiledFunction)
+	outer := bytecode.Constants[2].(*code.CompiledFunction)
+
+	// 顶层代码中的变量不被捕获
+	if got, want := fmt.Sprint(inner.Free), "[{x false 0} {y false 1}]"; got != want {
+		t.Errorf("wrong inner captures. got=%s, want=%s", got, want)
+	}
+	if got, want := fmt.Sprint(middle.Free), "[{x true 0} {y true 1}]"; got != want {
+		t.Errorf("wrong middle captures. got=%s, want=%s", got, want)
+	}
+	if len(outer.Free) != 0 {
+		t.Errorf("outer function should not capture variables. got=%v", outer.Free)
+	}
+
+	// 顶层语句块中的变量每次执行语句块时不同 同样由闭包捕获
+	bytecode = testCompile(t, `let fs = []; for (i in range(3)) { let j = i; push(fs, func() { i + j }) }`)
+	fn := bytecode.Constants[len(bytecode.Constants)-1].(*code.CompiledFunction)
+	if got, want := fmt.Sprint(fn.Free), "[{i true 1} {j true 2}]"; got != want {
+		t.Errorf("wrong captures of block variables. got=%s, want=%s", got, want)
+	}
+	if got, want := fmt.Sprint(bytecode.Main.Blocks), "[[1 2]]"; got != want {
+		t.Errorf("wrong renewed cells. got=%s, want=%s", got, want)
+	}
+}
+
+func TestOperandLimits(t *testing.T) {
+	var constants, body strings.Builder
+	for i := 0; i < 70000; i++ {
+		fmt.Fprintf(&constants, "%d;\n", 100000+i)
+	}
+	for i := 0; i < 6000; i++ {
+		fmt.Fprintf(&body, "x = %d / 1;\n", i)
+	}
+
+	tests := []struct {
+		input   string
+		message string
+	}{
+		{constants.String(), "constant index 65536 exceeds the bytecode limit of 65535"},
+		{callWithArguments(300), "argument count 300 exceeds the bytecode limit of 255"},
+		{"let x = 0; while (x < 2) {\n" + body.String() + "}", "jump target"},
+	}
+
+	for _, tt := range tests {
+		err := New().Compile(parse(t, tt.input))
+		d, ok := err.(*diagnostic.Diagnostic)
+		if !ok {
+			t.Errorf("expected a diagnostic for %.20q... got=%v", tt.input, err)
+			continue
+		}
+		if d.Code != ErrUnsupportedNode || !strings.Contains(d.Message, tt.message) {
+			t.Errorf("wrong diagnostic. got=%s %q, want message containing %q", d.Code, d.Message, tt.message)
+		}
+		if !d.Span.IsValid() {
+			t.Errorf("diagnostic %q has no source span", d.Message)
+		}
+	}
+
+	// 恰好处于上限时正常编译
+	testCompile(t, callWithArguments(255))
+}
+
+// 以n个实参调用函数的程序
+func callWithArguments(n int) string {
+	args := make([]string, n)
+	for i := range args {
+		args[i] = fmt.Sprint(i)
+	}
+	return "let f = func(...a) { len(a) }; f(" + strings.Join(args, ", ") + ");"
+}
@@ -0,0 +1,187 @@
+package compiler
+
+import "sort"
+
+// 符号表记录标识符与其存储位置的对应关系
+// 顶层代码中定义的变量保存在全局变量表中
+// 函数中定义的变量和参数保存在函数的局部变量中 每层函数有一个符号表
+// 内层函数引用外层函数的变量时 创建闭包时捕获该变量的存储单元 通过捕获列表中的下标读写
+// 语句块中定义的变量只在语句块内可见 占用所在函数(或全局变量表)中新的位置
+// 顶层语句块中的变量每次执行语句块时都是新的变量 因此同样由闭包捕获
+
+type SymbolScope string
+
+const (
+	GlobalScope  SymbolScope = "GLOBAL"
+	LocalScope   SymbolScope = "LOCAL"
+	FreeScope    SymbolScope = "FREE"
+	BuiltinScope SymbolScope = "BUILTIN"
+)
+
+// Symbol 符号
+type Symbol struct {
+	Name  string
+	Scope SymbolScope
+	Index int
+	Block bool // 是否定义在语句块中 仅用于GlobalScope
+}
+
+// SymbolTable 符号表
+type SymbolTable struct {
+	Outer *SymbolTable
+
+	store    map[string]Symbol
+	blocks   []map[string]Symbol // 当前所在的各层语句块 由外向内
+	names    []string            // 按下标记录的变量名
+	readOnly []bool              // 按下标记录变量是否由const声明
+	captured []bool              // 按下标记录变量是否被内层函数捕获
+	free     []Symbol            // 捕获的外层变量 为其在外层符号表中的符号
+	builtins map[string]int
+}
+
+// NewSymbolTable 创建顶层符号表
+func NewSymbolTable(builtins []string) *SymbolTable {
+	s := &SymbolTable{store: make(map[string]Symbol), builtins: make(map[string]int)}
+	for i, name := range builtins {
+		s.builtins[name] = i
+	}
+	return s
+}
+
+// NewEnclosedSymbolTable 为函数创建符号表
+func NewEnclosedSymbolTable(outer *SymbolTable) *SymbolTable {
+	s := NewSymbolTable(nil)
+	s.Outer = outer
+	s.builtins = outer.builtins
+	return s
+}
+
+// EnterBlock 进入语句块
+func (s *SymbolTable) EnterBlock() {
+	s.blocks = append(s.blocks, make(map[string]Symbol))
+}
+
+// LeaveBlock 离开语句块 其中定义的变量不再可见
+// 返回语句块中被内层函数捕获的变量的下标
+func (s *SymbolTable) LeaveBlock() []int {
+	block := s.blocks[len(s.blocks)-1]
+	s.blocks = s.blocks[:len(s.blocks)-1]
+
+	var captured []int
+	for _, symbol := range block {
+		if s.captured[symbol.Index] {
+			captured = append(captured, symbol.Index)
+		}
+	}
+	sort.Ints(captured)
+	return captured
+}
+
+// Define 在当前符号表最内层的语句块中定义变量 已定义的变量沿用原来的位置
+// 对常量的赋值由语法分析器静态检查 这里只记录全局常量供虚拟机在运行时检查
+func (s *SymbolTable) Define(name string, constant bool) Symbol {
+	store, block := s.store, len(s.blocks) > 0
+	if block {
+		store = s.blocks[len(s.blocks)-1]
+	}
+	symbol := s.define(store, name, block)
+	if constant {
+		s.readOnly[symbol.Index] = true
+	}
+	return symbol
+}
+
+// 在store中定义变量 并分配新的位置 block表示store是否为语句块
+func (s *SymbolTable) define(store map[string]Symbol, name string, block bool) Symbol {
+	if symbol, ok := store[name]; ok {
+		return symbol
+	}
+	symbol := Symbol{Name: name, Index: len(s.names)}
+	if s.Outer == nil {
+		symbol.Scope = GlobalScope
+		symbol.Block = block
+	} else {
+		symbol.Scope = LocalScope
+	}
+	store[name] = symbol
+	s.names = append(s.names, name)
+	s.readOnly = append(s.readOnly, false)
+	s.captured = append(s.captured, false)
+	return symbol
+}
+
+// 在当前符号表中由内向外查找变量
+func (s *SymbolTable) lookup(name string) (Symbol, bool) {
+	for i := len(s.blocks) - 1; i >= 0; i-- {
+		if symbol, ok := s.blocks[i][name]; ok {
+			return symbol, true
+		}
+	}
+	symbol, ok := s.store[name]
+	return symbol, ok
+}
+
+// Resolve 由内向外查找变量
+// 与求值器一样 变量在运行时才要求已经赋值
+// 因此未找到的名称按全局变量处理 由虚拟机在读取时检查
+func (s *SymbolTable) Resolve(name string) Symbol {
+	if symbol, ok := s.lookup(name); ok {
+		return symbol
+	}
+	if s.Outer == nil {
+		if index, ok := s.builtins[name]; ok {
+			return Symbol{Name: name, Scope: BuiltinScope, Index: index}
+		}
+		return s.define(s.store, name, false)
+	}
+
+	// 顶层代码中的变量只有一份 直接读写全局变量表
+	symbol := s.Outer.Resolve(name)
+	if symbol.Scope == BuiltinScope || symbol.Scope == GlobalScope && !symbol.Block {
+		return symbol
+	}
+	return s.capture(symbol)
+}
+
+// 捕获外层函数的变量 同一变量只捕获一次
+func (s *SymbolTable) capture(outer Symbol) Symbol {
+	for i, free := range s.free {
+		if free.Scope == outer.Scope && free.Index == outer.Index {
+			return Symbol{Name: outer.Name, Scope: FreeScope, Index: i}
+		}
+	}
+	if outer.Scope != FreeScope {
+		s.Outer.captured[outer.Index] = true
+	}
+	s.free = append(s.free, outer)
+	return Symbol{Name: outer.Name, Scope: FreeScope, Index: len(s.free) - 1}
+}
+
+// ResolveVariable 查找可以赋值的变量 与Resolve相同 但不查找内置函数
+// 与求值器一样 内置函数不能被赋值 按未定义的全局变量处理
+func (s *SymbolTable) ResolveVariable(name string) Symbol {
+	symbol := s.Resolve(name)
+	if symbol.Scope != BuiltinScope {
+		return symbol
+	}
+	table := s
+	for table.Outer != nil {
+		table = table.Outer
+	}
+	return table.define(table.store, name, false)
+}
+
+// ReadOnly 按下标返回各变量是否由const声明
+func (s *SymbolTable) ReadOnly() []bool {
+	return s.readOnly
+}
+
+// FreeSymbols 按下标返回捕获的外层变量在外层符号表中的符号
+func (s *SymbolTable) FreeSymbols() []Symbol {
+	return s.free
+}
+
+// Names 按下标返回所有变量名
+func (s *SymbolTable) Names() []string {
+	return s.names
+}
@@ -1,3 +1,7 @@
-module bamboo
+module bamboo/compiler
 
 go 1.18
+
+require bamboo v0.0.0
+
+replace bamboo => ../bamboo-parser
@@ -0,0 +1,47 @@
+package main
+
+import (
+	"bamboo/command"
+	"bamboo/compiler/compiler"
+	"bamboo/compiler/vm"
+	"bamboo/diagnostic"
+	"bamboo/lexer"
+	"bamboo/parser"
+	"fmt"
+	"os"
+)
+
+// 将源文件编译为字节码 并在虚拟机中执行
+func main() {
+	if len(os.Args) != 2 {
+		fmt.Println("usage: bamboo-vm <file>")
+		return
+	}
+
+	code, err := os.ReadFile(os.Args[1])
+	if err != nil {
+		fmt.Println("no such file")
+		return
+	}
+	source := string(code)
+
+	p := parser.New(lexer.NewFile(os.Args[1], source))
+	program := p.ParseProgram()
+	if len(p.Errors()) != 0 {
+		command.PrintDiagnostics(os.Stdout, source, p.Errors())
+		return
+	}
+
+	comp := compiler.New()
+	if err := comp.Compile(program); err != nil {
+		if d, ok := err.(*diagnostic.Diagnostic); ok {
+			command.PrintDiagnostics(os.Stdout, source, []*diagnostic.Diagnostic{d})
+		} else {
+			fmt.Println(err)
+		}
+		return
+	}
+
+	machine := vm.New(comp.Bytecode())
+	command.PrintResult(os.Stdout, source, machine.Run())
+}
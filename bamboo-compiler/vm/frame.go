@@ -0,0 +1,88 @@
+package vm
+
+import (
+	"bamboo/ast"
+	"bamboo/compiler/code"
+	"bamboo/object"
+	"bytes"
+)
+
+// Cell 变量的存储单元 值为nil表示变量尚未赋值
+// 闭包捕获的是变量的存储单元 因此能看到之后对变量的修改
+type Cell struct {
+	Value object.Object
+}
+
+// 创建n个新的存储单元
+func newCells(n int) []*Cell {
+	cells := make([]Cell, n)
+	slots := make([]*Cell, n)
+	for i := range cells {
+		slots[i] = &cells[i]
+	}
+	return slots
+}
+
+// Scope 函数一次调用的局部变量
+// 顶层代码的局部变量即全局变量
+type Scope struct {
+	Slots []*Cell
+	Fn    *code.CompiledFunction // 用于查找变量名
+}
+
+// Closure 闭包 由编译后的函数和创建时捕获的外层变量组成
+type Closure struct {
+	Fn   *code.CompiledFunction
+	Free []*Cell // 与Fn.Free一一对应
+}
+
+// Type 与求值器中的函数对象类型相同
+func (c *Closure) Type() object.Type {
+	return object.FUNCTION_OBJ
+}
+
+// Inspect 输出格式与求值器中的函数对象相同
+func (c *Closure) Inspect() string {
+	var out bytes.Buffer
+
+	var params, body string
+	if fl := c.Fn.Literal; fl != nil {
+		params = ast.FormatParameters(fl.Parameters, fl.Defaults, fl.Variadic)
+		body = fl.Body.String()
+	}
+
+	out.WriteString("fn")
+	if c.Fn.Name != "" {
+		out.WriteString(" " + c.Fn.Name)
+	}
+	out.WriteString("(")
+	out.WriteString(params)
+	out.WriteString(") {\n")
+	out.WriteString(body)
+	out.WriteString("\n}")
+
+	return out.String()
+}
+
+// Frame 调用帧
+type Frame struct {
+	cl    *Closure
+	ip    int    // 下一条指令的偏移量
+	bp    int    // 调用前的栈顶 返回时恢复
+	site  int    // 调用者中调用指令的偏移量
+	args  int    // 传入的实参个数 用于判断是否需要计算参数的默认值
+	scope *Scope // 局部变量
+	name  string // 调用处被调用函数的名称 用于调用栈
+
+	// 最近一次尾调用 尾调用复用调用帧 出错时将其记录到调用栈中
+	// 之前还有尾调用时记录其所在函数的名称
+	tail *object.Frame
+}
+
+func NewFrame(cl *Closure, bp int, site int, scope *Scope) *Frame {
+	return &Frame{cl: cl, bp: bp, site: site, scope: scope}
+}
+
+func (f *Frame) Instructions() code.Instructions {
+	return f.cl.Fn.Instructions
+}
@@ -0,0 +1,45 @@
+package vm
+
+import (
+	"bamboo/evaluator"
+	"bamboo/object"
+)
+
+// for-in循环遍历时保存在栈中的迭代器
+// 实现了object.Iterable的对象直接由其迭代器产生元素
+// 函数则每次无参数地调用 返回NULL时结束 与求值器一致
+type Iterator struct {
+	it    object.Iterator // 集合的迭代器
+	fn    object.Object   // 被遍历的函数 仅在it为nil时使用
+	index int64           // 函数已产生的元素个数
+}
+
+func (i *Iterator) Type() object.Type {
+	return "ITERATOR"
+}
+
+func (i *Iterator) Inspect() string {
+	return "<iterator>"
+}
+
+// 创建对象的迭代器
+func newIterator(obj object.Object) object.Object {
+	switch obj := obj.(type) {
+	case object.Iterable:
+		return &Iterator{it: obj.Iterator()}
+	case *Closure, *object.Builtin:
+		return &Iterator{fn: obj}
+	default:
+		return evaluator.NewError(evaluator.ErrNotIterable, "object is not iterable: %s", obj.Type())
+	}
+}
+
+// 处理函数产生的结果 函数返回NULL时返回false 否则返回元素的键和值
+func (i *Iterator) result(value object.Object) (object.Object, object.Object, bool) {
+	if value == nil || value == evaluator.NULL {
+		return nil, nil, false
+	}
+	key := &object.Integer{Value: i.index}
+	i.index++
+	return key, value, true
+}
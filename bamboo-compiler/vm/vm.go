@@ -0,0 +1,662 @@
+package vm
+
+import (
+	"bamboo/compiler/code"
+	"bamboo/compiler/compiler"
+	"bamboo/evaluator"
+	"bamboo/object"
+	"math"
+)
+
+// 虚拟机是一个栈式机器 逐条执行编译器生成的指令
+// 操作数和运算结果都保存在栈中 函数调用时压入新的调用帧
+// 运算语义复用求值器 整数运算走快速路径以减少开销
+
+// 虚拟机错误代码
+const (
+	ErrStackOverflow = "V0001" // 栈或调用帧超出容量
+)
+
+const (
+	StackSize = 1 << 20 // 栈的最大容量 调用帧的个数由evaluator.MaxDepth限制
+
+	// 缓存的小整数范围 循环计数等运算不必每次分配新对象
+	smallIntMin = -256
+	smallIntMax = 1024
+)
+
+var smallInts [smallIntMax - smallIntMin + 1]*object.Integer
+
+// 内置函数 下标与编译器中的顺序一致
+var builtins []*object.Builtin
+
+func init() {
+	for i := range smallInts {
+		smallInts[i] = &object.Integer{Value: int64(i + smallIntMin)}
+	}
+	for _, name := range evaluator.BuiltinNames() {
+		builtin, _ := evaluator.LookupBuiltin(name)
+		builtins = append(builtins, builtin)
+	}
+}
+
+type VM struct {
+	constants   []object.Object
+	globals     []*Cell
+	globalNames []string
+	readOnly    []bool // 由const声明的全局变量
+
+	stack []object.Object
+	sp    int // 始终指向栈顶的下一个空位
+
+	frames      []*Frame
+	framesIndex int
+}
+
+// New 创建虚拟机 执行bytecode
+func New(bytecode *compiler.Bytecode) *VM {
+	main := &Closure{Fn: bytecode.Main}
+	globals := newCells(len(bytecode.GlobalNames))
+
+	// 栈和调用帧按需扩容
+	return &VM{
+		constants:   bytecode.Constants,
+		globals:     globals,
+		globalNames: bytecode.GlobalNames,
+		readOnly:    bytecode.ConstGlobals,
+		stack:       make([]object.Object, 2048),
+		frames:      []*Frame{NewFrame(main, 0, 0, &Scope{Slots: globals, Fn: bytecode.Main})},
+		framesIndex: 1,
+	}
+}
+
+// Run 执行字节码 返回程序的值
+// 与求值器一样 运行时错误以*object.Error的形式返回
+func (vm *VM) Run() object.Object {
+	frame := vm.frames[vm.framesIndex-1]
+	ins := frame.Instructions()
+
+	for {
+		pc := frame.ip
+		op := code.Opcode(ins[pc])
+		frame.ip++
+
+		var err object.Object // 当前指令产生的错误
+
+		switch op {
+		case code.OpConstant:
+			index := code.ReadUint16(ins[frame.ip:])
+			frame.ip += 2
+			err = vm.push(vm.constants[index])
+
+		case code.OpPop:
+			vm.pop()
+
+		case code.OpAdd, code.OpSub, code.OpMul, code.OpDiv, code.OpMod,
+			code.OpEqual, code.OpNotEqual, code.OpLessThan, code.OpGreaterThan,
+			code.OpLessEqual, code.OpGreaterEqual,
+			code.OpBitAnd, code.OpBitOr, code.OpBitXor, code.OpShiftLeft, code.OpShiftRight:
+			right := vm.pop()
+			left := vm.pop()
+			err = vm.push(vm.binaryOperation(op, left, right))
+
+		case code.OpMinus:
+			right := vm.pop()
+			if integer, ok := right.(*object.Integer); ok && integer.Value != math.MinInt64 {
+				err = vm.push(newInteger(-integer.Value))
+			} else {
+				err = vm.push(evaluator.EvalPrefix("-", right))
+			}
+
+		case code.OpBang:
+			err = vm.push(evaluator.EvalPrefix("!", vm.pop()))
+
+		case code.OpBitNot:
+			err = vm.push(evaluator.EvalPrefix("~", vm.pop()))
+
+		case code.OpTrue:
+			err = vm.push(evaluator.TRUE)
+
+		case code.OpFalse:
+			err = vm.push(evaluator.FALSE)
+
+		case code.OpNull:
+			err = vm.push(evaluator.NULL)
+
+		case code.OpJump:
+			frame.ip = int(code.ReadUint16(ins[frame.ip:]))
+
+		case code.OpJumpIfArg:
+			index := int(code.ReadUint16(ins[frame.ip:]))
+			target := int(code.ReadUint16(ins[frame.ip+2:]))
+			frame.ip += 4
+			if index < frame.args {
+				frame.ip = target
+			}
+
+		case code.OpJumpNotTruthy:
+			target := int(code.ReadUint16(ins[frame.ip:]))
+			frame.ip += 2
+			if !evaluator.IsTruthy(vm.pop()) {
+				frame.ip = target
+			}
+
+		case code.OpJumpNull:
+			target := int(code.ReadUint16(ins[frame.ip:]))
+			frame.ip += 2
+			if vm.stack[vm.sp-1] == evaluator.NULL {
+				frame.ip = target
+			}
+
+		case code.OpGetGlobal:
+			index := code.ReadUint16(ins[frame.ip:])
+			frame.ip += 2
+			err = vm.pushVariable(vm.globals[index], vm.globalNames[index])
+
+		case code.OpSetGlobal:
+			index := code.ReadUint16(ins[frame.ip:])
+			frame.ip += 2
+			vm.globals[index].Value = vm.pop()
+
+		case code.OpGetLocal:
+			index := code.ReadUint16(ins[frame.ip:])
+			frame.ip += 2
+			err = vm.pushVariable(frame.scope.Slots[index], frame.cl.Fn.LocalNames[index])
+
+		case code.OpSetLocal:
+			index := code.ReadUint16(ins[frame.ip:])
+			frame.ip += 2
+			frame.scope.Slots[index].Value = vm.pop()
+
+		case code.OpGetFree:
+			index := code.ReadUint16(ins[frame.ip:])
+			frame.ip += 2
+			err = vm.pushVariable(frame.cl.Free[index], frame.cl.Fn.Free[index].Name)
+
+		case code.OpAssignGlobal:
+			index := code.ReadUint16(ins[frame.ip:])
+			frame.ip += 2
+			// 在常量声明之前定义的函数中的赋值 只能在运行时检查
+			if vm.readOnly[index] && vm.globals[index].Value != nil {
+				err = evaluator.NewError(evaluator.ErrConstAssign,
+					"cannot assign to constant %s", vm.globalNames[index])
+			} else {
+				err = vm.assignVariable(vm.globals[index], vm.globalNames[index])
+			}
+
+		case code.OpAssignLocal:
+			index := code.ReadUint16(ins[frame.ip:])
+			frame.ip += 2
+			err = vm.assignVariable(frame.scope.Slots[index], frame.cl.Fn.LocalNames[index])
+
+		case code.OpAssignFree:
+			index := code.ReadUint16(ins[frame.ip:])
+			frame.ip += 2
+			err = vm.assignVariable(frame.cl.Free[index], frame.cl.Fn.Free[index].Name)
+
+		case code.OpRenewCells:
+			index := code.ReadUint16(ins[frame.ip:])
+			frame.ip += 2
+			for _, slot := range frame.cl.Fn.Blocks[index] {
+				frame.scope.Slots[slot] = &Cell{}
+			}
+
+		case code.OpGetBuiltin:
+			index := code.ReadUint8(ins[frame.ip:])
+			frame.ip += 1
+			err = vm.push(builtins[index])
+
+		case code.OpArray:
+			count := int(code.ReadUint16(ins[frame.ip:]))
+			frame.ip += 2
+			elements := make([]object.Object, count)
+			copy(elements, vm.stack[vm.sp-count:vm.sp])
+			vm.sp -= count
+			err = vm.push(&object.Array{Elements: elements})
+
+		case code.OpHash:
+			count := int(code.ReadUint16(ins[frame.ip:]))
+			frame.ip += 2
+			hash := vm.buildHash(vm.stack[vm.sp-count : vm.sp])
+			vm.sp -= count
+			err = vm.push(hash)
+
+		case code.OpIndex:
+			index := vm.pop()
+			left := vm.pop()
+			err = vm.push(evaluator.EvalIndex(left, index))
+
+		case code.OpIndexKeep:
+			err = vm.push(evaluator.EvalIndex(vm.stack[vm.sp-2], vm.stack[vm.sp-1]))
+
+		case code.OpSetIndex:
+			val := vm.pop()
+			index := vm.pop()
+			left := vm.pop()
+			err = vm.push(evaluator.SetIndex(left, index, val))
+
+		case code.OpSlice:
+			step := vm.pop()
+			stop := vm.pop()
+			start := vm.pop()
+			left := vm.pop()
+			err = vm.push(evaluator.EvalSlice(left, start, stop, step))
+
+		case code.OpCall:
+			numArgs := int(code.ReadUint8(ins[frame.ip:]))
+			frame.ip += 1
+			err = vm.call(numArgs, pc)
+			frame = vm.frames[vm.framesIndex-1]
+			ins = frame.Instructions()
+
+		case code.OpCallSpread:
+			segments := int(code.ReadUint8(ins[frame.ip:]))
+			frame.ip += 1
+			var numArgs int
+			if numArgs, err = vm.spreadArguments(segments); err == nil {
+				err = vm.call(numArgs, pc)
+			}
+			frame = vm.frames[vm.framesIndex-1]
+			ins = frame.Instructions()
+
+		case code.OpTailCall:
+			numArgs := int(code.ReadUint8(ins[frame.ip:]))
+			frame.ip += 1
+			err = vm.tailCall(numArgs, pc)
+			frame = vm.frames[vm.framesIndex-1]
+			ins = frame.Instructions()
+
+		case code.OpTailCallSpread:
+			segments := int(code.ReadUint8(ins[frame.ip:]))
+			frame.ip += 1
+			var numArgs int
+			if numArgs, err = vm.spreadArguments(segments); err == nil {
+				err = vm.tailCall(numArgs, pc)
+			}
+			frame = vm.frames[vm.framesIndex-1]
+			ins = frame.Instructions()
+
+		case code.OpSpread:
+			err = vm.push(evaluator.Spread(vm.pop()))
+
+		case code.OpReturnValue:
+			result := vm.pop()
+			if vm.framesIndex == 1 {
+				return result
+			}
+			vm.popFrame()
+			frame = vm.frames[vm.framesIndex-1]
+			ins = frame.Instructions()
+			err = vm.push(result)
+
+		case code.OpReturn:
+			if vm.framesIndex == 1 {
+				return nil
+			}
+			vm.popFrame()
+			frame = vm.frames[vm.framesIndex-1]
+			ins = frame.Instructions()
+			err = vm.push(evaluator.NULL)
+
+		case code.OpClosure:
+			index := code.ReadUint16(ins[frame.ip:])
+			frame.ip += 2
+			err = vm.push(vm.newClosure(frame, vm.constants[index].(*code.CompiledFunction)))
+
+		case code.OpGetIter:
+			err = vm.push(newIterator(vm.pop()))
+
+		case code.OpIterNext:
+			end := int(code.ReadUint16(ins[frame.ip:]))
+			frame.ip += 2
+			iter := vm.stack[vm.sp-1].(*Iterator)
+
+			switch fn := iter.fn.(type) {
+			case *Closure:
+				// 调用返回后由OpIterResult处理函数的结果
+				if err = vm.push(fn); err == nil {
+					err = vm.call(0, pc)
+					frame = vm.frames[vm.framesIndex-1]
+					ins = frame.Instructions()
+				}
+			case *object.Builtin:
+				if result := fn.Fn(); isError(result) {
+					err = result
+				} else {
+					key, value, ok := iter.result(result)
+					err = vm.iterate(frame, key, value, ok, end)
+				}
+			default:
+				key, value, ok := iter.it.Next()
+				err = vm.iterate(frame, key, value, ok, end)
+			}
+
+		case code.OpIterResult:
+			end := int(code.ReadUint16(ins[frame.ip:]))
+			frame.ip += 2
+			result := vm.pop()
+			key, value, ok := vm.stack[vm.sp-1].(*Iterator).result(result)
+			err = vm.iterate(frame, key, value, ok, end)
+		}
+
+		if err != nil {
+			// 由出错的指令标记错误的位置
+			if e, ok := err.(*object.Error); ok {
+				if !e.Span.IsValid() {
+					e.Span = frame.cl.Fn.SpanAt(pc)
+				}
+				vm.unwind(e)
+			}
+			return err
+		}
+	}
+}
+
+// 中缀运算对应的运算符
+var operators = map[code.Opcode]string{
+	code.OpAdd:          "+",
+	code.OpSub:          "-",
+	code.OpMul:          "*",
+	code.OpDiv:          "/",
+	code.OpMod:          "%",
+	code.OpEqual:        "==",
+	code.OpNotEqual:     "!=",
+	code.OpLessThan:     "<",
+	code.OpGreaterThan:  ">",
+	code.OpLessEqual:    "<=",
+	code.OpGreaterEqual: ">=",
+	code.OpBitAnd:       "&",
+	code.OpBitOr:        "|",
+	code.OpBitXor:       "^",
+	code.OpShiftLeft:    "<<",
+	code.OpShiftRight:   ">>",
+}
+
+// 计算中缀运算 两个整数的运算直接计算 溢出等其余情况交由求值器
+func (vm *VM) binaryOperation(op code.Opcode, left, right object.Object) object.Object {
+	l, lok := left.(*object.Integer)
+	r, rok := right.(*object.Integer)
+	if lok && rok {
+		switch op {
+		case code.OpAdd:
+			if value, ok := evaluator.AddInt(l.Value, r.Value); ok {
+				return newInteger(value)
+			}
+		case code.OpSub:
+			if value, ok := evaluator.SubInt(l.Value, r.Value); ok {
+				return newInteger(value)
+			}
+		case code.OpMul:
+			if value, ok := evaluator.MulInt(l.Value, r.Value); ok {
+				return newInteger(value)
+			}
+		case code.OpEqual:
+			return nativeBoolToBooleanObject(l.Value == r.Value)
+		case code.OpNotEqual:
+			return nativeBoolToBooleanObject(l.Value != r.Value)
+		case code.OpLessThan:
+			return nativeBoolToBooleanObject(l.Value < r.Value)
+		case code.OpGreaterThan:
+			return nativeBoolToBooleanObject(l.Value > r.Value)
+		case code.OpLessEqual:
+			return nativeBoolToBooleanObject(l.Value <= r.Value)
+		case code.OpGreaterEqual:
+			return nativeBoolToBooleanObject(l.Value >= r.Value)
+		case code.OpBitAnd:
+			return newInteger(l.Value & r.Value)
+		case code.OpBitOr:
+			return newInteger(l.Value | r.Value)
+		case code.OpBitXor:
+			return newInteger(l.Value ^ r.Value)
+		}
+	}
+	return evaluator.EvalInfix(operators[op], left, right)
+}
+
+// 由栈中交替排列的键和值构造哈希表
+func (vm *VM) buildHash(items []object.Object) object.Object {
+	pairs := make(map[object.HashKey]object.HashPair)
+
+	for i := 0; i < len(items); i += 2 {
+		key, value := items[i], items[i+1]
+		hashKey, ok := key.(object.Hashable)
+		if !ok {
+			return evaluator.NewError(evaluator.ErrUnhashable,
+				"unusable as hash key: %s", key.Type())
+		}
+		pairs[hashKey.HashKey()] = object.HashPair{Key: key, Value: value}
+	}
+	return &object.Hash{Pairs: pairs}
+}
+
+// 调用栈中位于参数之下的函数
+func (vm *VM) call(numArgs int, site int) object.Object {
+	callee := vm.stack[vm.sp-1-numArgs]
+
+	switch callee := callee.(type) {
+	case *Closure:
+		// 主程序不计入嵌套深度
+		if vm.framesIndex > evaluator.MaxDepth {
+			return evaluator.NewError(evaluator.ErrRecursion, "maximum recursion depth exceeded")
+		}
+		name := vm.calleeName(callee, site)
+		scope, err := vm.bindArguments(callee, name, numArgs)
+		if err != nil {
+			return err
+		}
+
+		vm.sp -= numArgs
+		frame := NewFrame(callee, vm.sp-1, site, scope)
+		frame.args = numArgs
+		frame.name = name
+		if vm.framesIndex < len(vm.frames) {
+			vm.frames[vm.framesIndex] = frame
+		} else {
+			vm.frames = append(vm.frames, frame)
+		}
+		vm.framesIndex++
+		return nil
+
+	case *object.Builtin:
+		args := make([]object.Object, numArgs)
+		copy(args, vm.stack[vm.sp-numArgs:vm.sp])
+		vm.sp = vm.sp - numArgs - 1
+
+		result := callee.Fn(args...)
+		if result == nil {
+			result = evaluator.NULL
+		}
+		return vm.push(result)
+
+	default:
+		return evaluator.NewError(evaluator.ErrNotFunction, "not a function: %s", callee.Type())
+	}
+}
+
+// 尾调用 被调用的是闭包时以它替换当前调用帧中的函数 调用帧的个数不变
+// 被调用的函数返回时直接返回到当前函数的调用者
+func (vm *VM) tailCall(numArgs int, site int) object.Object {
+	callee, ok := vm.stack[vm.sp-1-numArgs].(*Closure)
+	if !ok {
+		return vm.call(numArgs, site)
+	}
+	name := vm.calleeName(callee, site)
+	scope, err := vm.bindArguments(callee, name, numArgs)
+	if err != nil {
+		return err
+	}
+
+	frame := vm.frames[vm.framesIndex-1]
+	frame.tail = evaluator.TailFrame(frame.tail, name, frame.cl.Fn.LocationAt(site).Span)
+	frame.cl, frame.ip, frame.args, frame.scope = callee, 0, numArgs, scope
+	// 丢弃当前函数留在栈中的值 只保留调用帧底部的函数
+	vm.stack[frame.bp] = callee
+	vm.sp = frame.bp + 1
+	return nil
+}
+
+// 返回调用栈中被调用函数的名称 具名函数使用自身的名称 否则使用调用处的名称
+func (vm *VM) calleeName(callee *Closure, site int) string {
+	if callee.Fn.Name != "" {
+		return callee.Fn.Name
+	}
+	return vm.frames[vm.framesIndex-1].cl.Fn.LocationAt(site).Callee
+}
+
+// 检查实参个数 并将栈顶的实参绑定到函数的局部变量
+// 多余的实参收集到剩余参数中 缺少的参数为NULL 随后由函数计算默认值
+func (vm *VM) bindArguments(callee *Closure, name string, numArgs int) (*Scope, object.Object) {
+	fn := callee.Fn
+	max := fn.NumParameters
+	if fn.Variadic {
+		max = -1
+	}
+	if err := evaluator.ArityError(name, fn.MinParameters, max, numArgs); err != nil {
+		return nil, err
+	}
+	scope := &Scope{Slots: newCells(fn.NumLocals), Fn: fn}
+
+	args := vm.stack[vm.sp-numArgs : vm.sp]
+	params := fn.NumParameters
+	if fn.Variadic {
+		params--
+		rest := []object.Object{}
+		if len(args) > params {
+			rest = append(rest, args[params:]...)
+			args = args[:params]
+		}
+		scope.Slots[params].Value = &object.Array{Elements: rest}
+	}
+	for i, arg := range args {
+		scope.Slots[i].Value = arg
+	}
+	for i := len(args); i < params; i++ {
+		scope.Slots[i].Value = evaluator.NULL
+	}
+	return scope, nil
+}
+
+// 在调用帧frame中创建闭包 捕获frame中的局部变量或frame所属闭包已捕获的变量
+func (vm *VM) newClosure(frame *Frame, fn *code.CompiledFunction) *Closure {
+	free := make([]*Cell, len(fn.Free))
+	for i, capture := range fn.Free {
+		if capture.Local {
+			free[i] = frame.scope.Slots[capture.Index]
+		} else {
+			free[i] = frame.cl.Free[capture.Index]
+		}
+	}
+	return &Closure{Fn: fn, Free: free}
+}
+
+// 将栈顶的数组依次展开压栈作为实参 返回实参个数
+func (vm *VM) spreadArguments(segments int) (int, object.Object) {
+	var args []object.Object
+	for _, segment := range vm.stack[vm.sp-segments : vm.sp] {
+		args = append(args, segment.(*object.Array).Elements...)
+	}
+	vm.sp -= segments
+	for _, arg := range args {
+		if err := vm.push(arg); err != nil {
+			return 0, err
+		}
+	}
+	return len(args), nil
+}
+
+// 错误从各层函数调用中传出 依次记录调用帧
+func (vm *VM) unwind(err *object.Error) {
+	for i := vm.framesIndex - 1; i > 0; i-- {
+		frame := vm.frames[i]
+		if frame.tail != nil {
+			err.Trace = append(err.Trace, *frame.tail)
+		}
+		loc := vm.frames[i-1].cl.Fn.LocationAt(frame.site)
+		err.Trace = append(err.Trace, object.Frame{Function: frame.name, Span: loc.Span})
+	}
+}
+
+// 压入迭代产生的键和值 遍历结束时弹出迭代器并跳转到end
+// 由OpIterNext直接产生元素时 跳过其后的OpIterResult
+func (vm *VM) iterate(frame *Frame, key, value object.Object, ok bool, end int) object.Object {
+	if !ok {
+		vm.pop()
+		frame.ip = end
+		return nil
+	}
+	if code.Opcode(frame.Instructions()[frame.ip]) == code.OpIterResult {
+		frame.ip += 3
+	}
+	if err := vm.push(key); err != nil {
+		return err
+	}
+	return vm.push(value)
+}
+
+// 弹出调用帧 并移除栈中的函数
+func (vm *VM) popFrame() {
+	vm.framesIndex--
+	vm.sp = vm.frames[vm.framesIndex].bp
+	vm.frames[vm.framesIndex] = nil
+}
+
+// 将变量的值压栈 变量尚未赋值时返回错误
+func (vm *VM) pushVariable(cell *Cell, name string) object.Object {
+	if cell.Value != nil {
+		return vm.push(cell.Value)
+	}
+	return undefined(name)
+}
+
+// 弹出栈顶元素赋给已声明的变量
+func (vm *VM) assignVariable(cell *Cell, name string) object.Object {
+	if cell.Value == nil {
+		return undefined(name)
+	}
+	cell.Value = vm.pop()
+	return nil
+}
+
+// 压栈 运算结果为错误时直接返回该错误
+func (vm *VM) push(obj object.Object) object.Object {
+	if isError(obj) {
+		return obj
+	}
+	if vm.sp >= len(vm.stack) {
+		if len(vm.stack) >= StackSize {
+			return evaluator.NewError(ErrStackOverflow, "stack overflow")
+		}
+		vm.stack = append(vm.stack, make([]object.Object, len(vm.stack))...)
+	}
+	vm.stack[vm.sp] = obj
+	vm.sp++
+	return nil
+}
+
+func (vm *VM) pop() object.Object {
+	obj := vm.stack[vm.sp-1]
+	vm.sp--
+	return obj
+}
+
+func newInteger(value int64) *object.Integer {
+	if smallIntMin <= value && value <= smallIntMax {
+		return smallInts[value-smallIntMin]
+	}
+	return &object.Integer{Value: value}
+}
+
+func nativeBoolToBooleanObject(input bool) *object.Boolean {
+	if input {
+		return evaluator.TRUE
+	}
+	return evaluator.FALSE
+}
+
+func undefined(name string) *object.Error {
+	return evaluator.NewError(evaluator.ErrUnknownIdentifier, "identifier not found: %s", name)
+}
+
+func isError(obj object.Object) bool {
+	return obj != nil && obj.Type() == object.ERROR_OBJ
+}
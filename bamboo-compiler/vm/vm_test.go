@@ -0,0 +1,203 @@
+package vm
+
+import (
+	"bamboo/compiler/compiler"
+	"bamboo/diagnostic"
+	"bamboo/evaluator"
+	"bamboo/lexer"
+	"bamboo/object"
+	"bamboo/parser"
+	"strings"
+	"testing"
+)
+
+func runVM(t *testing.T, input string) object.Object {
+	t.Helper()
+	p := parser.New(lexer.New(input))
+	program := p.ParseProgram()
+	if errs := p.Errors(); len(errs) != 0 {
+		t.Fatalf("parser errors for %q: %v", input, errs[0].Message)
+	}
+	comp := compiler.New()
+	if err := comp.Compile(program); err != nil {
+		t.Fatalf("compiler error for %q: %v", input, err)
+	}
+	return New(comp.Bytecode()).Run()
+}
+
+func runEval(t *testing.T, input string) object.Object {
+	t.Helper()
+	p := parser.New(lexer.New(input))
+	program := p.ParseProgram()
+	if errs := p.Errors(); len(errs) != 0 {
+		t.Fatalf("parser errors for %q: %v", input, errs[0].Message)
+	}
+	return evaluator.Eval(program, object.NewEnvironment())
+}
+
+// 结果的输出形式 错误为其错误代码
+func describe(obj object.Object) string {
+	switch obj := obj.(type) {
+	case nil:
+		return "nil"
+	case *object.Error:
+		return obj.Code
+	default:
+		return obj.Inspect()
+	}
+}
+
+// 检查虚拟机与求值器的结果相同且符合预期 want为结果的输出形式或错误代码
+func testSameResult(t *testing.T, input string, want string) {
+	t.Helper()
+	vmResult := describe(runVM(t, input))
+	evalResult := describe(runEval(t, input))
+	if vmResult != evalResult {
+		t.Errorf("%q: vm and evaluator differ. vm=%s, evaluator=%s", input, vmResult, evalResult)
+	}
+	if vmResult != want {
+		t.Errorf("%q: wrong result. got=%s, want=%s", input, vmResult, want)
+	}
+}
+
+func TestClosureCapture(t *testing.T) {
+	tests := []struct {
+		input string
+		want  string
+	}{
+		// 每次迭代都是新的循环变量
+		{`let fs = []; for (i in range(3)) { push(fs, func() { i }) }; [fs[0](), fs[1](), fs[2]()];`, "[0, 1, 2]"},
+		{`let fs = []; let i = 0; while (i < 3) { let j = i; push(fs, func() { j }); i += 2; }; [fs[0](), fs[1]()];`, "[0, 2]"},
+		{`let f = func() { let fs = []; for (i in range(3)) { let j = i * 10; push(fs, func() { i + j }) } fs }; let fs = f(); [fs[0](), fs[2]()];`, "[0, 22]"},
+		{`let fs = []; for (k, v in [5, 6]) { push(fs, func() { [k, v] }) }; [fs[0](), fs[1]()];`, "[[0, 5], [1, 6]]"},
+		// 同一次迭代中的闭包共享变量
+		{`let fs = []; for (i in range(2)) { let n = i; push(fs, func() { n += 10 }); push(fs, func() { n }) }; fs[0](); [fs[1](), fs[3]()];`, "[10, 1]"},
+		// 多层函数捕获循环变量
+		{`let fs = []; for (i in range(2)) { push(fs, func() { func() { i } }) }; [fs[0]()(), fs[1]()()];`, "[0, 1]"},
+		{`let fs = []; let i = 0; while (i < 3) { i += 1; if (i == 2) { continue; } let v = i; push(fs, func() { v }) }; [fs[0](), fs[1]()];`, "[1, 3]"},
+		// 闭包看到之后对变量的修改
+		{`let counter = func() { let n = 0; func() { n += 1 } }; let c = counter(); c(); c(); c();`, "3"},
+		{`let a = 1; let f = func() { a }; a = 2; f();`, "2"},
+		{`let f = func() { let x = 1; let g = func() { x }; x = 5; g() }; f();`, "5"},
+		// 提升的函数声明能够引用所在语句块中的变量
+		{`func outer() { let a = 1; func inner() { a } inner() } outer();`, "1"},
+		{`let r = []; for (x in range(2)) { let y = x * 2; func show() { y } push(r, show()) }; r;`, "[0, 2]"},
+		{`func f() { func g() { h() } func h() { 7 } g() } f();`, "7"},
+		{`let f = func() { let g = func() { y }; g() }; f();`, evaluator.ErrUnknownIdentifier},
+	}
+
+	for _, tt := range tests {
+		testSameResult(t, tt.input, tt.want)
+	}
+}
+
+func TestVMMatchesEvaluator(t *testing.T) {
+	tests := []struct {
+		input string
+		want  string
+	}{
+		{`1 + 2 * 3 - 4 / 2;`, "5"},
+		{`9223372036854775807 + 1;`, "9223372036854775808"},
+		{`7 % 3 + (1 << 4) + (6 & 3) + (6 | 1) + (6 ^ 3) + ~0;`, "30"},
+		{`1.5 * 2;`, "3.0"},
+		{`[7 / 2, 7 / 2.0, 2.5 < 3, int(-3.9)];`, "[3, 3.5, true, -3]"},
+		{`"ab" + "c";`, "abc"},
+		{`[1, 2, 3][1:];`, "[2, 3]"},
+		{`{"a": 1}["a"];`, "1"},
+		{`let a = [1]; push(a, 2); a[0] = 5; a;`, "[5, 2]"},
+		{`if (1 < 2) { "yes" } else { "no" };`, "yes"},
+		{`let s = 0; for (i in range(5)) { if (i == 3) { break; } s += i; }; s;`, "3"},
+		{`let s = 0; let i = 0; while (i < 5) { i += 1; if (i % 2 == 0) { continue; } s += i; }; s;`, "9"},
+		{`let r = []; for (x in [1, 2, 3]) { let v = if (x == 2) { break } else { x }; push(r, v) }; r;`, "[1]"},
+		{`let s = 0; for (x in [1, 2, 3]) { s += if (x > 1) { continue } else { x }; }; s;`, "1"},
+		{`let r = []; let i = 0; while (i < 4) { i += 1; push(r, if (i == 3) { continue } else { i }); }; r;`, "[1, 2, 4]"},
+		{`let f = func() { let r = if (true) { return 5 } else { 0 }; 99 }; f();`, "5"},
+		{`let f = func(a, b = a * 2, ...rest) { [a, b, rest] }; f(1);`, "[1, 2, []]"},
+		{`let f = func(...a) { len(a) }; f(...[1, 2], 3);`, "3"},
+		{`func fact(n) { if (n < 2) { 1 } else { n * fact(n - 1) } } fact(20);`, "2432902008176640000"},
+		{`let loop = func(n, acc) { if (n == 0) { acc } else { loop(n - 1, acc + 1) } }; loop(50000, 0);`, "50000"},
+		{`let x = null; x?.a ?? "default";`, "default"},
+		{`const c = 1; let f = func() { c }; f();`, "1"},
+		{`1 / 0;`, evaluator.ErrDivisionByZero},
+		{`1.5 / 0;`, evaluator.ErrDivisionByZero},
+		{`1 % 0.0;`, evaluator.ErrDivisionByZero},
+		{`let x = 0.0; 2.5 / x;`, evaluator.ErrDivisionByZero},
+		{`7.5 % 2;`, "1.5"},
+		{`1 << 100000000000;`, evaluator.ErrInvalidValue},
+		{`1 + "a";`, evaluator.ErrTypeMismatch},
+		{`undefinedName;`, evaluator.ErrUnknownIdentifier},
+		{`let f = func(a) { a }; f();`, evaluator.ErrArgumentCount},
+		{`[1][5] = 1;`, evaluator.ErrIndexOutOfRange},
+	}
+
+	for _, tt := range tests {
+		testSameResult(t, tt.input, tt.want)
+	}
+}
+
+// 虚拟机的调用栈与求值器相同 包括尾调用所在的函数
+func TestTraceMatchesEvaluator(t *testing.T) {
+	tests := []string{
+		`let f = func(x) { x / 0 }; let g = func(x) { let y = f(x); y }; g(1);`,
+		`let f = func(x){ let g = func(y){ y / 0 }; g(x) }; func outer(){ f(1) } outer()`,
+		`func loop(n) { if (n == 0) { 1 / 0 } else { loop(n - 1) } } loop(3);`,
+		`let f = func(a) { a }; let g = func() { f() }; let h = func() { g() }; h();`,
+	}
+
+	for _, input := range tests {
+		vmErr, ok := runVM(t, input).(*object.Error)
+		if !ok {
+			t.Fatalf("%q: expected vm error", input)
+		}
+		evalErr, ok := runEval(t, input).(*object.Error)
+		if !ok {
+			t.Fatalf("%q: expected evaluator error", input)
+		}
+		if len(vmErr.Trace) != len(evalErr.Trace) {
+			t.Errorf("%q: wrong trace length. vm=%v, evaluator=%v", input, vmErr.Trace, evalErr.Trace)
+			continue
+		}
+		for i, frame := range vmErr.Trace {
+			if frame != evalErr.Trace[i] {
+				t.Errorf("%q: frame %d differs. vm=%+v, evaluator=%+v", input, i, frame, evalErr.Trace[i])
+			}
+		}
+	}
+}
+
+func TestArgumentLimit(t *testing.T) {
+	// 字节码中实参个数的上限
+	args := make([]string, 255)
+	for i := range args {
+		args[i] = "1"
+	}
+	input := "let f = func(...a) { len(a) }; f(" + strings.Join(args, ", ") + ");"
+	testSameResult(t, input, "255")
+}
+
+// 虚拟机不支持异常处理 编译时报告错误而不是产生与求值器不同的结果
+func TestUnsupportedTry(t *testing.T) {
+	tests := []string{
+		`try { 1 } catch (e) { 2 };`,
+		`try { 1 } finally { 2 };`,
+		`throw "oops";`,
+		`let f = func() { throw 1 }; f();`,
+	}
+
+	for _, input := range tests {
+		p := parser.New(lexer.New(input))
+		program := p.ParseProgram()
+		if errs := p.Errors(); len(errs) != 0 {
+			t.Fatalf("parser errors for %q: %v", input, errs[0].Message)
+		}
+		err := compiler.New().Compile(program)
+		d, ok := err.(*diagnostic.Diagnostic)
+		if !ok {
+			t.Errorf("%q: expected a diagnostic. got=%v", input, err)
+			continue
+		}
+		if d.Code != compiler.ErrUnsupportedNode {
+			t.Errorf("%q: wrong error code. got=%s, want=%s", input, d.Code, compiler.ErrUnsupportedNode)
+		}
+	}
+}
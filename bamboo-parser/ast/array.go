@@ -13,6 +13,7 @@ import (
 type ArrayLiteral struct {
 	Token    token.Token  // '['词法单元
 	Elements []Expression // 数组元素
+	Rbracket token.Token  // ']'词法单元
 }
 
 func (al *ArrayLiteral) expressionNode() {}
@@ -33,3 +34,7 @@ func (al *ArrayLiteral) String() string {
 
 	return out.String()
 }
+
+func (al *ArrayLiteral) Span() token.Span {
+	return join(al.Token.Span, al.Rbracket.Span)
+}
@@ -0,0 +1,71 @@
+package ast
+
+import (
+	"bamboo/token"
+	"bytes"
+)
+
+// 赋值表达式 修改已声明的变量 值为赋给变量的值
+// 形式: <标识符> = <表达式>
+// 复合赋值: <标识符> += <表达式> 等价于 <标识符> = <标识符> + <表达式>
+// eg. x = 5
+// count += 1
+
+// AssignExpression 赋值表达式结构
+type AssignExpression struct {
+	Token    token.Token // 赋值运算符词法单元
+	Name     *Identifier // 被赋值的变量
+	Operator string      // 赋值运算符 "=" 或复合赋值运算符 eg. "+="
+	Value    Expression  // 等号右侧表达式
+}
+
+func (ae *AssignExpression) expressionNode() {}
+func (ae *AssignExpression) TokenLiteral() string {
+	return ae.Token.Literal
+}
+func (ae *AssignExpression) String() string {
+	var out bytes.Buffer
+
+	out.WriteString("(")
+	out.WriteString(ae.Name.String())
+	out.WriteString(" " + ae.Operator + " ")
+	out.WriteString(ae.Value.String())
+	out.WriteString(")")
+
+	return out.String()
+}
+func (ae *AssignExpression) Span() token.Span {
+	return join(ae.Name.Span(), spanOf(ae.Value))
+}
+
+// 索引赋值表达式 修改数组的元素或哈希表的键值对 值为赋给元素的值
+// 形式: <表达式>[<表达式>] = <表达式>
+// 复合赋值与变量相同 eg. arr[0] = 5
+// counts["a"] += 1
+
+// IndexAssignExpression 索引赋值表达式结构
+type IndexAssignExpression struct {
+	Token    token.Token      // 赋值运算符词法单元
+	Target   *IndexExpression // 被赋值的元素
+	Operator string           // 赋值运算符
+	Value    Expression       // 等号右侧表达式
+}
+
+func (ia *IndexAssignExpression) expressionNode() {}
+func (ia *IndexAssignExpression) TokenLiteral() string {
+	return ia.Token.Literal
+}
+func (ia *IndexAssignExpression) String() string {
+	var out bytes.Buffer
+
+	out.WriteString("(")
+	out.WriteString(ia.Target.String())
+	out.WriteString(" " + ia.Operator + " ")
+	out.WriteString(ia.Value.String())
+	out.WriteString(")")
+
+	return out.String()
+}
+func (ia *IndexAssignExpression) Span() token.Span {
+	return join(ia.Target.Span(), spanOf(ia.Value))
+}
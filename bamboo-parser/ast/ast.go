@@ -12,6 +12,7 @@ import (
 type Node interface {
 	TokenLiteral() string // 返回关联的词法单元的字面量
 	String() string
+	Span() token.Span // 返回节点在源代码中的区间
 }
 
 // 下述定义了语句和表达式的结构
@@ -45,6 +46,9 @@ func (es *ExpressionStatement) String() string {
 	}
 	return ""
 }
+func (es *ExpressionStatement) Span() token.Span {
+	return join(es.Token.Span, spanOf(es.Expression))
+}
 
 // Program AST根节点
 type Program struct {
@@ -69,6 +73,15 @@ func (p *Program) String() string {
 	return out.String()
 }
 
+func (p *Program) Span() token.Span {
+	if len(p.Statements) == 0 {
+		return token.Span{}
+	}
+	first := p.Statements[0].Span()
+	last := p.Statements[len(p.Statements)-1].Span()
+	return join(first, last)
+}
+
 // Identifier 标识符号
 type Identifier struct {
 	Token token.Token // 词法单元
@@ -84,11 +97,16 @@ func (i *Identifier) String() string {
 	return i.Value
 }
 
+func (i *Identifier) Span() token.Span {
+	return i.Token.Span
+}
+
 // BlockStatement 块语句结构
 // 该结构表示一个语句块 包含多条语句
 type BlockStatement struct {
 	Token      token.Token // '{'词法单元
 	Statements []Statement
+	Rbrace     token.Token // '}'词法单元
 }
 
 func (bs *BlockStatement) statementNode() {}
@@ -103,3 +121,26 @@ func (bs *BlockStatement) String() string {
 	}
 	return out.String()
 }
+
+func (bs *BlockStatement) Span() token.Span {
+	return join(bs.Token.Span, bs.Rbrace.Span)
+}
+
+// 合并两个区间 得到从start起始到end结束的区间
+func join(start, end token.Span) token.Span {
+	if !end.IsValid() {
+		return start
+	}
+	if !start.IsValid() {
+		return end
+	}
+	return token.Span{Start: start.Start, End: end.End}
+}
+
+// 返回节点的区间 节点为空时返回空区间
+func spanOf(node Node) token.Span {
+	if node == nil {
+		return token.Span{}
+	}
+	return node.Span()
+}
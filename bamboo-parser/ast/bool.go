@@ -16,3 +16,6 @@ func (b *Boolean) TokenLiteral() string {
 func (b *Boolean) String() string {
 	return b.Token.Literal
 }
+func (b *Boolean) Span() token.Span {
+	return b.Token.Span
+}
@@ -0,0 +1,22 @@
+package ast
+
+import "bamboo/token"
+
+// 浮点数字面量
+// eg. 3.14 .5 1e-9
+
+type FloatLiteral struct {
+	Token token.Token
+	Value float64
+}
+
+func (fl *FloatLiteral) expressionNode() {}
+func (fl *FloatLiteral) TokenLiteral() string {
+	return fl.Token.Literal
+}
+func (fl *FloatLiteral) String() string {
+	return fl.Token.Literal
+}
+func (fl *FloatLiteral) Span() token.Span {
+	return fl.Token.Span
+}
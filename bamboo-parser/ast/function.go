@@ -13,11 +13,18 @@ import (
 参数列表: (<参数1>,<参数2>,<参数3>,...)
 eg. fn(x, y) { return x + y; }
 let func = fn(x, y) { return x + y; }
+
+参数可以带有默认值 带默认值的参数之后的参数也必须带默认值
+最后一个参数前加上...时 该参数收集多余的实参
+eg. fn(a, b = 2, ...rest) { }
 */
 
 type FunctionLiteral struct {
 	Token      token.Token     //'fn'词法单元
-	Parameters []*Identifier   // 参数列表
+	Name       string          // 函数名 由函数声明或let语句给出 匿名函数为空
+	Parameters []*Identifier   // 参数列表 包括剩余参数
+	Defaults   []Expression    // 各参数的默认值 与Parameters一一对应 没有默认值时为nil
+	Variadic   bool            // 最后一个参数是否为剩余参数
 	Body       *BlockStatement // 函数体 语句块
 }
 
@@ -28,19 +35,69 @@ func (fl *FunctionLiteral) TokenLiteral() string {
 func (fl *FunctionLiteral) String() string {
 	var out bytes.Buffer
 
-	var params []string
-	for _, p := range fl.Parameters {
-		params = append(params, p.String())
-	}
-
 	out.WriteString(fl.TokenLiteral())
 	out.WriteString("(")
-	out.WriteString(strings.Join(params, ", "))
+	out.WriteString(FormatParameters(fl.Parameters, fl.Defaults, fl.Variadic))
 	out.WriteString(") ")
 	out.WriteString(fl.Body.String())
 
 	return out.String()
 }
+func (fl *FunctionLiteral) Span() token.Span {
+	if fl.Body == nil {
+		return fl.Token.Span
+	}
+	return join(fl.Token.Span, fl.Body.Span())
+}
+
+// 函数声明
+/* 格式: func <函数名> <参数列表> <块语句>
+eg. func add(x, y) { return x + y; }
+函数声明会被提升: 函数名在所在语句块开始执行时就已绑定
+因此可以在声明之前调用函数 多个函数也可以相互递归
+*/
+
+type FunctionDeclaration struct {
+	Token    token.Token      // 'func'词法单元
+	Name     *Identifier      // 函数名
+	Function *FunctionLiteral // 函数字面量 其Name为函数名
+}
+
+func (fd *FunctionDeclaration) statementNode() {}
+func (fd *FunctionDeclaration) TokenLiteral() string {
+	return fd.Token.Literal
+}
+func (fd *FunctionDeclaration) String() string {
+	var out bytes.Buffer
+
+	out.WriteString(fd.TokenLiteral() + " ")
+	out.WriteString(fd.Name.String())
+	out.WriteString("(")
+	out.WriteString(FormatParameters(fd.Function.Parameters, fd.Function.Defaults, fd.Function.Variadic))
+	out.WriteString(") ")
+	out.WriteString(fd.Function.Body.String())
+
+	return out.String()
+}
+func (fd *FunctionDeclaration) Span() token.Span {
+	return join(fd.Token.Span, spanOf(fd.Function))
+}
+
+// FormatParameters 输出参数列表 eg. a, b = 2, ...rest
+func FormatParameters(params []*Identifier, defaults []Expression, variadic bool) string {
+	var out []string
+	for i, p := range params {
+		switch {
+		case variadic && i == len(params)-1:
+			out = append(out, "..."+p.String())
+		case i < len(defaults) && defaults[i] != nil:
+			out = append(out, p.String()+" = "+defaults[i].String())
+		default:
+			out = append(out, p.String())
+		}
+	}
+	return strings.Join(out, ", ")
+}
 
 // 调用表达式
 
@@ -54,6 +111,8 @@ type CallExpression struct {
 	Token     token.Token // '('词法单元
 	Function  Expression  // 标识符或函数字面量
 	Arguments []Expression
+	Rparen    token.Token // ')'词法单元
+	Tail      bool        // 是否处于尾部位置 即调用的结果直接作为所在函数的返回值
 }
 
 func (ce *CallExpression) expressionNode() {}
@@ -75,3 +134,26 @@ func (ce *CallExpression) String() string {
 
 	return out.String()
 }
+func (ce *CallExpression) Span() token.Span {
+	return join(spanOf(ce.Function), join(ce.Token.Span, ce.Rparen.Span))
+}
+
+// 展开实参: ...<表达式>
+// 只能出现在调用表达式的实参列表中 将可迭代对象的各个值依次作为实参
+// eg. add(...[1, 2]) 等同于 add(1, 2)
+
+type SpreadExpression struct {
+	Token token.Token // '...'词法单元
+	Value Expression  // 被展开的表达式
+}
+
+func (se *SpreadExpression) expressionNode() {}
+func (se *SpreadExpression) TokenLiteral() string {
+	return se.Token.Literal
+}
+func (se *SpreadExpression) String() string {
+	return "..." + se.Value.String()
+}
+func (se *SpreadExpression) Span() token.Span {
+	return join(se.Token.Span, spanOf(se.Value))
+}
@@ -12,8 +12,9 @@ import (
 // 字符串 整数 布尔值等任何表达式都可以用作索引运算符表达式索引
 
 type HashLiteral struct {
-	Token token.Token
-	Pairs map[Expression]Expression // 使用Go内置的map作为基础数据结构
+	Token  token.Token
+	Pairs  map[Expression]Expression // 使用Go内置的map作为基础数据结构
+	Rbrace token.Token               // '}'词法单元
 }
 
 func (hl *HashLiteral) expressionNode() {}
@@ -33,3 +34,6 @@ func (hl *HashLiteral) String() string {
 
 	return out.String()
 }
+func (hl *HashLiteral) Span() token.Span {
+	return join(hl.Token.Span, hl.Rbrace.Span)
+}
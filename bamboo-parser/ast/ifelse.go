@@ -41,3 +41,13 @@ func (ie *IfExpression) String() string {
 
 	return out.String()
 }
+
+func (ie *IfExpression) Span() token.Span {
+	if ie.Alternative != nil {
+		return join(ie.Token.Span, ie.Alternative.Span())
+	}
+	if ie.Consequence != nil {
+		return join(ie.Token.Span, ie.Consequence.Span())
+	}
+	return join(ie.Token.Span, spanOf(ie.Condition))
+}
@@ -7,10 +7,15 @@ import (
 
 // 索引运算: <表达式>[<表达式>]
 
+// 可选访问: <表达式>?[<表达式>] <表达式>?.<标识符>
+// 后者等同于以标识符的名称为键的索引运算 对象为null时不再求值索引 结果为null
+
 type IndexExpression struct {
-	Token token.Token
-	Left  Expression // 正在访问的对象
-	Index Expression // 产生一个整数的表达式
+	Token    token.Token // '['、'?['或'?.'词法单元
+	Left     Expression  // 正在访问的对象
+	Index    Expression  // 产生一个整数的表达式
+	Rbracket token.Token // ']'词法单元 '?.'之后为标识符
+	Optional bool        // 是否为可选访问
 }
 
 func (ie *IndexExpression) expressionNode() {}
@@ -22,9 +27,76 @@ func (ie *IndexExpression) String() string {
 
 	out.WriteString("(")
 	out.WriteString(ie.Left.String())
-	out.WriteString("[")
-	out.WriteString(ie.Index.String())
+	switch ie.Token.Type {
+	case token.QUESTION_DOT:
+		out.WriteString("?." + ie.Index.String() + ")")
+	case token.QUESTION_LBRACKET:
+		out.WriteString("?[" + ie.Index.String() + "])")
+	default:
+		out.WriteString("[" + ie.Index.String() + "])")
+	}
+
+	return out.String()
+}
+func (ie *IndexExpression) Span() token.Span {
+	return join(spanOf(ie.Left), join(ie.Token.Span, ie.Rbracket.Span))
+}
+
+// 可选链: 包含可选访问的一串索引和调用 eg. a?.b["c"](1)
+// 链中任何一处可选访问的对象为null时 跳过链的其余部分 整个链的值为null
+
+type OptionalChain struct {
+	Expression Expression
+}
+
+func (oc *OptionalChain) expressionNode() {}
+func (oc *OptionalChain) TokenLiteral() string {
+	return oc.Expression.TokenLiteral()
+}
+func (oc *OptionalChain) String() string {
+	return oc.Expression.String()
+}
+func (oc *OptionalChain) Span() token.Span {
+	return spanOf(oc.Expression)
+}
+
+// 切片: <表达式>[<起始>:<结束>:<步长>] 三部分都可以省略 eg. a[1:] a[:-1] a[::-1]
+// 省略的部分为nil
+
+type SliceExpression struct {
+	Token    token.Token // '['或'?['词法单元
+	Left     Expression  // 被切片的数组或字符串
+	Start    Expression
+	Stop     Expression
+	Step     Expression
+	Rbracket token.Token // ']'词法单元
+	Optional bool        // 是否为可选访问
+}
+
+func (se *SliceExpression) expressionNode() {}
+func (se *SliceExpression) TokenLiteral() string {
+	return se.Token.Literal
+}
+func (se *SliceExpression) String() string {
+	var out bytes.Buffer
+
+	part := func(e Expression) string {
+		if e == nil {
+			return ""
+		}
+		return e.String()
+	}
+	out.WriteString("(")
+	out.WriteString(se.Left.String())
+	out.WriteString(se.Token.Literal)
+	out.WriteString(part(se.Start) + ":" + part(se.Stop))
+	if se.Step != nil {
+		out.WriteString(":" + se.Step.String())
+	}
 	out.WriteString("])")
 
 	return out.String()
 }
+func (se *SliceExpression) Span() token.Span {
+	return join(spanOf(se.Left), join(se.Token.Span, se.Rbracket.Span))
+}
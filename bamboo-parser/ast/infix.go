@@ -30,3 +30,6 @@ func (ie *InfixExpression) String() string {
 
 	return out.String()
 }
+func (ie *InfixExpression) Span() token.Span {
+	return join(spanOf(ie.Left), join(ie.Token.Span, spanOf(ie.Right)))
+}
@@ -1,13 +1,17 @@
 package ast
 
-import "bamboo/token"
+import (
+	"bamboo/token"
+	"math/big"
+)
 
 // 整数字面量
-// 产生的值是整数本身
+// 产生的值是整数本身 超出int64范围时保存在Big中
 
 type IntegerLiteral struct {
 	Token token.Token
 	Value int64
+	Big   *big.Int
 }
 
 func (i *IntegerLiteral) expressionNode() {}
@@ -17,3 +21,6 @@ func (i *IntegerLiteral) TokenLiteral() string {
 func (i *IntegerLiteral) String() string {
 	return i.Token.Literal
 }
+func (i *IntegerLiteral) Span() token.Span {
+	return i.Token.Span
+}
@@ -11,15 +11,23 @@ import (
 // let x = 5 * 5
 // let y = add(2,2)*5/10
 // 定义3个字段: 关联词法单元 指向标志符号 指向等号右侧表达式
+// const语句使用相同的结构 声明的变量不能再被赋值
+// eg. const PI = 3.14
 
 // LetStatement let语句结构
 type LetStatement struct {
-	Token token.Token // LET词法单元
+	Token token.Token // LET或CONST词法单元
 	Name  *Identifier // 变量名
 	Value Expression  // 等号右侧表达式
 }
 
 func (ls *LetStatement) statementNode() {}
+
+// IsConst 判断是否为const语句
+func (ls *LetStatement) IsConst() bool {
+	return ls.Token.Type == token.CONST
+}
+
 func (ls *LetStatement) TokenLiteral() string {
 	return ls.Token.Literal
 }
@@ -38,3 +46,7 @@ func (ls *LetStatement) String() string {
 
 	return out.String()
 }
+
+func (ls *LetStatement) Span() token.Span {
+	return join(ls.Token.Span, spanOf(ls.Value))
+}
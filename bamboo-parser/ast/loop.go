@@ -26,3 +26,83 @@ func (we *WhileExpression) String() string {
 
 	return out.String()
 }
+func (we *WhileExpression) Span() token.Span {
+	if we.Body == nil {
+		return join(we.Token.Span, spanOf(we.Condition))
+	}
+	return join(we.Token.Span, we.Body.Span())
+}
+
+// 遍历结构: for (value in iterable) { expression }
+// 同时取出键和值: for (key, value in iterable) { expression }
+// 数组 字符串和区间的键为元素的序号 哈希表的键为哈希表的键
+
+type ForExpression struct {
+	Token    token.Token     // 'for' 词法单元
+	Key      *Identifier     // 绑定键的标识符 可以为nil
+	Value    *Identifier     // 绑定值的标识符
+	Iterable Expression      // 被遍历的表达式
+	Body     *BlockStatement // 循环体
+}
+
+func (fe *ForExpression) expressionNode() {}
+func (fe *ForExpression) TokenLiteral() string {
+	return fe.Token.Literal
+}
+func (fe *ForExpression) String() string {
+	var out bytes.Buffer
+
+	out.WriteString("for (")
+	if fe.Key != nil {
+		out.WriteString(fe.Key.String() + ", ")
+	}
+	out.WriteString(fe.Value.String())
+	out.WriteString(" in ")
+	out.WriteString(fe.Iterable.String())
+	out.WriteString(")")
+	out.WriteString(fe.Body.String())
+
+	return out.String()
+}
+func (fe *ForExpression) Span() token.Span {
+	if fe.Body == nil {
+		return join(fe.Token.Span, spanOf(fe.Iterable))
+	}
+	return join(fe.Token.Span, fe.Body.Span())
+}
+
+// 跳出循环: break
+// 只能出现在循环体中 结束最内层的循环
+
+type BreakStatement struct {
+	Token token.Token // 'break' 词法单元
+}
+
+func (bs *BreakStatement) statementNode() {}
+func (bs *BreakStatement) TokenLiteral() string {
+	return bs.Token.Literal
+}
+func (bs *BreakStatement) String() string {
+	return bs.Token.Literal + ";"
+}
+func (bs *BreakStatement) Span() token.Span {
+	return bs.Token.Span
+}
+
+// 继续循环: continue
+// 只能出现在循环体中 跳过本次循环余下的语句 进入最内层循环的下一次迭代
+
+type ContinueStatement struct {
+	Token token.Token // 'continue' 词法单元
+}
+
+func (cs *ContinueStatement) statementNode() {}
+func (cs *ContinueStatement) TokenLiteral() string {
+	return cs.Token.Literal
+}
+func (cs *ContinueStatement) String() string {
+	return cs.Token.Literal + ";"
+}
+func (cs *ContinueStatement) Span() token.Span {
+	return cs.Token.Span
+}
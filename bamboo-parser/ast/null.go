@@ -0,0 +1,20 @@
+package ast
+
+import "bamboo/token"
+
+// 空值字面量
+
+type NullLiteral struct {
+	Token token.Token
+}
+
+func (n *NullLiteral) expressionNode() {}
+func (n *NullLiteral) TokenLiteral() string {
+	return n.Token.Literal
+}
+func (n *NullLiteral) String() string {
+	return n.Token.Literal
+}
+func (n *NullLiteral) Span() token.Span {
+	return n.Token.Span
+}
@@ -31,3 +31,7 @@ func (pe *PrefixExpression) String() string {
 
 	return out.String()
 }
+
+func (pe *PrefixExpression) Span() token.Span {
+	return join(pe.Token.Span, spanOf(pe.Right))
+}
@@ -30,3 +30,7 @@ func (rs *ReturnStatement) String() string {
 	out.WriteString(";")
 	return out.String()
 }
+
+func (rs *ReturnStatement) Span() token.Span {
+	return join(rs.Token.Span, spanOf(rs.ReturnValue))
+}
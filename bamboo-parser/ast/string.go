@@ -17,3 +17,6 @@ func (sl *StringLiteral) TokenLiteral() string {
 func (sl *StringLiteral) String() string {
 	return sl.Token.Literal
 }
+func (sl *StringLiteral) Span() token.Span {
+	return sl.Token.Span
+}
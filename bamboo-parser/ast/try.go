@@ -0,0 +1,93 @@
+package ast
+
+import (
+	"bamboo/token"
+	"bytes"
+)
+
+// 异常处理
+/* try表达式
+格式: try <语句块> catch (<标识符>) <语句块> finally <语句块>
+catch和finally至少出现一个 catch后的标识符可以省略
+eg. try { risky() } catch (e) { print(e["message"]) } finally { cleanup() }
+try语句块中产生的错误被捕获后绑定到标识符 再执行catch语句块
+无论是否出错 finally语句块总会执行
+*/
+
+type TryExpression struct {
+	Token   token.Token     // try词法单元
+	Block   *BlockStatement // 可能出错的语句块
+	Param   *Identifier     // 绑定捕获的错误 可以为空
+	Catch   *BlockStatement // 可以为空
+	Finally *BlockStatement // 可以为空
+}
+
+func (te *TryExpression) expressionNode() {}
+
+func (te *TryExpression) TokenLiteral() string {
+	return te.Token.Literal
+}
+
+func (te *TryExpression) String() string {
+	var out bytes.Buffer
+
+	out.WriteString("try ")
+	out.WriteString(te.Block.String())
+
+	if te.Catch != nil {
+		out.WriteString("catch ")
+		if te.Param != nil {
+			out.WriteString("(" + te.Param.String() + ") ")
+		}
+		out.WriteString(te.Catch.String())
+	}
+	if te.Finally != nil {
+		out.WriteString("finally ")
+		out.WriteString(te.Finally.String())
+	}
+
+	return out.String()
+}
+
+func (te *TryExpression) Span() token.Span {
+	switch {
+	case te.Finally != nil:
+		return join(te.Token.Span, te.Finally.Span())
+	case te.Catch != nil:
+		return join(te.Token.Span, te.Catch.Span())
+	case te.Block != nil:
+		return join(te.Token.Span, te.Block.Span())
+	}
+	return te.Token.Span
+}
+
+// throw语句
+// 格式: throw <表达式>
+// 抛出一个错误 由外层的try表达式捕获
+
+type ThrowStatement struct {
+	Token token.Token // throw词法单元
+	Value Expression  // 抛出的值
+}
+
+func (ts *ThrowStatement) statementNode() {}
+
+func (ts *ThrowStatement) TokenLiteral() string {
+	return ts.Token.Literal
+}
+
+func (ts *ThrowStatement) String() string {
+	var out bytes.Buffer
+
+	out.WriteString(ts.TokenLiteral() + " ")
+	if ts.Value != nil {
+		out.WriteString(ts.Value.String())
+	}
+	out.WriteString(";")
+
+	return out.String()
+}
+
+func (ts *ThrowStatement) Span() token.Span {
+	return join(ts.Token.Span, spanOf(ts.Value))
+}
@@ -1,13 +1,17 @@
 package command
 
 import (
+	"bamboo/ast"
+	"bamboo/diagnostic"
 	"bamboo/evaluator"
 	"bamboo/lexer"
 	"bamboo/object"
 	"bamboo/parser"
+	"bamboo/token"
 	"bufio"
 	"fmt"
 	"io"
+	"strings"
 )
 
 const PROMPT = ">> "
@@ -29,48 +33,135 @@ func Start(in io.Reader, out io.Writer, flag bool) {
 			program := p.ParseProgram()
 
 			if len(p.Errors()) != 0 {
-				PrintParserErrors(out, p.Errors())
+				PrintDiagnostics(out, line, p.Errors())
 				continue
 			}
 
-			evaluated := evaluator.Eval(program, env)
-			if evaluated != nil {
-				output := evaluated.Inspect()
-				if output == "NULL" {
-					output = ""
-				}
-				io.WriteString(out, output)
-				io.WriteString(out, "\n")
-			}
+			evaluated := safeEval(program, env)
+			PrintResult(out, line, evaluated)
 		}
 	} else {
-		code := ""
-		for scanner.Scan() {
-			code += scanner.Text()
+		StartFile("", in, out)
+	}
+}
+
+// 求值程序 将求值过程中的Go panic转换为内部错误 避免REPL退出
+func safeEval(program *ast.Program, env *object.Environment) (evaluated object.Object) {
+	defer func() {
+		if r := recover(); r != nil {
+			evaluated = evaluator.NewError(evaluator.ErrInternal, "internal error: %v", r)
 		}
-		lex := lexer.New(code)
-		p := parser.New(lex)
-		program := p.ParseProgram()
+	}()
+	return evaluator.Eval(program, env)
+}
+
+// StartFile 执行整个源文件 filename用于在错误信息中标明位置
+func StartFile(filename string, in io.Reader, out io.Writer) {
+	env := object.NewEnvironment()
 
-		if len(p.Errors()) != 0 {
-			PrintParserErrors(out, p.Errors())
+	// 完整读入源代码 保留换行以便记录行号
+	code, err := io.ReadAll(in)
+	if err != nil {
+		fmt.Fprintln(out, err)
+		return
+	}
+	source := string(code)
+	lex := lexer.NewFile(filename, source)
+	p := parser.New(lex)
+	program := p.ParseProgram()
+
+	if len(p.Errors()) != 0 {
+		PrintDiagnostics(out, source, p.Errors())
+		return
+	}
+
+	evaluated := evaluator.Eval(program, env)
+	PrintResult(out, source, evaluated)
+}
+
+// PrintResult 输出求值结果 运行时错误以诊断的形式输出
+func PrintResult(out io.Writer, source string, evaluated object.Object) {
+	if evaluated == nil {
+		return
+	}
+	if err, ok := evaluated.(*object.Error); ok {
+		PrintTraceback(out, source, err)
+		PrintDiagnostics(out, source, []*diagnostic.Diagnostic{err.Diagnostic()})
+		return
+	}
+	output := evaluated.Inspect()
+	if output == "NULL" {
+		output = ""
+	}
+	io.WriteString(out, output)
+	io.WriteString(out, "\n")
+}
+
+// PrintDiagnostics 输出诊断 并附带出错位置的源代码片段
+func PrintDiagnostics(out io.Writer, source string, diagnostics []*diagnostic.Diagnostic) {
+	for _, d := range diagnostics {
+		diagnostic.Render(out, source, d)
+	}
+}
+
+// PrintTraceback 输出运行时错误的调用栈 最近的调用在最后
+// 格式如下:
+//
+//	Traceback (most recent call last):
+//	  test.bam:12:1, in <main>
+//	    print(sum(array))
+//	  test.bam:6:17, in sum
+//	    let s = s + nums[i];
+func PrintTraceback(out io.Writer, source string, err *object.Error) {
+	if len(err.Trace) == 0 {
+		return
+	}
+	lines := strings.Split(source, "\n")
+	fmt.Fprintln(out, "Traceback (most recent call last):")
+
+	// 每一帧的位置位于调用者中 最外层的调用者为顶层代码
+	var last string
+	repeated := 0
+	caller := "<main>"
+	for i := len(err.Trace) - 1; i >= 0; i-- {
+		frame := err.Trace[i]
+		entry := ""
+		if frame.Caller != "" {
+			// 尾调用不保留调用栈帧 中间的调用已被省略
+			entry = "  [earlier tail calls omitted]\n"
+			caller = frame.Caller
 		}
+		entry += traceEntry(lines, frame.Span, caller)
+		caller = frame.Function
 
-		evaluated := evaluator.Eval(program, env)
-		if evaluated != nil {
-			output := evaluated.Inspect()
-			if output == "NULL" {
-				output = ""
+		// 连续重复的帧(如递归调用)只输出前几次
+		if entry == last {
+			repeated++
+			if repeated >= 3 {
+				continue
 			}
-			io.WriteString(out, output)
-			io.WriteString(out, "\n")
+		} else {
+			printRepeated(out, repeated)
+			repeated = 0
 		}
+		last = entry
+		io.WriteString(out, entry)
+	}
+	printRepeated(out, repeated)
+	io.WriteString(out, traceEntry(lines, err.Span, caller))
+}
+
+// 格式化调用栈中的一帧
+func traceEntry(lines []string, span token.Span, function string) string {
+	entry := fmt.Sprintf("  %s, in %s\n", span, function)
+	if line := span.Start.Line; line > 0 && line <= len(lines) {
+		entry += "    " + strings.TrimSpace(lines[line-1]) + "\n"
 	}
+	return entry
 }
 
-func PrintParserErrors(out io.Writer, errors []string) {
-	io.WriteString(out, "parser errors: ")
-	for _, msg := range errors {
-		io.WriteString(out, "\t"+msg+"\n")
+func printRepeated(out io.Writer, repeated int) {
+	if repeated > 2 {
+		fmt.Fprintf(out, "  [previous frame repeated %d more times]\n", repeated-2)
 	}
 }
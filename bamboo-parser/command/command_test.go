@@ -0,0 +1,119 @@
+package command
+
+import (
+	"bamboo/evaluator"
+	"bamboo/lexer"
+	"bamboo/object"
+	"bamboo/parser"
+	"strings"
+	"testing"
+)
+
+func testTraceback(t *testing.T, input string) string {
+	t.Helper()
+	p := parser.New(lexer.New(input))
+	program := p.ParseProgram()
+	if errs := p.Errors(); len(errs) != 0 {
+		t.Fatalf("parser errors for %q: %v", input, errs[0].Message)
+	}
+	err, ok := evaluator.Eval(program, object.NewEnvironment()).(*object.Error)
+	if !ok {
+		t.Fatalf("expected error for %q", input)
+	}
+	var out strings.Builder
+	PrintTraceback(&out, input, err)
+	return out.String()
+}
+
+// 调用栈中每一行的位置和所在函数
+func traceLocations(traceback string) []string {
+	var locations []string
+	for _, line := range strings.Split(traceback, "\n") {
+		if strings.HasPrefix(line, "  ") && !strings.HasPrefix(line, "    ") {
+			locations = append(locations, strings.TrimSpace(line))
+		}
+	}
+	return locations
+}
+
+func TestPrintTraceback(t *testing.T) {
+	tests := []struct {
+		input string
+		want  []string
+	}{
+		{
+			"let f = func(x) { x / 0 };\nlet g = func(x) { let y = f(x); y };\ng(1);",
+			[]string{"3:1, in <main>", "2:27, in g", "1:19, in f"},
+		},
+		{
+			// 尾调用的帧位于发起尾调用的函数中
+			`let f = func(x){ let g = func(y){ y / 0 }; g(x) }; func outer(){ f(1) } outer()`,
+			[]string{"1:73, in <main>", "[earlier tail calls omitted]", "1:44, in f", "1:35, in g"},
+		},
+		{
+			`func outer() { inner(1) } func inner(x) { x / 0 } outer();`,
+			[]string{"1:51, in <main>", "1:16, in outer", "1:43, in inner"},
+		},
+		{
+			// 递归的尾调用
+			`func loop(n) { if (n == 0) { 1 / 0 } else { loop(n - 1) } } loop(3);`,
+			[]string{"1:61, in <main>", "[earlier tail calls omitted]", "1:45, in loop", "1:30, in loop"},
+		},
+		{
+			`func rec(n) { if (n == 0) { 1 / 0 } rec(n - 1) + 1 } rec(5);`,
+			[]string{"1:54, in <main>", "1:37, in rec", "1:37, in rec", "1:37, in rec", "[previous frame repeated 2 more times]", "1:29, in rec"},
+		},
+	}
+
+	for _, tt := range tests {
+		got := traceLocations(testTraceback(t, tt.input))
+		if len(got) != len(tt.want) {
+			t.Errorf("%q: wrong traceback.\ngot=%q\nwant=%q", tt.input, got, tt.want)
+			continue
+		}
+		for i, want := range tt.want {
+			if !strings.HasSuffix(got[i], want) {
+				t.Errorf("%q: wrong traceback line %d. got=%q, want suffix %q", tt.input, i, got[i], want)
+			}
+		}
+	}
+}
+
+// REPL逐行解析 同一作用域中的重复声明在运行时报告
+func TestREPLRedeclaration(t *testing.T) {
+	tests := []struct {
+		line string
+		want string // 该行输出中应包含的内容
+	}{
+		{"let x = 1", ""},
+		{"let x = 2", "R0017"},
+		{"x", "1"},
+		{"const c = 1", ""},
+		{"let c = 2", "R0013"},
+		{"func f() { 1 }", ""},
+		{"func f() { 2 }", "R0017"},
+		{"f()", "1"},
+		{"if (true) { let x = 5; x }", "5"},
+	}
+
+	var lines []string
+	for _, tt := range tests {
+		lines = append(lines, tt.line)
+	}
+	var out strings.Builder
+	Start(strings.NewReader(strings.Join(lines, "\n")+"\n"), &out, true)
+
+	// 每行的输出位于两个提示符之间
+	outputs := strings.Split(out.String(), PROMPT)[1:]
+	if len(outputs) != len(tests)+1 {
+		t.Fatalf("wrong number of prompts. got=%d, want=%d\n%s", len(outputs), len(tests)+1, out.String())
+	}
+	for i, tt := range tests {
+		if tt.want == "" && outputs[i] != "" {
+			t.Errorf("%q: unexpected output %q", tt.line, outputs[i])
+		}
+		if !strings.Contains(outputs[i], tt.want) {
+			t.Errorf("%q: output %q does not contain %q", tt.line, outputs[i], tt.want)
+		}
+	}
+}
@@ -0,0 +1,101 @@
+package diagnostic
+
+import (
+	"bamboo/token"
+	"fmt"
+)
+
+// 诊断信息是解释器报告问题的统一形式
+// 词法分析 语法分析和求值阶段产生的错误都以Diagnostic表示
+// 每条诊断包含严重程度 错误代码 错误信息 出错区间 以及可选的相关说明和修改建议
+// 结构体可以直接序列化为JSON 供编辑器等工具使用
+
+// Severity 诊断的严重程度
+type Severity int
+
+const (
+	Error Severity = iota
+	Warning
+	Note
+)
+
+func (s Severity) String() string {
+	switch s {
+	case Error:
+		return "error"
+	case Warning:
+		return "warning"
+	case Note:
+		return "note"
+	default:
+		return fmt.Sprintf("severity(%d)", int(s))
+	}
+}
+
+// MarshalText 序列化时输出严重程度的名称
+func (s Severity) MarshalText() ([]byte, error) {
+	return []byte(s.String()), nil
+}
+
+// Related 相关说明 指向与诊断有关的另一处源代码
+type Related struct {
+	Span    token.Span `json:"span"`
+	Message string     `json:"message"`
+}
+
+// Fix 修改建议 用Replacement替换Span处的源代码
+// Span的起止位置相同时表示插入
+type Fix struct {
+	Message     string     `json:"message"`
+	Span        token.Span `json:"span"`
+	Replacement string     `json:"replacement"`
+}
+
+// Diagnostic 一条诊断信息
+type Diagnostic struct {
+	Severity Severity   `json:"severity"`
+	Code     string     `json:"code"` // 错误代码 用于过滤和归类
+	Message  string     `json:"message"`
+	Span     token.Span `json:"span"` // 出错的区间
+	Related  []Related  `json:"related,omitempty"`
+	Fix      *Fix       `json:"fix,omitempty"`
+}
+
+// New 创建一条错误级别的诊断
+func New(code string, span token.Span, format string, a ...interface{}) *Diagnostic {
+	return &Diagnostic{
+		Severity: Error,
+		Code:     code,
+		Message:  fmt.Sprintf(format, a...),
+		Span:     span,
+	}
+}
+
+// WithRelated 为诊断添加一条相关说明
+func (d *Diagnostic) WithRelated(span token.Span, format string, a ...interface{}) *Diagnostic {
+	d.Related = append(d.Related, Related{Span: span, Message: fmt.Sprintf(format, a...)})
+	return d
+}
+
+// WithFix 为诊断设置修改建议
+func (d *Diagnostic) WithFix(span token.Span, replacement string, format string, a ...interface{}) *Diagnostic {
+	d.Fix = &Fix{Message: fmt.Sprintf(format, a...), Span: span, Replacement: replacement}
+	return d
+}
+
+// Error 以file:line:col: error[code]: message的形式输出诊断
+// 使Diagnostic满足error接口
+func (d *Diagnostic) Error() string {
+	header := d.Severity.String()
+	if d.Code != "" {
+		header += "[" + d.Code + "]"
+	}
+	if d.Span.IsValid() {
+		return d.Span.String() + ": " + header + ": " + d.Message
+	}
+	return header + ": " + d.Message
+}
+
+func (d *Diagnostic) String() string {
+	return d.Error()
+}
@@ -0,0 +1,137 @@
+package diagnostic
+
+import (
+	"bamboo/token"
+	"encoding/json"
+	"strings"
+	"testing"
+)
+
+func span(line, column, endColumn int) token.Span {
+	return token.Span{
+		Start: token.Position{Filename: "t.bam", Line: line, Column: column},
+		End:   token.Position{Filename: "t.bam", Line: line, Column: endColumn},
+	}
+}
+
+func TestError(t *testing.T) {
+	d := New("P0001", span(1, 15, 16), "expected next token to be %s, got %s instead", ")", ";")
+	if got, want := d.Error(), "t.bam:1:15: error[P0001]: expected next token to be ), got ; instead"; got != want {
+		t.Errorf("wrong error string. got=%q, want=%q", got, want)
+	}
+
+	d = &Diagnostic{Severity: Warning, Message: "unused"}
+	if got, want := d.Error(), "warning: unused"; got != want {
+		t.Errorf("wrong error string without code or span. got=%q, want=%q", got, want)
+	}
+}
+
+func TestRender(t *testing.T) {
+	tests := []struct {
+		name     string
+		source   string
+		d        *Diagnostic
+		expected string
+	}{
+		{
+			"single character",
+			"let x = (1 + 2;",
+			New("P0001", span(1, 15, 16), "expected next token to be ), got ; instead").
+				WithFix(span(1, 15, 15), ")", "insert the missing delimiter"),
+			`error[P0001]: expected next token to be ), got ; instead
+ --> t.bam:1:15
+  |
+1 | let x = (1 + 2;
+  |               ^
+help: insert the missing delimiter: ` + "`)`" + `
+`,
+		},
+		{
+			"related note",
+			"let a = 1;\nlet a = 2;",
+			New("P0005", span(2, 5, 6), "`a` is already declared in this scope").
+				WithRelated(span(1, 5, 6), "`a` first declared here"),
+			"error[P0005]: `a` is already declared in this scope\n" +
+				" --> t.bam:2:5\n  |\n2 | let a = 2;\n  |     ^\n" +
+				"note: `a` first declared here\n" +
+				" --> t.bam:1:5\n  |\n1 | let a = 1;\n  |     ^\n",
+		},
+		{
+			// 宽字符占两列 制表符保持原样
+			"wide characters and tabs",
+			"\tlet 名字 = 1 + \"x\";",
+			New("R0001", span(1, 11, 18), "type mismatch: INTEGER + STRING"),
+			"error[R0001]: type mismatch: INTEGER + STRING\n" +
+				" --> t.bam:1:11\n  |\n1 | \tlet 名字 = 1 + \"x\";\n  | \t           ^^^^^^^\n",
+		},
+		{
+			"multi-digit line number",
+			strings.Repeat("\n", 11) + "1 / 0",
+			New("R0011", span(12, 1, 6), "division by zero"),
+			"error[R0011]: division by zero\n" +
+				"  --> t.bam:12:1\n   |\n12 | 1 / 0\n   | ^^^^^\n",
+		},
+		{
+			"no span",
+			"",
+			New("R0015", token.Span{}, "maximum recursion depth exceeded"),
+			"error[R0015]: maximum recursion depth exceeded\n",
+		},
+	}
+
+	for _, tt := range tests {
+		var out strings.Builder
+		Render(&out, tt.source, tt.d)
+		if out.String() != tt.expected {
+			t.Errorf("%s: wrong rendering.\ngot:\n%s\nwant:\n%s", tt.name, out.String(), tt.expected)
+		}
+	}
+}
+
+func TestUnderline(t *testing.T) {
+	tests := []struct {
+		line     string
+		span     token.Span
+		expected string
+	}{
+		{"abc", span(1, 2, 3), " ^"},
+		{"abc", span(1, 1, 4), "^^^"},
+		// 结束位置缺失时只标出一个字符
+		{"abc", token.Span{Start: token.Position{Line: 1, Column: 2}}, " ^"},
+		// 跨行的区间标记到行尾
+		{"abcdef", token.Span{Start: token.Position{Line: 1, Column: 3}, End: token.Position{Line: 2, Column: 1}}, "  ^^^^"},
+		// 位于行尾之后的位置 如缺失的闭合符号
+		{"ab", span(1, 3, 3), "  ^"},
+		{"漢字x", span(1, 2, 4), "  ^^^"},
+	}
+
+	for _, tt := range tests {
+		if got := underline(tt.line, tt.span); got != tt.expected {
+			t.Errorf("underline(%q, %s): got=%q, want=%q", tt.line, tt.span, got, tt.expected)
+		}
+	}
+}
+
+// 诊断可以序列化为JSON 供编辑器等工具使用
+func TestMarshalJSON(t *testing.T) {
+	d := New("P0007", span(2, 1, 2), "cannot assign to constant c").
+		WithRelated(span(1, 7, 8), "`c` declared as constant here")
+	data, err := json.Marshal(d)
+	if err != nil {
+		t.Fatalf("marshal failed: %s", err)
+	}
+
+	var decoded map[string]interface{}
+	if err := json.Unmarshal(data, &decoded); err != nil {
+		t.Fatalf("unmarshal failed: %s", err)
+	}
+	if decoded["severity"] != "error" || decoded["code"] != "P0007" || decoded["message"] != "cannot assign to constant c" {
+		t.Errorf("wrong fields: %s", data)
+	}
+	if related, ok := decoded["related"].([]interface{}); !ok || len(related) != 1 {
+		t.Errorf("wrong related notes: %s", data)
+	}
+	if _, ok := decoded["fix"]; ok {
+		t.Errorf("fix should be omitted when absent: %s", data)
+	}
+}
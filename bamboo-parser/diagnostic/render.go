@@ -0,0 +1,115 @@
+package diagnostic
+
+import (
+	"bamboo/token"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+)
+
+// Render 输出诊断 并附带用^标出出错区间的源代码片段
+// 格式如下:
+//
+//	error[P0001]: expected next token to be ), got ; instead
+//	 --> test.bam:1:15
+//	  |
+//	1 | let x = (1 + 2;
+//	  |               ^
+func Render(out io.Writer, source string, d *Diagnostic) {
+	lines := strings.Split(source, "\n")
+
+	header := d.Severity.String()
+	if d.Code != "" {
+		header += "[" + d.Code + "]"
+	}
+	fmt.Fprintf(out, "%s: %s\n", header, d.Message)
+	renderExcerpt(out, lines, d.Span)
+
+	for _, related := range d.Related {
+		fmt.Fprintf(out, "%s: %s\n", Note, related.Message)
+		renderExcerpt(out, lines, related.Span)
+	}
+	if d.Fix != nil {
+		if d.Fix.Replacement != "" {
+			fmt.Fprintf(out, "help: %s: `%s`\n", d.Fix.Message, d.Fix.Replacement)
+		} else {
+			fmt.Fprintf(out, "help: %s\n", d.Fix.Message)
+		}
+	}
+}
+
+// 输出区间所在的源代码行 并在其下方标出区间
+func renderExcerpt(out io.Writer, lines []string, span token.Span) {
+	if !span.IsValid() {
+		return
+	}
+	start := span.Start
+	number := strconv.Itoa(start.Line)
+	gutter := strings.Repeat(" ", len(number))
+
+	fmt.Fprintf(out, "%s--> %s\n", gutter, start)
+	if start.Line > len(lines) {
+		return
+	}
+	line := strings.TrimRight(lines[start.Line-1], "\r")
+
+	fmt.Fprintf(out, "%s |\n", gutter)
+	fmt.Fprintf(out, "%s | %s\n", number, line)
+	fmt.Fprintf(out, "%s | %s\n", gutter, underline(line, span))
+}
+
+// 生成标记区间的下划线 跨行的区间标记到行尾
+// 列号按字符计数 中日韩文字等宽字符在终端中占两列 对应两个空格或^
+func underline(line string, span token.Span) string {
+	chars := []rune(line)
+	col := span.Start.Column - 1
+	if col > len(chars) {
+		col = len(chars)
+	}
+
+	end := col + 1
+	if span.End.Line == span.Start.Line && span.End.Column > span.Start.Column {
+		end = span.End.Column - 1
+	} else if span.End.Line > span.Start.Line && len(chars) > col {
+		end = len(chars)
+	}
+
+	// 保留行首的制表符 使^与源代码对齐
+	var pad strings.Builder
+	for _, ch := range chars[:col] {
+		if ch == '\t' {
+			pad.WriteByte('\t')
+		} else {
+			pad.WriteString(strings.Repeat(" ", runeWidth(ch)))
+		}
+	}
+
+	width := 0
+	for i := col; i < end; i++ {
+		if i < len(chars) {
+			width += runeWidth(chars[i])
+		} else {
+			width++
+		}
+	}
+	return pad.String() + strings.Repeat("^", width)
+}
+
+// 返回字符在终端中占据的列数 只区分常见的宽字符
+func runeWidth(ch rune) int {
+	switch {
+	case ch >= 0x1100 && ch <= 0x115F, // 朝鲜文字母
+		ch >= 0x2E80 && ch <= 0xA4CF && ch != 0x303F, // 中日韩部首 标点 假名 汉字
+		ch >= 0xAC00 && ch <= 0xD7A3,                 // 朝鲜文音节
+		ch >= 0xF900 && ch <= 0xFAFF,                 // 中日韩兼容汉字
+		ch >= 0xFE30 && ch <= 0xFE4F,                 // 中日韩兼容形式
+		ch >= 0xFF00 && ch <= 0xFF60,                 // 全角字符
+		ch >= 0xFFE0 && ch <= 0xFFE6,
+		ch >= 0x1F300 && ch <= 0x1F64F, // 表情符号
+		ch >= 0x1F900 && ch <= 0x1F9FF,
+		ch >= 0x20000 && ch <= 0x3FFFD: // 扩展汉字
+		return 2
+	}
+	return 1
+}
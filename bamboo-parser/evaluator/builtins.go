@@ -3,7 +3,12 @@ package evaluator
 import (
 	"bamboo/object"
 	"fmt"
+	"math"
+	"math/big"
 	"os"
+	"strconv"
+	"strings"
+	"unicode/utf8"
 )
 
 // 建立内置函数映射表
@@ -11,43 +16,261 @@ var builtins = map[string]*object.Builtin{
 	"type": &object.Builtin{
 		Fn: func(args ...object.Object) object.Object {
 			if len(args) != 1 {
-				return newError("wrong number of arguments. got=%d, want=1", len(args))
+				return newError(ErrArgumentCount, "wrong number of arguments. got=%d, want=1", len(args))
 			}
 
-			switch args[0].(type) {
-			case *object.String:
+			// 按Type()判断 字节码虚拟机中的闭包同样是Function
+			switch args[0].Type() {
+			case object.STRING_OBJ:
 				return &object.String{Value: "String"}
-			case *object.Array:
+			case object.ARRAY_OBJ:
 				return &object.String{Value: "Array"}
-			case *object.Integer:
+			case object.INTEGER_OBJ, object.BIGINT_OBJ:
 				return &object.String{Value: "Integer"}
-			case *object.Function:
+			case object.FLOAT_OBJ:
+				return &object.String{Value: "Float"}
+			case object.RANGE_OBJ:
+				return &object.String{Value: "Range"}
+			case object.FUNCTION_OBJ:
 				return &object.String{Value: "Function"}
-			case *object.Boolean:
+			case object.BOOLEAN_OBJ:
 				return &object.String{Value: "Boolean"}
-			case *object.Hash:
+			case object.HASH_OBJ:
 				return &object.String{Value: "HashMap"}
+			case object.EXCEPTION_OBJ:
+				return &object.String{Value: "Error"}
+			case object.NULL_OBJ:
+				return &object.String{Value: "Null"}
 			default:
-				return newError("argument to `len` not supported, got %s", args[0].Type())
+				return newError(ErrArgumentType, "argument to `len` not supported, got %s", args[0].Type())
 			}
 		},
 	},
 	"len": &object.Builtin{
 		Fn: func(args ...object.Object) object.Object {
 			if len(args) != 1 {
-				return newError("wrong number of arguments. got=%d, want=1", len(args))
+				return newError(ErrArgumentCount, "wrong number of arguments. got=%d, want=1", len(args))
 			}
 
 			switch arg := args[0].(type) {
 			case *object.String:
-				return &object.Integer{Value: int64(len(arg.Value))}
+				// 按字符计数 字节数见bytes
+				return &object.Integer{Value: int64(utf8.RuneCountInString(arg.Value))}
 			case *object.Array:
 				return &object.Integer{Value: int64(len(arg.Elements))}
 			default:
-				return newError("argument to `len` not supported, got %s", args[0].Type())
+				return newError(ErrArgumentType, "argument to `len` not supported, got %s", args[0].Type())
+			}
+		},
+	},
+	"bytes": &object.Builtin{
+		Fn: func(args ...object.Object) object.Object {
+			if len(args) != 1 {
+				return newError(ErrArgumentCount, "wrong number of arguments. got=%d, want=1", len(args))
+			}
+
+			// 返回字符串UTF-8编码的各个字节
+			str, ok := args[0].(*object.String)
+			if !ok {
+				return newError(ErrArgumentType, "argument to `bytes` must be STRING, got %s", args[0].Type())
+			}
+			elements := make([]object.Object, len(str.Value))
+			for i := 0; i < len(str.Value); i++ {
+				elements[i] = &object.Integer{Value: int64(str.Value[i])}
+			}
+			return &object.Array{Elements: elements}
+		},
+	},
+	"float": &object.Builtin{
+		Fn: func(args ...object.Object) object.Object {
+			if len(args) != 1 {
+				return newError(ErrArgumentCount, "wrong number of arguments. got=%d, want=1", len(args))
+			}
+
+			switch arg := args[0].(type) {
+			case *object.Float:
+				return arg
+			case *object.Integer, *object.BigInt:
+				return &object.Float{Value: toFloat(arg)}
+			case *object.String:
+				value, err := strconv.ParseFloat(strings.TrimSpace(arg.Value), 64)
+				if err != nil {
+					return newError(ErrInvalidValue, "could not convert %q to float", arg.Value)
+				}
+				return &object.Float{Value: value}
+			default:
+				return newError(ErrArgumentType, "argument to `float` not supported, got %s", args[0].Type())
+			}
+		},
+	},
+	"int": &object.Builtin{
+		Fn: func(args ...object.Object) object.Object {
+			if len(args) != 1 {
+				return newError(ErrArgumentCount, "wrong number of arguments. got=%d, want=1", len(args))
+			}
+
+			switch arg := args[0].(type) {
+			case *object.Integer, *object.BigInt:
+				return arg
+			case *object.Float:
+				if math.IsNaN(arg.Value) || math.IsInf(arg.Value, 0) {
+					return newError(ErrInvalidValue, "could not convert %s to integer", arg.Inspect())
+				}
+				// 向零取整
+				value, _ := big.NewFloat(arg.Value).Int(nil)
+				return normalizeBig(value)
+			case *object.String:
+				value, ok := new(big.Int).SetString(strings.TrimSpace(arg.Value), 10)
+				if !ok {
+					return newError(ErrInvalidValue, "could not convert %q to integer", arg.Value)
+				}
+				return normalizeBig(value)
+			default:
+				return newError(ErrArgumentType, "argument to `int` not supported, got %s", args[0].Type())
 			}
 		},
 	},
+	"range": &object.Builtin{
+		Fn: func(args ...object.Object) object.Object {
+			if len(args) < 1 || len(args) > 3 {
+				return newError(ErrArgumentCount, "wrong number of arguments. got=%d, want=1 to 3", len(args))
+			}
+
+			bounds := make([]int64, len(args))
+			for i, arg := range args {
+				integer, ok := arg.(*object.Integer)
+				if !ok {
+					return newError(ErrArgumentType, "argument to `range` must be INTEGER, got %s", arg.Type())
+				}
+				bounds[i] = integer.Value
+			}
+
+			// range(stop) range(start, stop) range(start, stop, step)
+			r := &object.Range{Step: 1}
+			switch len(bounds) {
+			case 1:
+				r.Stop = bounds[0]
+			case 2:
+				r.Start, r.Stop = bounds[0], bounds[1]
+			case 3:
+				r.Start, r.Stop, r.Step = bounds[0], bounds[1], bounds[2]
+			}
+			if r.Step == 0 {
+				return newError(ErrInvalidValue, "range step must not be zero")
+			}
+			return r
+		},
+	},
+	"push": &object.Builtin{
+		Fn: func(args ...object.Object) object.Object {
+			if len(args) < 2 {
+				return newError(ErrArgumentCount, "wrong number of arguments. got=%d, want at least 2", len(args))
+			}
+
+			// 在数组末尾追加元素 返回被修改的数组
+			arr, ok := args[0].(*object.Array)
+			if !ok {
+				return newError(ErrArgumentType, "argument to `push` must be ARRAY, got %s", args[0].Type())
+			}
+			arr.Elements = append(arr.Elements, args[1:]...)
+			return arr
+		},
+	},
+	"pop": &object.Builtin{
+		Fn: func(args ...object.Object) object.Object {
+			if len(args) != 1 {
+				return newError(ErrArgumentCount, "wrong number of arguments. got=%d, want=1", len(args))
+			}
+
+			// 移除并返回数组的最后一个元素
+			arr, ok := args[0].(*object.Array)
+			if !ok {
+				return newError(ErrArgumentType, "argument to `pop` must be ARRAY, got %s", args[0].Type())
+			}
+			if len(arr.Elements) == 0 {
+				return newError(ErrIndexOutOfRange, "pop from empty array")
+			}
+			last := arr.Elements[len(arr.Elements)-1]
+			arr.Elements = arr.Elements[:len(arr.Elements)-1]
+			return last
+		},
+	},
+	"insert": &object.Builtin{
+		Fn: func(args ...object.Object) object.Object {
+			if len(args) != 3 {
+				return newError(ErrArgumentCount, "wrong number of arguments. got=%d, want=3", len(args))
+			}
+
+			// 在下标为index的元素之前插入元素 index为数组长度时追加到末尾 返回被修改的数组
+			arr, ok := args[0].(*object.Array)
+			if !ok {
+				return newError(ErrArgumentType, "first argument to `insert` must be ARRAY, got %s", args[0].Type())
+			}
+			index, ok := args[1].(*object.Integer)
+			if !ok {
+				return newError(ErrArgumentType, "second argument to `insert` must be INTEGER, got %s", args[1].Type())
+			}
+			// 负数索引从末尾开始计数 -1表示插入到最后一个元素之前
+			idx := index.Value
+			if idx < 0 {
+				idx += int64(len(arr.Elements))
+			}
+			if idx < 0 || idx > int64(len(arr.Elements)) {
+				return newError(ErrIndexOutOfRange, "insert index out of range: %d (length %d)", index.Value, len(arr.Elements))
+			}
+			arr.Elements = append(arr.Elements, nil)
+			copy(arr.Elements[idx+1:], arr.Elements[idx:])
+			arr.Elements[idx] = args[2]
+			return arr
+		},
+	},
+	"remove": &object.Builtin{
+		Fn: func(args ...object.Object) object.Object {
+			if len(args) != 2 {
+				return newError(ErrArgumentCount, "wrong number of arguments. got=%d, want=2", len(args))
+			}
+
+			// 移除并返回下标为index的元素
+			arr, ok := args[0].(*object.Array)
+			if !ok {
+				return newError(ErrArgumentType, "first argument to `remove` must be ARRAY, got %s", args[0].Type())
+			}
+			index, ok := args[1].(*object.Integer)
+			if !ok {
+				return newError(ErrArgumentType, "second argument to `remove` must be INTEGER, got %s", args[1].Type())
+			}
+			idx, ok := normalizeIndex(index.Value, len(arr.Elements))
+			if !ok {
+				return newError(ErrIndexOutOfRange, "remove index out of range: %d (length %d)", index.Value, len(arr.Elements))
+			}
+			removed := arr.Elements[idx]
+			arr.Elements = append(arr.Elements[:idx], arr.Elements[idx+1:]...)
+			return removed
+		},
+	},
+	"delete": &object.Builtin{
+		Fn: func(args ...object.Object) object.Object {
+			if len(args) != 2 {
+				return newError(ErrArgumentCount, "wrong number of arguments. got=%d, want=2", len(args))
+			}
+
+			// 删除哈希表中的键 返回被删除的值 键不存在时返回NULL
+			hash, ok := args[0].(*object.Hash)
+			if !ok {
+				return newError(ErrArgumentType, "first argument to `delete` must be HASH, got %s", args[0].Type())
+			}
+			key, ok := args[1].(object.Hashable)
+			if !ok {
+				return newError(ErrUnhashable, "unusable as hash key: %s", args[1].Type())
+			}
+			pair, ok := hash.Pairs[key.HashKey()]
+			if !ok {
+				return NULL
+			}
+			delete(hash.Pairs, key.HashKey())
+			return pair.Value
+		},
+	},
 	"print": &object.Builtin{
 		Fn: func(args ...object.Object) object.Object {
 			for _, arg := range args {
@@ -57,16 +280,37 @@ var builtins = map[string]*object.Builtin{
 			return NULL
 		},
 	},
+	"recursionlimit": &object.Builtin{
+		Fn: func(args ...object.Object) object.Object {
+			if len(args) > 1 {
+				return newError(ErrArgumentCount, "wrong number of arguments. got=%d, want=1 or 0", len(args))
+			}
+
+			// 返回原来的限制 传入参数时设置新的限制
+			limit := &object.Integer{Value: int64(MaxDepth)}
+			if len(args) == 1 {
+				integer, ok := args[0].(*object.Integer)
+				if !ok {
+					return newError(ErrArgumentType, "argument to `recursionlimit` must be INTEGER, got %s", args[0].Type())
+				}
+				if integer.Value < 1 || integer.Value > maxRecursionLimit {
+					return newError(ErrInvalidValue, "recursion limit out of range: %d", integer.Value)
+				}
+				MaxDepth = int(integer.Value)
+			}
+			return limit
+		},
+	},
 	"exit": &object.Builtin{
 		Fn: func(args ...object.Object) object.Object {
 			if len(args) > 1 {
-				return newError("wrong number of arguments. got=%d, want=1 or 0", len(args))
+				return newError(ErrArgumentCount, "wrong number of arguments. got=%d, want=1 or 0", len(args))
 			} else if len(args) == 1 {
 				switch arg := args[0].(type) {
 				case *object.Integer:
 					os.Exit(int(arg.Value))
 				default:
-					return newError("argument to `exit` not supported, got %s", args[0].Type())
+					return newError(ErrArgumentType, "argument to `exit` not supported, got %s", args[0].Type())
 				}
 
 			} else {
@@ -0,0 +1,50 @@
+package evaluator
+
+// 运行时错误代码
+const (
+	ErrTypeMismatch      = "R0001" // 运算符两侧类型不匹配
+	ErrUnknownOperator   = "R0002" // 不支持的运算符
+	ErrUnknownIdentifier = "R0003" // 未定义的标识符
+	ErrNotFunction       = "R0004" // 调用的对象不是函数
+	ErrIndexUnsupported  = "R0005" // 不支持索引运算的对象
+	ErrUnhashable        = "R0006" // 不能作为哈希表键的对象
+	ErrArgumentCount     = "R0007" // 参数个数错误
+	ErrArgumentType      = "R0008" // 参数类型错误
+	ErrThrown            = "R0009" // 未被捕获的throw
+	ErrInvalidValue      = "R0010" // 参数类型正确但取值无效
+	ErrDivisionByZero    = "R0011" // 除以零
+	ErrInternal          = "R0012" // 解释器内部错误
+	ErrConstAssign       = "R0013" // 对常量赋值或重新声明常量
+	ErrNotIterable       = "R0014" // for-in遍历的对象不可迭代
+	ErrRecursion         = "R0015" // 函数调用的嵌套深度超过限制
+	ErrIndexOutOfRange   = "R0016" // 修改数组时索引越界
+	ErrRedeclared        = "R0017" // 在同一作用域中重复声明变量
+)
+
+// 错误代码对应的错误类别 try表达式捕获错误后可以据此区分
+var errorKinds = map[string]string{
+	ErrTypeMismatch:      "TypeError",
+	ErrUnknownOperator:   "TypeError",
+	ErrUnknownIdentifier: "NameError",
+	ErrNotFunction:       "TypeError",
+	ErrIndexUnsupported:  "TypeError",
+	ErrUnhashable:        "TypeError",
+	ErrArgumentCount:     "ArgumentError",
+	ErrArgumentType:      "TypeError",
+	ErrInvalidValue:      "ValueError",
+	ErrDivisionByZero:    "ZeroDivisionError",
+	ErrInternal:          "InternalError",
+	ErrConstAssign:       "TypeError",
+	ErrNotIterable:       "TypeError",
+	ErrRecursion:         "RecursionError",
+	ErrIndexOutOfRange:   "IndexError",
+	ErrRedeclared:        "NameError",
+}
+
+// 返回错误代码对应的错误类别
+func errorKind(code string) string {
+	if kind, ok := errorKinds[code]; ok {
+		return kind
+	}
+	return "Error"
+}
@@ -3,7 +3,11 @@ package evaluator
 import (
 	"bamboo/ast"
 	"bamboo/object"
+	"bamboo/token"
 	"fmt"
+	"math"
+	"math/big"
+	"strings"
 )
 
 // 下面要实现的是对表达式求值
@@ -14,12 +18,31 @@ var (
 	NULL  = &object.Null{}
 	TRUE  = &object.Boolean{Value: true}
 	FALSE = &object.Boolean{Value: false}
+
+	BREAK    = &object.Break{}
+	CONTINUE = &object.Continue{}
+
+	// 可选访问的对象为null时产生 跳过可选链的其余部分 由OptionalChain转换为NULL
+	skipChain object.Object = &chainSkip{}
 )
 
+// 空结构体的指针可能相等 使用单独的类型与NULL区分
+type chainSkip struct{ object.Null }
+
 // Eval 对AST进行求值
 // 对于不同类型的节点 将调用不同的求值函数
 // 对逐个语句递归调用该函数
 func Eval(node ast.Node, env *object.Environment) object.Object {
+	result := eval(node, env)
+
+	// 尚未记录位置的错误 由产生它的最内层节点标记位置
+	if err, ok := result.(*object.Error); ok && !err.Span.IsValid() {
+		err.Span = node.Span()
+	}
+	return result
+}
+
+func eval(node ast.Node, env *object.Environment) object.Object {
 	switch node := node.(type) {
 	case *ast.Program:
 		return evalProgram(node, env)
@@ -31,81 +54,148 @@ func Eval(node ast.Node, env *object.Environment) object.Object {
 	// 对赋值语句求值
 	case *ast.LetStatement:
 		val := Eval(node.Value, env)
-		if isError(val) {
+		if interrupts(val) {
 			return val
 		}
-		env.Set(node.Name.Value, val)
+		// REPL中逐行解析 同一作用域中的重复声明只能在运行时检查
+		if err := declare(env, node.Name, val, node.IsConst()); err != nil {
+			return err
+		}
 	// 对返回语句求值
 	case *ast.ReturnStatement:
 		val := Eval(node.ReturnValue, env)
-		if isError(val) {
+		if interrupts(val) {
 			return val
 		}
 		return &object.ReturnValue{Value: val}
+	case *ast.BreakStatement:
+		return BREAK
+	case *ast.ContinueStatement:
+		return CONTINUE
 	// 对整数字面量求值 返回整数本身
 	case *ast.IntegerLiteral:
+		if node.Big != nil {
+			return &object.BigInt{Value: node.Big}
+		}
 		return &object.Integer{Value: node.Value}
+	case *ast.FloatLiteral:
+		return &object.Float{Value: node.Value}
 	case *ast.Boolean:
 		return nativeBoolToBooleanObject(node.Value)
+	case *ast.NullLiteral:
+		return NULL
 	case *ast.Identifier:
 		return evalIdentifier(node, env)
 	case *ast.FunctionLiteral:
 		params := node.Parameters
 		body := node.Body
-		return &object.Function{Parameters: params, Env: env, Body: body}
+		return &object.Function{Name: node.Name, Parameters: params, Defaults: node.Defaults, Variadic: node.Variadic, Env: env, Body: body}
+	// 函数声明已在所在语句块开始执行时提升
+	case *ast.FunctionDeclaration:
+		return nil
 	// 求值前缀表达式
 	case *ast.PrefixExpression:
 		right := Eval(node.Right, env)
-		if isError(right) {
+		if interrupts(right) {
 			return right
 		}
 		return evalPrefixExpression(node.Operator, right)
 	// 求值中缀表达式
 	case *ast.InfixExpression:
+		if node.Operator == "&&" || node.Operator == "||" {
+			return evalLogicalExpression(node, env)
+		}
+		if node.Operator == "??" {
+			return evalNullishExpression(node, env)
+		}
 		left := Eval(node.Left, env)
-		if isError(left) {
+		if interrupts(left) {
 			return left
 		}
 		right := Eval(node.Right, env)
-		if isError(right) {
+		if interrupts(right) {
 			return right
 		}
 		return evalInfixExpression(node.Operator, left, right)
 	// 求值调用表达式
 	case *ast.CallExpression:
 		function := Eval(node.Function, env)
-		if isError(function) {
+		if interrupts(function) || function == skipChain {
 			return function
 		}
-		args := evalExpression(node.Arguments, env)
-		if len(args) == 1 && isError(args[0]) {
+		args := evalArguments(node.Arguments, env)
+		if len(args) == 1 && interrupts(args[0]) {
 			return args[0]
 		}
-		return applyFunction(function, args)
+		name := displayName(function, calleeName(node))
+		if _, ok := function.(*object.Function); ok && node.Tail {
+			return &object.TailCall{Function: function, Args: args, Name: name, Span: node.Span()}
+		}
+		// 参数个数错误或嵌套过深时函数尚未开始执行 调用栈中不记录这一层调用
+		if fn, ok := function.(*object.Function); ok {
+			if err := checkCall(name, fn, len(args)); err != nil {
+				return err
+			}
+		}
+		result := applyFunction(function, args)
+
+		// 错误从函数中传出 记录这一层调用
+		if err, ok := result.(*object.Error); ok {
+			if _, ok := function.(*object.Function); ok {
+				frame := object.Frame{Function: name, Span: node.Span()}
+				err.Trace = append(err.Trace, frame)
+			}
+		}
+		return result
 	// IF表达式
 	case *ast.IfExpression:
 		return evalIfExpression(node, env)
 	case *ast.WhileExpression:
 		return evalWhileExpression(node, env)
+	case *ast.ForExpression:
+		return evalForExpression(node, env)
+	case *ast.AssignExpression:
+		return evalAssignExpression(node, env)
+	case *ast.IndexAssignExpression:
+		return evalIndexAssignExpression(node, env)
+	case *ast.TryExpression:
+		return evalTryExpression(node, env)
+	case *ast.ThrowStatement:
+		val := Eval(node.Value, env)
+		if interrupts(val) {
+			return val
+		}
+		return newThrownError(val)
 	// 对字符串求值
 	case *ast.StringLiteral:
 		return &object.String{Value: node.Value}
 	case *ast.ArrayLiteral:
 		elements := evalExpression(node.Elements, env)
-		if len(elements) == 1 && isError(elements[0]) {
+		if len(elements) == 1 && interrupts(elements[0]) {
 			return elements[0]
 		}
 		return &object.Array{Elements: elements}
 	case *ast.IndexExpression:
 		left := Eval(node.Left, env)
-		if isError(left) {
+		if interrupts(left) || left == skipChain {
 			return left
 		}
+		if node.Optional && left == NULL {
+			return skipChain
+		}
 		index := Eval(node.Index, env)
-		if isError(index) {
+		if interrupts(index) {
 			return index
 		}
 		return evalIndexExpression(left, index)
+	case *ast.SliceExpression:
+		return evalSliceExpression(node, env)
+	case *ast.OptionalChain:
+		result := Eval(node.Expression, env)
+		if result == skipChain {
+			return NULL
+		}
+		return result
 	case *ast.HashLiteral:
 		return evalHashLiteral(node, env)
 	}
@@ -124,7 +214,7 @@ func evalExpression(exps []ast.Expression, env *object.Environment) []object.Obj
 
 	for _, e := range exps {
 		evaluated := Eval(e, env)
-		if isError(evaluated) {
+		if interrupts(evaluated) {
 			return []object.Object{evaluated}
 		}
 		result = append(result, evaluated)
@@ -132,6 +222,35 @@ func evalExpression(exps []ast.Expression, env *object.Environment) []object.Obj
 	return result
 }
 
+// 对调用表达式的实参求值 展开实参中的可迭代对象
+func evalArguments(exps []ast.Expression, env *object.Environment) []object.Object {
+	var result []object.Object
+
+	for _, e := range exps {
+		se, ok := e.(*ast.SpreadExpression)
+		if !ok {
+			evaluated := Eval(e, env)
+			if interrupts(evaluated) {
+				return []object.Object{evaluated}
+			}
+			result = append(result, evaluated)
+			continue
+		}
+
+		evaluated := Eval(se.Value, env)
+		if interrupts(evaluated) {
+			return []object.Object{evaluated}
+		}
+		values := spread(evaluated)
+		if err, ok := values.(*object.Error); ok {
+			err.Span = se.Span()
+			return []object.Object{err}
+		}
+		result = append(result, values.(*object.Array).Elements...)
+	}
+	return result
+}
+
 // 前缀表达式即一元运算符表达式 由一个运算符加一个操作数组成
 func evalPrefixExpression(operator string, right object.Object) object.Object {
 	switch operator {
@@ -139,8 +258,10 @@ func evalPrefixExpression(operator string, right object.Object) object.Object {
 		return evalBangOperatorExpression(right)
 	case "-":
 		return evalMinusPrefixOperatorExpression(right)
+	case "~":
+		return evalBitNotOperatorExpression(right)
 	default:
-		return newError("unknown operator: %s%s", operator, right.Type())
+		return newError(ErrUnknownOperator, "unknown operator: %s%s", operator, right.Type())
 	}
 }
 
@@ -158,13 +279,61 @@ func evalBangOperatorExpression(right object.Object) object.Object {
 	}
 }
 
-// 取负运算 取整数的相反数
+// 取负运算 取数字的相反数
 func evalMinusPrefixOperatorExpression(right object.Object) object.Object {
-	if right.Type() != object.INTEGER_OBJ {
-		return newError("unknown operator: -%s", right.Type())
+	switch right := right.(type) {
+	case *object.Integer:
+		if right.Value == math.MinInt64 {
+			return normalizeBig(new(big.Int).Neg(toBig(right)))
+		}
+		return &object.Integer{Value: -right.Value}
+	case *object.BigInt:
+		return normalizeBig(new(big.Int).Neg(right.Value))
+	case *object.Float:
+		return &object.Float{Value: -right.Value}
+	default:
+		return newError(ErrUnknownOperator, "unknown operator: -%s", right.Type())
+	}
+}
+
+// 按位取反运算
+func evalBitNotOperatorExpression(right object.Object) object.Object {
+	switch right := right.(type) {
+	case *object.Integer:
+		return &object.Integer{Value: ^right.Value}
+	case *object.BigInt:
+		return normalizeBig(new(big.Int).Not(right.Value))
+	default:
+		return newError(ErrUnknownOperator, "unknown operator: ~%s", right.Type())
+	}
+}
+
+// 计算逻辑运算 短路求值 右操作数只在需要时求值 结果为布尔值
+func evalLogicalExpression(node *ast.InfixExpression, env *object.Environment) object.Object {
+	left := Eval(node.Left, env)
+	if interrupts(left) {
+		return left
+	}
+	if node.Operator == "&&" && !isTruthy(left) {
+		return FALSE
+	}
+	if node.Operator == "||" && isTruthy(left) {
+		return TRUE
+	}
+	right := Eval(node.Right, env)
+	if interrupts(right) {
+		return right
 	}
-	value := right.(*object.Integer).Value
-	return &object.Integer{Value: -value}
+	return nativeBoolToBooleanObject(isTruthy(right))
+}
+
+// 计算空值合并运算 左操作数为NULL时才对右操作数求值
+func evalNullishExpression(node *ast.InfixExpression, env *object.Environment) object.Object {
+	left := Eval(node.Left, env)
+	if left != NULL {
+		return left
+	}
+	return Eval(node.Right, env)
 }
 
 // 计算中缀表达式
@@ -172,19 +341,24 @@ func evalInfixExpression(operator string, left, right object.Object) object.Obje
 	switch {
 	case left.Type() == object.INTEGER_OBJ && right.Type() == object.INTEGER_OBJ:
 		return evalIntegerInfixExpression(operator, left, right)
+	case isInteger(left) && isInteger(right):
+		return evalBigIntInfixExpression(operator, left, right)
+	// 整数与浮点数混合运算时 整数提升为浮点数
+	case isNumber(left) && isNumber(right):
+		return evalFloatInfixExpression(operator, left, right)
 	case operator == "==":
 		return nativeBoolToBooleanObject(left == right)
 	case operator == "!=":
 		return nativeBoolToBooleanObject(left != right)
 	// 类型不匹配 返回错误信息
 	case left.Type() != right.Type():
-		return newError("type mismatch: %s %s %s",
+		return newError(ErrTypeMismatch, "type mismatch: %s %s %s",
 			left.Type(), operator, right.Type())
 	case left.Type() == object.STRING_OBJ && right.Type() == object.STRING_OBJ:
 		return evalStringInfixExpression(operator, left, right)
 	default:
 		// 未知操作符 返回错误信息
-		return newError("unknown operator: %s %s %s",
+		return newError(ErrUnknownOperator, "unknown operator: %s %s %s",
 			left.Type(), operator, right.Type())
 	}
 }
@@ -196,39 +370,134 @@ func evalIntegerInfixExpression(operator string, left, right object.Object) obje
 
 	switch operator {
 	case "+":
-		return &object.Integer{Value: leftVal + rightVal}
+		if value, ok := addInt(leftVal, rightVal); ok {
+			return &object.Integer{Value: value}
+		}
+		return evalBigIntInfixExpression(operator, left, right)
 	case "-":
-		return &object.Integer{Value: leftVal - rightVal}
+		if value, ok := subInt(leftVal, rightVal); ok {
+			return &object.Integer{Value: value}
+		}
+		return evalBigIntInfixExpression(operator, left, right)
 	case "*":
-		return &object.Integer{Value: leftVal * rightVal}
+		if value, ok := mulInt(leftVal, rightVal); ok {
+			return &object.Integer{Value: value}
+		}
+		return evalBigIntInfixExpression(operator, left, right)
 	case "/":
+		if rightVal == 0 {
+			return newError(ErrDivisionByZero, "division by zero")
+		}
+		// MinInt64 / -1 的结果超出int64范围
+		if leftVal == math.MinInt64 && rightVal == -1 {
+			return evalBigIntInfixExpression(operator, left, right)
+		}
 		return &object.Integer{Value: leftVal / rightVal}
+	case "%":
+		if rightVal == 0 {
+			return newError(ErrDivisionByZero, "division by zero")
+		}
+		return &object.Integer{Value: leftVal % rightVal}
 	case "<":
 		return nativeBoolToBooleanObject(leftVal < rightVal)
 	case ">":
 		return nativeBoolToBooleanObject(leftVal > rightVal)
+	case "<=":
+		return nativeBoolToBooleanObject(leftVal <= rightVal)
+	case ">=":
+		return nativeBoolToBooleanObject(leftVal >= rightVal)
+	case "&":
+		return &object.Integer{Value: leftVal & rightVal}
+	case "|":
+		return &object.Integer{Value: leftVal | rightVal}
+	case "^":
+		return &object.Integer{Value: leftVal ^ rightVal}
+	case "<<", ">>":
+		return evalShiftExpression(operator, left, right)
 	case "==":
 		return nativeBoolToBooleanObject(leftVal == rightVal)
 	case "!=":
 		return nativeBoolToBooleanObject(leftVal != rightVal)
 	default:
-		return newError("unknown operator: %s %s %s",
+		return newError(ErrUnknownOperator, "unknown operator: %s %s %s",
 			left.Type(), operator, right.Type())
 	}
 }
 
+// 计算浮点数中缀表达式
+func evalFloatInfixExpression(operator string, left, right object.Object) object.Object {
+	leftVal := toFloat(left)
+	rightVal := toFloat(right)
+
+	switch operator {
+	case "+":
+		return &object.Float{Value: leftVal + rightVal}
+	case "-":
+		return &object.Float{Value: leftVal - rightVal}
+	case "*":
+		return &object.Float{Value: leftVal * rightVal}
+	case "/", "%":
+		// 与整数相同 除以零时报错 而不是得到Inf或NaN
+		if rightVal == 0 {
+			return newError(ErrDivisionByZero, "division by zero")
+		}
+		if operator == "/" {
+			return &object.Float{Value: leftVal / rightVal}
+		}
+		return &object.Float{Value: math.Mod(leftVal, rightVal)}
+	case "<":
+		return nativeBoolToBooleanObject(leftVal < rightVal)
+	case ">":
+		return nativeBoolToBooleanObject(leftVal > rightVal)
+	case "<=":
+		return nativeBoolToBooleanObject(leftVal <= rightVal)
+	case ">=":
+		return nativeBoolToBooleanObject(leftVal >= rightVal)
+	case "==":
+		return nativeBoolToBooleanObject(leftVal == rightVal)
+	case "!=":
+		return nativeBoolToBooleanObject(leftVal != rightVal)
+	default:
+		return newError(ErrUnknownOperator, "unknown operator: %s %s %s",
+			left.Type(), operator, right.Type())
+	}
+}
+
+// 判断对象是否为数字
+func isNumber(obj object.Object) bool {
+	switch obj.(type) {
+	case *object.Integer, *object.BigInt, *object.Float:
+		return true
+	}
+	return false
+}
+
+// 将数字转换为浮点数
+func toFloat(obj object.Object) float64 {
+	switch obj := obj.(type) {
+	case *object.Integer:
+		return float64(obj.Value)
+	case *object.BigInt:
+		value, _ := new(big.Float).SetInt(obj.Value).Float64()
+		return value
+	case *object.Float:
+		return obj.Value
+	}
+	return 0
+}
+
 // 对if语句进行求值
 func evalIfExpression(ie *ast.IfExpression, env *object.Environment) object.Object {
 	condition := Eval(ie.Condition, env)
 
-	if isError(condition) {
+	if interrupts(condition) {
 		return condition
 	}
 
 	if isTruthy(condition) {
-		return Eval(ie.Consequence, env)
+		return Eval(ie.Consequence, object.NewEnclosedEnvironment(env))
 	} else if ie.Alternative != nil {
-		return Eval(ie.Alternative, env)
+		return Eval(ie.Alternative, object.NewEnclosedEnvironment(env))
 	} else {
 		return NULL
 	}
@@ -248,6 +517,9 @@ func isTruthy(obj object.Object) bool {
 }
 
 func evalProgram(program *ast.Program, env *object.Environment) object.Object {
+	if err := hoistFunctions(program.Statements, env); err != nil {
+		return err
+	}
 	var result object.Object
 
 	for _, statement := range program.Statements {
@@ -265,21 +537,34 @@ func evalProgram(program *ast.Program, env *object.Environment) object.Object {
 
 // 对块语句进行求值
 func evalBlockStatement(block *ast.BlockStatement, env *object.Environment) object.Object {
+	if err := hoistFunctions(block.Statements, env); err != nil {
+		return err
+	}
 	var result object.Object
 
 	for _, statement := range block.Statements {
 		result = Eval(statement, env)
 
-		if result != nil {
-			rt := result.Type()
-			if rt == object.RETURN_VALUE_OBJ || rt == object.ERROR_OBJ {
-				return result
-			}
+		if interrupts(result) {
+			return result
 		}
 	}
 	return result
 }
 
+// 判断求值结果是否中断所在语句块的执行
+// 返回值 错误 break和continue都会逐层传出语句块
+func interrupts(obj object.Object) bool {
+	if obj == nil {
+		return false
+	}
+	switch obj.Type() {
+	case object.RETURN_VALUE_OBJ, object.ERROR_OBJ, object.BREAK_OBJ, object.CONTINUE_OBJ:
+		return true
+	}
+	return false
+}
+
 func evalIdentifier(node *ast.Identifier, env *object.Environment) object.Object {
 	// 检查当前环境中是否某个特定的名称 是否有与其关联的值
 	if val, ok := env.Get(node.Value); ok {
@@ -288,37 +573,217 @@ func evalIdentifier(node *ast.Identifier, env *object.Environment) object.Object
 	if builtin, ok := builtins[node.Value]; ok {
 		return builtin
 	}
-	return newError("identifier not found: " + node.Value)
+	return newError(ErrUnknownIdentifier, "identifier not found: %s", node.Value)
 }
 
+// MaxDepth 函数调用的最大嵌套深度 尾调用不计入深度
+// 字节码虚拟机使用同一限制 可以通过内置函数recursionlimit修改
+var MaxDepth = 10000
+
+// maxRecursionLimit recursionlimit允许设置的最大深度
+// Go的栈溢出无法恢复 实测简单递归约10万层 嵌套较深的函数体约3万层就会崩溃
+const maxRecursionLimit = 20000
+
+// 当前函数调用的嵌套深度
+var depth int
+
 // 应用函数
+// 函数体以尾调用结束时 在循环中执行被调用的函数 而不是递归调用applyFunction
 func applyFunction(fn object.Object, args []object.Object) object.Object {
 	switch fn := fn.(type) {
 	case *object.Function:
-		extendedEnv := extendFunctionEnv(fn, args)
-		evaluated := Eval(fn.Body, extendedEnv)
-		return unwrapReturnValue(evaluated)
+		depth++
+		defer func() { depth-- }()
+
+		var tail *object.Frame // 最近一次尾调用 出错时记录到调用栈中
+		for {
+			extendedEnv, err := extendFunctionEnv(fn, args)
+			if err != nil {
+				return traceTailCall(err, tail)
+			}
+			result := unwrapReturnValue(Eval(fn.Body, extendedEnv))
+			call, ok := result.(*object.TailCall)
+			if !ok {
+				return traceTailCall(result, tail)
+			}
+			fn, args = call.Function.(*object.Function), call.Args
+			if err := checkArity(call.Name, fn, len(args)); err != nil {
+				err.Span = call.Span
+				return traceTailCall(err, tail)
+			}
+			tail = tailFrame(tail, call.Name, call.Span)
+		}
 	case *object.Builtin:
 		return fn.Fn(args...)
 	default:
-		return newError("not a function: %s", fn.Type())
+		return newError(ErrNotFunction, "not a function: %s", fn.Type())
+	}
+}
+
+// 尾调用复用了调用者的调用栈层 只保留最近一次尾调用
+// 之前还有尾调用时 最近一次尾调用位于前一次尾调用的函数中 记录其名称
+func tailFrame(prev *object.Frame, name string, span token.Span) *object.Frame {
+	frame := &object.Frame{Function: name, Span: span}
+	if prev != nil {
+		frame.Caller = prev.Function
+	}
+	return frame
+}
+
+// 错误从尾调用的函数中传出时记录最近一次尾调用
+func traceTailCall(result object.Object, tail *object.Frame) object.Object {
+	if err, ok := result.(*object.Error); ok && tail != nil {
+		err.Trace = append(err.Trace, *tail)
+	}
+	return result
+}
+
+// 返回调用表达式中被调用函数的名称
+func calleeName(call *ast.CallExpression) string {
+	return functionName(call.Function)
+}
+
+// 返回表达式所表示的函数的名称 用于调用栈
+func functionName(expr ast.Expression) string {
+	if ident, ok := expr.(*ast.Identifier); ok {
+		return ident.Value
 	}
+	return "<anonymous>"
+}
+
+// 返回错误信息和调用栈中使用的函数名称
+// 具名函数使用自身的名称 否则使用调用处的名称
+func displayName(fn object.Object, name string) string {
+	if fn, ok := fn.(*object.Function); ok && fn.Name != "" {
+		return fn.Name
+	}
+	return name
+}
+
+// 提升语句块中的函数声明 在执行其他语句之前绑定函数名
+func hoistFunctions(statements []ast.Statement, env *object.Environment) *object.Error {
+	for _, statement := range statements {
+		decl, ok := statement.(*ast.FunctionDeclaration)
+		if !ok {
+			continue
+		}
+		if err := declare(env, decl.Name, Eval(decl.Function, env), false); err != nil {
+			err.Span = decl.Name.Span()
+			return err
+		}
+	}
+	return nil
+}
+
+// 在当前环境中声明变量 变量已在当前环境中声明时返回错误
+func declare(env *object.Environment, name *ast.Identifier, val object.Object, constant bool) *object.Error {
+	switch env.Declare(name.Value, val, constant) {
+	case object.ErrConstant:
+		return newError(ErrConstAssign, "cannot redeclare constant %s", name.Value)
+	case object.ErrRedeclared:
+		return newError(ErrRedeclared, "identifier already declared: %s", name.Value)
+	}
+	return nil
 }
 
 // 扩展环境
-func extendFunctionEnv(fn *object.Function, args []object.Object) *object.Environment {
+// 将函数的实参与环境绑定
+// 先绑定传入的实参 多余的实参收集到剩余参数中 缺少的参数暂时为NULL
+// 再依次计算缺少的参数的默认值 默认值可以引用其他参数
+func extendFunctionEnv(fn *object.Function, args []object.Object) (*object.Environment, *object.Error) {
 	env := object.NewEnclosedEnvironment(fn.Env)
 
-	for paramIdx, param := range fn.Parameters {
-		env.Set(param.Value, args[paramIdx]) // 将函数的实参与环境绑定
+	params := fn.Parameters
+	if fn.Variadic {
+		params = params[:len(params)-1]
+		rest := []object.Object{}
+		if len(args) > len(params) {
+			rest = append(rest, args[len(params):]...)
+		}
+		env.Set(fn.Parameters[len(params)].Value, &object.Array{Elements: rest})
+	}
+
+	for paramIdx, param := range params {
+		if paramIdx < len(args) {
+			env.Set(param.Value, args[paramIdx])
+		} else {
+			env.Set(param.Value, NULL)
+		}
+	}
+
+	for paramIdx := len(args); paramIdx < len(params); paramIdx++ {
+		if paramIdx >= len(fn.Defaults) || fn.Defaults[paramIdx] == nil {
+			continue
+		}
+		value := Eval(fn.Defaults[paramIdx], env)
+		if err, ok := value.(*object.Error); ok {
+			return nil, err
+		}
+		env.Set(params[paramIdx].Value, value)
+	}
+	return env, nil
+}
+
+// 检查函数调用的嵌套深度和实参个数 name为被调用的函数名
+func checkCall(name string, fn *object.Function, got int) *object.Error {
+	if depth >= MaxDepth {
+		return newError(ErrRecursion, "maximum recursion depth exceeded")
+	}
+	return checkArity(name, fn, got)
+}
+
+// 检查调用函数时的实参个数 name为被调用的函数名
+func checkArity(name string, fn *object.Function, got int) *object.Error {
+	min, max := len(fn.Parameters), len(fn.Parameters)
+	if fn.Variadic {
+		min, max = min-1, -1
+	}
+	for i, value := range fn.Defaults {
+		if value != nil {
+			min = i
+			break
+		}
+	}
+	return arityError(name, min, max, got)
+}
+
+// 检查调用函数时的实参个数 个数正确时返回nil
+// min为必须传入的实参个数 max为最多接受的实参个数 有剩余参数时max为-1
+func arityError(name string, min, max, got int) *object.Error {
+	switch {
+	case got < min && max == -1:
+		return newError(ErrArgumentCount, "wrong number of arguments to `%s`. got=%d, want at least %d", name, got, min)
+	case (got < min || got > max) && max != -1:
+		if min == max {
+			return newError(ErrArgumentCount, "wrong number of arguments to `%s`. got=%d, want=%d", name, got, min)
+		}
+		return newError(ErrArgumentCount, "wrong number of arguments to `%s`. got=%d, want=%d to %d", name, got, min, max)
+	}
+	return nil
+}
+
+// 将可迭代对象的各个值收集到数组中 用于展开实参
+// 与for-in遍历得到的值相同 对象不可迭代时返回错误
+func spread(obj object.Object) object.Object {
+	iterable, ok := obj.(object.Iterable)
+	if !ok {
+		return newError(ErrNotIterable, "cannot spread non-iterable object: %s", obj.Type())
+	}
+	elements := []object.Object{}
+	it := iterable.Iterator()
+	for {
+		_, value, ok := it.Next()
+		if !ok {
+			return &object.Array{Elements: elements}
+		}
+		elements = append(elements, value)
 	}
-	return env
 }
 
 // 求值字符串中缀表达式
 func evalStringInfixExpression(operator string, left, right object.Object) object.Object {
 	if operator != "+" {
-		return newError("unknown operator: %s %s %s",
+		return newError(ErrUnknownOperator, "unknown operator: %s %s %s",
 			left.Type(), operator, right.Type())
 	}
 	leftVal := left.(*object.String).Value
@@ -329,24 +794,48 @@ func evalStringInfixExpression(operator string, left, right object.Object) objec
 // 处理数组索引
 func evalArrayIndexExpression(array, index object.Object) object.Object {
 	arrayObject := array.(*object.Array)
-	idx := index.(*object.Integer).Value
-	// 检查数组索引是否越界
-	max := int64(len(arrayObject.Elements))
-	if idx < 0 || idx > max {
+	idx, ok := normalizeIndex(index.(*object.Integer).Value, len(arrayObject.Elements))
+	if !ok {
 		return NULL
 	}
 	return arrayObject.Elements[idx]
 }
 
+// 按字符索引字符串 结果为只包含一个字符的字符串
+func evalStringIndexExpression(str, index object.Object) object.Object {
+	chars := []rune(str.(*object.String).Value)
+	idx, ok := normalizeIndex(index.(*object.Integer).Value, len(chars))
+	if !ok {
+		return NULL
+	}
+	return &object.String{Value: string(chars[idx])}
+}
+
+// 将索引转换为下标 负数索引从末尾开始计数 -1为最后一个元素
+// 越界时ok为false
+func normalizeIndex(idx int64, length int) (int, bool) {
+	if idx < 0 {
+		idx += int64(length)
+	}
+	if idx < 0 || idx >= int64(length) {
+		return 0, false
+	}
+	return int(idx), true
+}
+
 // 求值索引表达式
 func evalIndexExpression(left, index object.Object) object.Object {
 	switch {
 	case left.Type() == object.ARRAY_OBJ && index.Type() == object.INTEGER_OBJ:
 		return evalArrayIndexExpression(left, index)
+	case left.Type() == object.STRING_OBJ && index.Type() == object.INTEGER_OBJ:
+		return evalStringIndexExpression(left, index)
 	case left.Type() == object.HASH_OBJ:
 		return evalHashIndexExpression(left, index)
+	case left.Type() == object.EXCEPTION_OBJ && index.Type() == object.STRING_OBJ:
+		return evalExceptionIndexExpression(left, index)
 	default:
-		return newError("index operator not supported: %s", left.Type())
+		return newError(ErrIndexUnsupported, "index operator not supported: %s", left.Type())
 	}
 }
 
@@ -356,7 +845,7 @@ func evalHashIndexExpression(hash, index object.Object) object.Object {
 
 	key, ok := index.(object.Hashable)
 	if !ok {
-		return newError("unusable as hash key: %s", index.Type())
+		return newError(ErrUnhashable, "unusable as hash key: %s", index.Type())
 	}
 	pair, ok := hashObject.Pairs[key.HashKey()]
 	if !ok {
@@ -372,15 +861,15 @@ func evalHashLiteral(node *ast.HashLiteral, env *object.Environment) object.Obje
 	// 迭代哈希表
 	for keyNode, valueNode := range node.Pairs {
 		key := Eval(keyNode, env)
-		if isError(key) {
+		if interrupts(key) {
 			return key
 		}
 		hashKey, ok := key.(object.Hashable)
 		if !ok {
-			return newError("unusable as hash key: %s", key.Type())
+			return newError(ErrUnhashable, "unusable as hash key: %s", key.Type())
 		}
 		value := Eval(valueNode, env)
-		if isError(value) {
+		if interrupts(value) {
 			return value
 		}
 		hashed := hashKey.HashKey()
@@ -389,21 +878,322 @@ func evalHashLiteral(node *ast.HashLiteral, env *object.Environment) object.Obje
 	return &object.Hash{Pairs: pairs}
 }
 
+// 对赋值表达式求值 修改变量所在环境中的值 结果为赋给变量的值
+func evalAssignExpression(node *ast.AssignExpression, env *object.Environment) object.Object {
+	name := node.Name.Value
+
+	// 复合赋值先读取变量的当前值 再计算右侧表达式
+	var current object.Object
+	if node.Operator != "=" {
+		var ok bool
+		if current, ok = env.Get(name); !ok {
+			return newError(ErrUnknownIdentifier, "identifier not found: %s", name)
+		}
+	}
+
+	val := Eval(node.Value, env)
+	if interrupts(val) {
+		return val
+	}
+	if current != nil {
+		val = evalInfixExpression(strings.TrimSuffix(node.Operator, "="), current, val)
+		if isError(val) {
+			return val
+		}
+	}
+
+	switch env.Assign(name, val) {
+	case object.ErrUndefined:
+		return newError(ErrUnknownIdentifier, "identifier not found: %s", name)
+	case object.ErrConstant:
+		return newError(ErrConstAssign, "cannot assign to constant %s", name)
+	}
+	return val
+}
+
+// 对索引赋值表达式求值 依次求值对象 索引和右侧表达式 结果为赋给元素的值
+// 数组和哈希表是引用 所有指向同一对象的变量都能看到修改
+func evalIndexAssignExpression(node *ast.IndexAssignExpression, env *object.Environment) object.Object {
+	left := Eval(node.Target.Left, env)
+	if interrupts(left) {
+		return left
+	}
+	index := Eval(node.Target.Index, env)
+	if interrupts(index) {
+		return index
+	}
+
+	// 复合赋值先读取元素的当前值
+	var current object.Object
+	if node.Operator != "=" {
+		if current = evalIndexExpression(left, index); isError(current) {
+			return current
+		}
+	}
+
+	val := Eval(node.Value, env)
+	if interrupts(val) {
+		return val
+	}
+	if current != nil {
+		val = evalInfixExpression(strings.TrimSuffix(node.Operator, "="), current, val)
+		if isError(val) {
+			return val
+		}
+	}
+	return setIndex(left, index, val)
+}
+
+// 修改数组的元素或哈希表中键对应的值 结果为赋给元素的值
+func setIndex(left, index, val object.Object) object.Object {
+	switch left := left.(type) {
+	case *object.Array:
+		integer, ok := index.(*object.Integer)
+		if !ok {
+			return newError(ErrIndexUnsupported, "array index must be INTEGER, got %s", index.Type())
+		}
+		idx, ok := normalizeIndex(integer.Value, len(left.Elements))
+		if !ok {
+			return newError(ErrIndexOutOfRange, "array index out of range: %d (length %d)", integer.Value, len(left.Elements))
+		}
+		left.Elements[idx] = val
+	case *object.Hash:
+		key, ok := index.(object.Hashable)
+		if !ok {
+			return newError(ErrUnhashable, "unusable as hash key: %s", index.Type())
+		}
+		left.Pairs[key.HashKey()] = object.HashPair{Key: index, Value: val}
+	default:
+		return newError(ErrIndexUnsupported, "index assignment not supported: %s", left.Type())
+	}
+	return val
+}
+
 // 求值循环表达式
 func evalWhileExpression(we *ast.WhileExpression, env *object.Environment) object.Object {
 	condition := Eval(we.Condition, env)
 
-	if isError(condition) {
+	if interrupts(condition) {
 		return condition
 	}
 
+	// 每次循环的语句块都是一个新的作用域
 	for isTruthy(condition) {
-		Eval(we.Body, env)
+		result := Eval(we.Body, object.NewEnclosedEnvironment(env))
+		if result == BREAK {
+			break
+		}
+		// 返回值和错误结束循环并继续向外传递
+		if result != CONTINUE && interrupts(result) {
+			return result
+		}
+
 		condition = Eval(we.Condition, env)
+		if interrupts(condition) {
+			return condition
+		}
 	}
 	return NULL
 }
 
+// 求值for表达式 每次循环在新的作用域中绑定循环变量 循环的值为NULL
+func evalForExpression(fe *ast.ForExpression, env *object.Environment) object.Object {
+	iterable := Eval(fe.Iterable, env)
+	if interrupts(iterable) {
+		return iterable
+	}
+	it, err := iteratorOf(iterable, fe.Iterable)
+	if err != nil {
+		return err
+	}
+
+	for {
+		key, value, ok := it.Next()
+		if !ok {
+			return NULL
+		}
+		if isError(value) {
+			return value
+		}
+
+		loopEnv := object.NewEnclosedEnvironment(env)
+		if fe.Key != nil {
+			loopEnv.Set(fe.Key.Value, key)
+		}
+		loopEnv.Set(fe.Value.Value, value)
+
+		result := Eval(fe.Body, loopEnv)
+		switch result {
+		case BREAK:
+			return NULL
+		case CONTINUE:
+			continue
+		}
+		if interrupts(result) {
+			return result
+		}
+	}
+}
+
+// 返回对象的迭代器
+// 除实现了object.Iterable的对象外 函数也可以被遍历 见functionIterator
+func iteratorOf(obj object.Object, expr ast.Expression) (object.Iterator, *object.Error) {
+	switch obj := obj.(type) {
+	case object.Iterable:
+		return obj.Iterator(), nil
+	case *object.Function, *object.Builtin:
+		return &functionIterator{fn: obj, name: displayName(obj, functionName(expr)), span: expr.Span()}, nil
+	default:
+		err := newError(ErrNotIterable, "object is not iterable: %s", obj.Type())
+		err.Span = expr.Span()
+		return nil, err
+	}
+}
+
+// 函数的迭代器 每次无参数地调用函数 函数返回NULL时结束 键为调用的序号
+// 用户可以借此用闭包实现自己的集合 函数出错时Next返回的值为该错误
+type functionIterator struct {
+	fn    object.Object
+	name  string     // 函数的名称 用于调用栈
+	span  token.Span // 被遍历的表达式的位置
+	index int64
+}
+
+func (it *functionIterator) Next() (object.Object, object.Object, bool) {
+	if fn, ok := it.fn.(*object.Function); ok {
+		if err := checkCall(it.name, fn, 0); err != nil {
+			err.Span = it.span
+			return nil, err, true
+		}
+	}
+	result := applyFunction(it.fn, nil)
+	if err, ok := result.(*object.Error); ok {
+		if !err.Span.IsValid() {
+			err.Span = it.span
+		}
+		if _, ok := it.fn.(*object.Function); ok {
+			err.Trace = append(err.Trace, object.Frame{Function: it.name, Span: it.span})
+		}
+		return nil, err, true
+	}
+	if result == nil || result == NULL {
+		return nil, nil, false
+	}
+	key := &object.Integer{Value: it.index}
+	it.index++
+	return key, result, true
+}
+
+// 求值try表达式
+// try语句块出错时 将错误包装为Exception绑定到catch的标识符 再执行catch语句块
+// finally语句块总会执行 其中的错误或返回值将覆盖之前的结果
+func evalTryExpression(te *ast.TryExpression, env *object.Environment) object.Object {
+	result := Eval(te.Block, object.NewEnclosedEnvironment(env))
+
+	if err, ok := result.(*object.Error); ok && te.Catch != nil {
+		catchEnv := object.NewEnclosedEnvironment(env)
+		if te.Param != nil {
+			catchEnv.Set(te.Param.Value, &object.Exception{Err: err})
+		}
+		result = Eval(te.Catch, catchEnv)
+	}
+
+	if te.Finally != nil {
+		final := Eval(te.Finally, object.NewEnclosedEnvironment(env))
+		if interrupts(final) {
+			return final
+		}
+	}
+	return result
+}
+
+// 由throw抛出的值创建错误
+// 抛出捕获的Exception时原样抛出其中的错误
+// 抛出哈希表时 可以用"message"和"kind"键指定错误信息和类别
+func newThrownError(val object.Object) *object.Error {
+	err := &object.Error{Code: ErrThrown, Kind: "Error", Value: val}
+
+	switch val := val.(type) {
+	case *object.Exception:
+		return val.Err
+	case *object.String:
+		err.Message = val.Value
+	case *object.Hash:
+		err.Message = val.Inspect()
+		if msg, ok := hashStringField(val, "message"); ok {
+			err.Message = msg
+		}
+		if kind, ok := hashStringField(val, "kind"); ok {
+			err.Kind = kind
+		}
+	default:
+		err.Message = val.Inspect()
+	}
+	return err
+}
+
+// 读取哈希表中字符串键对应的字符串值
+func hashStringField(hash *object.Hash, key string) (string, bool) {
+	pair, ok := hash.Pairs[(&object.String{Value: key}).HashKey()]
+	if !ok {
+		return "", false
+	}
+	str, ok := pair.Value.(*object.String)
+	if !ok {
+		return "", false
+	}
+	return str.Value, true
+}
+
+// 求值捕获的错误的索引表达式
+// 可用的键: message kind value file line column trace
+// trace为调用栈 按调用顺序排列 每一帧是含有function file line column的哈希表
+func evalExceptionIndexExpression(exception, index object.Object) object.Object {
+	err := exception.(*object.Exception).Err
+
+	switch index.(*object.String).Value {
+	case "message":
+		return &object.String{Value: err.Message}
+	case "kind":
+		return &object.String{Value: err.Kind}
+	case "value":
+		if err.Value == nil {
+			return NULL
+		}
+		return err.Value
+	case "file":
+		return &object.String{Value: err.Span.Start.Filename}
+	case "line":
+		return &object.Integer{Value: int64(err.Span.Start.Line)}
+	case "column":
+		return &object.Integer{Value: int64(err.Span.Start.Column)}
+	case "trace":
+		frames := make([]object.Object, 0, len(err.Trace))
+		for i := len(err.Trace) - 1; i >= 0; i-- {
+			frame := err.Trace[i]
+			frames = append(frames, newStringHash(map[string]object.Object{
+				"function": &object.String{Value: frame.Function},
+				"file":     &object.String{Value: frame.Span.Start.Filename},
+				"line":     &object.Integer{Value: int64(frame.Span.Start.Line)},
+				"column":   &object.Integer{Value: int64(frame.Span.Start.Column)},
+			}))
+		}
+		return &object.Array{Elements: frames}
+	default:
+		return NULL
+	}
+}
+
+// 由字符串键构造哈希表
+func newStringHash(fields map[string]object.Object) *object.Hash {
+	pairs := make(map[object.HashKey]object.HashPair)
+	for name, value := range fields {
+		key := &object.String{Value: name}
+		pairs[key.HashKey()] = object.HashPair{Key: key, Value: value}
+	}
+	return &object.Hash{Pairs: pairs}
+}
+
 // 封装返回值
 func unwrapReturnValue(obj object.Object) object.Object {
 	if returnValue, ok := obj.(*object.ReturnValue); ok {
@@ -413,8 +1203,8 @@ func unwrapReturnValue(obj object.Object) object.Object {
 }
 
 // 返回错误对象
-func newError(format string, a ...interface{}) *object.Error {
-	return &object.Error{Message: fmt.Sprintf(format, a...)}
+func newError(code string, format string, a ...interface{}) *object.Error {
+	return &object.Error{Code: code, Kind: errorKind(code), Message: fmt.Sprintf(format, a...)}
 }
 
 func isError(obj object.Object) bool {
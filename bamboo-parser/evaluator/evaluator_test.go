@@ -0,0 +1,736 @@
+package evaluator
+
+import (
+	"bamboo/lexer"
+	"bamboo/object"
+	"bamboo/parser"
+	"testing"
+)
+
+func testEval(t *testing.T, input string) object.Object {
+	t.Helper()
+	p := parser.New(lexer.New(input))
+	program := p.ParseProgram()
+	if errs := p.Errors(); len(errs) != 0 {
+		t.Fatalf("parser errors for %q: %v", input, errs[0].Message)
+	}
+	return Eval(program, object.NewEnvironment())
+}
+
+func testIntegerObject(t *testing.T, input string, obj object.Object, expected int64) {
+	t.Helper()
+	result, ok := obj.(*object.Integer)
+	if !ok {
+		t.Errorf("%q: object is not Integer. got=%T (%s)", input, obj, inspect(obj))
+		return
+	}
+	if result.Value != expected {
+		t.Errorf("%q: wrong value. got=%d, want=%d", input, result.Value, expected)
+	}
+}
+
+func testErrorObject(t *testing.T, input string, obj object.Object, code string) {
+	t.Helper()
+	err, ok := obj.(*object.Error)
+	if !ok {
+		t.Errorf("%q: object is not Error. got=%T (%s)", input, obj, inspect(obj))
+		return
+	}
+	if err.Code != code {
+		t.Errorf("%q: wrong error code. got=%s (%s), want=%s", input, err.Code, err.Message, code)
+	}
+}
+
+// 表驱动测试的一项 want为结果的Inspect输出 wantErr为期望的错误代码
+type evalTest struct {
+	input   string
+	want    string
+	wantErr string
+}
+
+func runEvalTests(t *testing.T, tests []evalTest) {
+	t.Helper()
+	for _, tt := range tests {
+		evaluated := testEval(t, tt.input)
+		if tt.wantErr != "" {
+			testErrorObject(t, tt.input, evaluated, tt.wantErr)
+			continue
+		}
+		if err, ok := evaluated.(*object.Error); ok {
+			t.Errorf("%q: unexpected error %s: %s", tt.input, err.Code, err.Message)
+			continue
+		}
+		if got := inspect(evaluated); got != tt.want {
+			t.Errorf("%q: wrong result. got=%s, want=%s", tt.input, got, tt.want)
+		}
+	}
+}
+
+func inspect(obj object.Object) string {
+	if obj == nil {
+		return "nil"
+	}
+	return obj.Inspect()
+}
+
+func TestWhileReturn(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected int64
+	}{
+		{`let f = func() { while (true) { return 1; } return 2; }; f();`, 1},
+		{`let f = func() { let i = 0; while (i < 10) { i += 1; if (i == 3) { return i * 10; } } return -1; }; f();`, 30},
+		{`let f = func() { let i = 0; while (true) { i += 1; while (true) { return i; } } }; f();`, 1},
+		{`let f = func(n) { let i = 0; while (i < n) { i += 1; } return i; }; f(5);`, 5},
+		{`let i = 0; while (true) { i += 1; if (i == 4) { return i; } }; 99;`, 4},
+	}
+
+	for _, tt := range tests {
+		testIntegerObject(t, tt.input, testEval(t, tt.input), tt.expected)
+	}
+}
+
+func TestWhileError(t *testing.T) {
+	tests := []struct {
+		input string
+		code  string
+	}{
+		{`let i = 0; while (i < 3) { i += 1; 1 + true; }`, ErrTypeMismatch},
+		{`while (true) { missing; }`, ErrUnknownIdentifier},
+		{`while (undefined) { 1; }`, ErrUnknownIdentifier},
+		{`let i = 0; while (10 / (2 - i) > 0) { i += 1; }`, ErrDivisionByZero},
+		{`let f = func() { while (true) { throw "stop"; } }; f();`, ErrThrown},
+	}
+
+	for _, tt := range tests {
+		testErrorObject(t, tt.input, testEval(t, tt.input), tt.code)
+	}
+}
+
+// 错误必须立即结束循环 而不是被忽略后继续执行
+func TestWhileErrorStopsLoop(t *testing.T) {
+	input := `let n = 0; let f = func() { while (n < 10) { n += 1; if (n == 3) { n + "x"; } } }; f();`
+	env := object.NewEnvironment()
+	p := parser.New(lexer.New(input))
+	program := p.ParseProgram()
+	if errs := p.Errors(); len(errs) != 0 {
+		t.Fatalf("parser errors: %v", errs[0].Message)
+	}
+
+	testErrorObject(t, input, Eval(program, env), ErrTypeMismatch)
+	n, _ := env.Get("n")
+	testIntegerObject(t, input, n, 3)
+}
+
+func TestLoopControl(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected int64
+	}{
+		{`let i = 0; while (true) { i += 1; if (i == 5) { break; } }; i;`, 5},
+		{`let i = 0; let s = 0; while (i < 10) { i += 1; if (i % 2 == 0) { continue; } s += i; }; s;`, 25},
+		{`let s = 0; for (x in range(10)) { if (x == 4) { break } s += x; }; s;`, 6},
+		{`let s = 0; for (x in [1, 2, 3, 4]) { if (x % 2 == 1) { continue } s += x; }; s;`, 6},
+		{`let s = 0; for (a in range(3)) { for (b in range(3)) { if (b > a) { break } s += 1; } }; s;`, 6},
+		{`let s = 0; let i = 0; while (i < 3) { i += 1; for (x in range(5)) { if (x == 1) { continue } if (x == 3) { break } s += 1; } }; s;`, 6},
+		{`let s = 0; for (x in range(5)) { try { if (x == 2) { break } s += 1; } finally { s += 10; } }; s;`, 32},
+		{`let s = 0; for (x in [1, 2, 3]) { let v = if (x == 2) { break } else { x }; s += v; }; s;`, 1},
+		{`let s = 0; for (x in [1, 2, 3]) { s += if (x > 1) { continue } else { x }; }; s;`, 1},
+		{`let s = 0; let i = 0; while (i < 4) { i += 1; s = s + (if (i == 3) { continue } else { i }); }; s;`, 7},
+		{`let a = []; for (x in range(4)) { push(a, if (x == 2) { break } else { x }); }; len(a);`, 2},
+		{`let a = []; for (x in range(4)) { push(a, [if (x % 2 == 0) { continue } else { x }]); }; len(a);`, 2},
+	}
+
+	for _, tt := range tests {
+		testIntegerObject(t, tt.input, testEval(t, tt.input), tt.expected)
+	}
+}
+
+func TestForReturnAndError(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected interface{}
+	}{
+		{`let f = func() { for (x in range(10)) { if (x == 7) { return x; } } }; f();`, int64(7)},
+		{`let f = func() { for (x in [1, 2]) { while (true) { return x * 100; } } }; f();`, int64(100)},
+		{`let f = func() { for (x in [1, 2]) { x + "a"; } return 0; }; f();`, ErrTypeMismatch},
+		{`for (x in 5) { x; }`, ErrNotIterable},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(t, tt.input)
+		switch expected := tt.expected.(type) {
+		case int64:
+			testIntegerObject(t, tt.input, evaluated, expected)
+		case string:
+			testErrorObject(t, tt.input, evaluated, expected)
+		}
+	}
+}
+
+func TestIfReturn(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected int64
+	}{
+		{`if (true) { if (true) { return 10; } return 1; }`, 10},
+		{`let f = func(x) { if (x > 0) { return 1; } else { return -1; } 0; }; f(-5);`, -1},
+		{`let f = func(x) { if (x > 0) { if (x > 10) { return 2; } } return 3; }; f(5);`, 3},
+		{`let f = func() { if (true) { 1 } else { 2 } }; f();`, 1},
+		{`let f = func() { let r = if (true) { return 5 } else { 0 }; 99 }; f();`, 5},
+		{`let f = func(x) { let y = x + if (x > 0) { return 7 } else { 1 }; y }; [f(1), f(-1)][0];`, 7},
+		{`let f = func(x) { let y = x + if (x > 0) { return 7 } else { 1 }; y }; f(-1);`, 0},
+		{`let g = func(a) { a }; let f = func() { g(if (true) { return 3 } else { 4 }); 0 }; f();`, 3},
+	}
+
+	for _, tt := range tests {
+		testIntegerObject(t, tt.input, testEval(t, tt.input), tt.expected)
+	}
+}
+
+// return只结束最内层的函数
+func TestNestedFunctionReturn(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected int64
+	}{
+		{`let f = func() { let g = func() { return 1; }; g(); return 2; }; f();`, 2},
+		{`let f = func() { let i = 0; while (i < 3) { let g = func() { return 100; }; i += g() / 100; } return i; }; f();`, 3},
+		{`let f = func() { for (x in range(3)) { let g = func() { for (y in range(3)) { return y; } }; if (x == 2) { return x + g(); } } }; f();`, 2},
+		{`let adder = func(a) { func(b) { while (true) { return a + b; } } }; adder(2)(3);`, 5},
+		{`let f = func(n) { if (n == 0) { return 0; } let s = 0; while (true) { s = n + f(n - 1); return s; } }; f(4);`, 10},
+	}
+
+	for _, tt := range tests {
+		testIntegerObject(t, tt.input, testEval(t, tt.input), tt.expected)
+	}
+}
+
+func TestNestedFunctionError(t *testing.T) {
+	input := `let inner = func() { while (true) { 1 / 0; } }; let outer = func() { let i = 0; while (i < 5) { i += 1; inner(); } i; }; outer();`
+
+	evaluated := testEval(t, input)
+	testErrorObject(t, input, evaluated, ErrDivisionByZero)
+	if err, ok := evaluated.(*object.Error); ok && len(err.Trace) != 2 {
+		t.Errorf("wrong trace length. got=%d, want=2", len(err.Trace))
+	}
+}
+
+func TestFunctionArguments(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected interface{}
+	}{
+		{`let f = func(a, b) { a + b }; f(1);`, ErrArgumentCount},
+		{`let f = func(a, b) { a + b }; f(1, 2, 3);`, ErrArgumentCount},
+		{`let f = func(a, b = 10) { a + b }; f(1);`, int64(11)},
+		{`let f = func(a, b = a * 2) { a + b }; f(3);`, int64(9)},
+		{`let f = func(a, b = 10) { a + b }; f();`, ErrArgumentCount},
+		{`let f = func(a, ...rest) { len(rest) }; f(1, 2, 3);`, int64(2)},
+		{`let f = func(a, ...rest) { len(rest) }; f(1);`, int64(0)},
+		{`let f = func(a, ...rest) { a }; f();`, ErrArgumentCount},
+		{`let f = func(a, b, c) { a * 100 + b * 10 + c }; f(...[1, 2], 3);`, int64(123)},
+		{`let f = func(...xs) { len(xs) }; f(...range(4), 9, ...[]);`, int64(5)},
+		{`let f = func(a) { a }; f(...1);`, ErrNotIterable},
+		{`let f = func(a = 1 / 0) { a }; f();`, ErrDivisionByZero},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(t, tt.input)
+		switch expected := tt.expected.(type) {
+		case int64:
+			testIntegerObject(t, tt.input, evaluated, expected)
+		case string:
+			testErrorObject(t, tt.input, evaluated, expected)
+		}
+	}
+}
+
+func TestFunctionDeclaration(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected int64
+	}{
+		{`func add(a, b) { a + b } add(1, 2);`, 3},
+		{`let r = twice(4); func twice(x) { x * 2 } r;`, 8},
+		{`func even(n) { if (n == 0) { return 1; } odd(n - 1) } func odd(n) { if (n == 0) { return 0; } even(n - 1) } even(10);`, 1},
+		{`let f = func() { let r = g(); func g() { 5 } r }; f();`, 5},
+		{`if (true) { func h() { 7 } h() }`, 7},
+	}
+
+	for _, tt := range tests {
+		testIntegerObject(t, tt.input, testEval(t, tt.input), tt.expected)
+	}
+}
+
+// 函数名用于Inspect 错误信息和调用栈
+func TestFunctionName(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{`func add(a, b) { a + b } add;`, "fn add(a, b) {\n(a + b)\n}"},
+		{`let sq = func(x) { x * x }; sq;`, "fn sq(x) {\n(x * x)\n}"},
+		{`func(x) { x };`, "fn(x) {\nx\n}"},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(t, tt.input)
+		if got := inspect(evaluated); got != tt.expected {
+			t.Errorf("%q: wrong Inspect. got=%q, want=%q", tt.input, got, tt.expected)
+		}
+	}
+
+	input := `func two(a, b) { a / b } let alias = two; let call = func(f) { f(1, 0) }; call(alias);`
+	err, ok := testEval(t, input).(*object.Error)
+	if !ok {
+		t.Fatalf("expected error for %q", input)
+	}
+	var names []string
+	for _, frame := range err.Trace {
+		names = append(names, frame.Function)
+	}
+	if len(names) != 2 || names[0] != "two" || names[1] != "call" {
+		t.Errorf("wrong trace. got=%v, want=[two call]", names)
+	}
+
+	input = `func two(a, b) { a + b } let alias = two; alias(1);`
+	evaluated := testEval(t, input)
+	err, ok = evaluated.(*object.Error)
+	if !ok || err.Message != "wrong number of arguments to `two`. got=1, want=2" {
+		t.Errorf("wrong arity error for %q: %s", input, inspect(evaluated))
+	}
+}
+
+// 尾调用不增加调用栈的深度
+func TestTailCall(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected int64
+	}{
+		{`func count(n, acc) { if (n == 0) { return acc; } count(n - 1, acc + 1) } count(100000, 0);`, 100000},
+		{`func even(n) { if (n == 0) { 1 } else { odd(n - 1) } } func odd(n) { if (n == 0) { 0 } else { even(n - 1) } } even(100001);`, 0},
+		{`func loop(n) { while (true) { if (n == 0) { return 7; } return loop(n - 1); } } loop(50000);`, 7},
+		{`func sum(n, ...acc) { if (n == 0) { return len(acc); } sum(n - 1, ...acc, n) } sum(200);`, 200},
+		{`let f = func(n, d = n) { if (n == 0) { d } else { f(n - 1) } }; f(50000);`, 0},
+	}
+
+	for _, tt := range tests {
+		testIntegerObject(t, tt.input, testEval(t, tt.input), tt.expected)
+	}
+}
+
+func TestRecursionLimit(t *testing.T) {
+	defer func(limit int) { MaxDepth = limit }(MaxDepth)
+
+	input := `func deep(n) { if (n == 0) { 0 } else { 1 + deep(n - 1) } } deep(100);`
+	testIntegerObject(t, input, testEval(t, input), 100)
+
+	MaxDepth = 50
+	testErrorObject(t, input, testEval(t, input), ErrRecursion)
+	testIntegerObject(t, input, testEval(t, `func deep(n) { if (n == 0) { 0 } else { 1 + deep(n - 1) } } deep(49);`), 49)
+
+	// 超过限制的错误可以被捕获 捕获后可以继续调用函数
+	input = `func deep(n) { if (n == 0) { 0 } else { 1 + deep(n - 1) } } let k = try { deep(100) } catch (e) { e["kind"] }; [k, deep(10)];`
+	evaluated := testEval(t, input)
+	if got := inspect(evaluated); got != "[RecursionError, 10]" {
+		t.Errorf("%q: wrong result. got=%s", input, got)
+	}
+
+	input = `recursionlimit(20); func deep(n) { if (n == 0) { 0 } else { 1 + deep(n - 1) } } deep(30);`
+	testErrorObject(t, input, testEval(t, input), ErrRecursion)
+	if MaxDepth != 20 {
+		t.Errorf("recursionlimit did not set the limit. got=%d, want=20", MaxDepth)
+	}
+
+	// 过大的限制会被拒绝 深层递归报告错误而不是让Go的栈溢出
+	testErrorObject(t, `recursionlimit(1000000);`, testEval(t, `recursionlimit(1000000);`), ErrInvalidValue)
+	input = `recursionlimit(20000); func deep(n) { if (n == 0) { 0 } else { 1 + deep(n - 1) } } deep(300000);`
+	testErrorObject(t, input, testEval(t, input), ErrRecursion)
+}
+
+// 字符串按字符计算长度 bytes按UTF-8编码转换
+func TestUnicodeStrings(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected int64
+	}{
+		{`let 蚌埠 = 5; 蚌埠 * 2;`, 10},
+		{`func 加(甲, 乙) { 甲 + 乙 } 加(1, 2);`, 3},
+		{`len("竹子🎋");`, 3},
+		{`len(bytes("竹子🎋"));`, 10},
+		{`len(bytes(""));`, 0},
+		{`bytes("é")[1];`, 169},
+	}
+
+	for _, tt := range tests {
+		testIntegerObject(t, tt.input, testEval(t, tt.input), tt.expected)
+	}
+}
+
+func TestNullAndOptionalChaining(t *testing.T) {
+	config := `let config = {"server": {"host": "example.org", "ports": [80, 443]}, "debug": null}; `
+	tests := []evalTest{
+		{`null;`, "NULL", ""},
+		{`let a = null; a == null;`, "true", ""},
+		{`type(null);`, "Null", ""},
+		{config + `config?.server?.host;`, "example.org", ""},
+		{config + `config?.server?.ports?[1];`, "443", ""},
+		{config + `config?.client?.host;`, "NULL", ""},
+		{config + `config?.client?["ports"][0];`, "NULL", ""},
+		{config + `let n = null; n?.get(1 / 0);`, "NULL", ""},
+		{config + `config?.client?.port ?? 8080;`, "8080", ""},
+		{config + `config?.debug ?? true;`, "true", ""},
+		{`0 ?? 1;`, "0", ""},
+		{`false ?? true;`, "false", ""},
+		{`null ?? null ?? 3;`, "3", ""},
+		{`let calls = 0; let f = func() { calls += 1; 5 }; f() ?? f(); calls;`, "1", ""},
+		{`[1, 2]?[5] ?? -1;`, "-1", ""},
+		{config + `config?.client["host"];`, "", ErrIndexUnsupported},
+		{`null ?? 1 + "a";`, "", ErrTypeMismatch},
+	}
+
+	runEvalTests(t, tests)
+
+	p := parser.New(lexer.New(`a?.b?["c"](1) ?? d;`))
+	program := p.ParseProgram()
+	if got, want := program.String(), "(((a?.b)?[c])(1) ?? d)"; got != want {
+		t.Errorf("wrong program string. got=%q, want=%q", got, want)
+	}
+}
+
+func TestIndexAndSlice(t *testing.T) {
+	tests := []evalTest{
+		{`[1, 2, 3][2];`, "3", ""},
+		{`[1, 2, 3][3];`, "NULL", ""},
+		{`[1, 2, 3][-1];`, "3", ""},
+		{`[1, 2, 3][-3];`, "1", ""},
+		{`[1, 2, 3][-4];`, "NULL", ""},
+		{`[][0];`, "NULL", ""},
+		{`"héllo"[1];`, "é", ""},
+		{`"abc"[-1];`, "c", ""},
+		{`"abc"[3];`, "NULL", ""},
+		{`[1, 2, 3, 4, 5][1:3];`, "[2, 3]", ""},
+		{`[1, 2, 3, 4, 5][:2];`, "[1, 2]", ""},
+		{`[1, 2, 3, 4, 5][3:];`, "[4, 5]", ""},
+		{`[1, 2, 3, 4, 5][:];`, "[1, 2, 3, 4, 5]", ""},
+		{`[1, 2, 3, 4, 5][-2:];`, "[4, 5]", ""},
+		{`[1, 2, 3, 4, 5][::2];`, "[1, 3, 5]", ""},
+		{`[1, 2, 3, 4, 5][::-1];`, "[5, 4, 3, 2, 1]", ""},
+		{`[1, 2, 3, 4, 5][3:1:-1];`, "[4, 3]", ""},
+		{`[1, 2, 3, 4, 5][3:1];`, "[]", ""},
+		{`[1, 2, 3, 4, 5][-10:10];`, "[1, 2, 3, 4, 5]", ""},
+		{`[1, 2, 3, 4, 5][::100];`, "[1]", ""},
+		{`[1, 2, 3, 4, 5][null:null:null];`, "[1, 2, 3, 4, 5]", ""},
+		{`"héllo"[1:4];`, "éll", ""},
+		{`"abc"[::-1];`, "cba", ""},
+		{`let a = null; a?[1:2];`, "NULL", ""},
+		{`[1, 2][::0];`, "", ErrInvalidValue},
+		{`[1, 2]["a":];`, "", ErrIndexUnsupported},
+		{`5[1:];`, "", ErrIndexUnsupported},
+	}
+
+	runEvalTests(t, tests)
+
+	p := parser.New(lexer.New(`a[1:]; a?[::-1];`))
+	program := p.ParseProgram()
+	if got, want := program.String(), "(a[1:])(a?[::(-1)])"; got != want {
+		t.Errorf("wrong program string. got=%q, want=%q", got, want)
+	}
+}
+
+func TestIndexAssignment(t *testing.T) {
+	tests := []evalTest{
+		{`let a = [1, 2, 3]; a[0] = 10; a;`, "[10, 2, 3]", ""},
+		{`let a = [1, 2, 3]; a[-1] += 5; a;`, "[1, 2, 8]", ""},
+		{`let a = [1, 2, 3]; a[1] = 7;`, "7", ""},
+		{`let a = [1, 2]; let b = a; b[0] = 5; a;`, "[5, 2]", ""},
+		{`let m = [[1, 2], [3, 4]]; m[1][0] = 9; m;`, "[[1, 2], [9, 4]]", ""},
+		{`let a = [1]; let f = func(arr) { arr[0] = 2 }; f(a); a;`, "[2]", ""},
+		{`let h = {}; h["a"] = 1; h["a"] += 1; h["a"];`, "2", ""},
+		{`let h = {"a": 1}; let g = h; g["b"] = 2; h["b"];`, "2", ""},
+		{`let a = [1, 2]; a[2] = 3;`, "", ErrIndexOutOfRange},
+		{`let a = [1, 2]; a[-3] = 3;`, "", ErrIndexOutOfRange},
+		{`let a = [1, 2]; a["x"] = 3;`, "", ErrIndexUnsupported},
+		{`let s = "abc"; s[0] = "x";`, "", ErrIndexUnsupported},
+		{`let h = {}; h[[1]] = 1;`, "", ErrUnhashable},
+		{`let a = []; push(a, 1, 2); push(a, 3);`, "[1, 2, 3]", ""},
+		{`let a = [1, 2, 3]; pop(a) + len(a);`, "5", ""},
+		{`pop([]);`, "", ErrIndexOutOfRange},
+		{`let a = [1, 2]; insert(a, 0, 0); insert(a, 3, 3); insert(a, -1, 9);`, "[0, 1, 2, 9, 3]", ""},
+		{`insert([1], 2, 0);`, "", ErrIndexOutOfRange},
+		{`let a = [1, 2, 3]; remove(a, 1) * 10 + len(a);`, "22", ""},
+		{`let a = [1, 2, 3]; remove(a, -1); a;`, "[1, 2]", ""},
+		{`remove([], 0);`, "", ErrIndexOutOfRange},
+		{`let h = {"a": 1, "b": 2}; delete(h, "a") + len([h["a"]]);`, "2", ""},
+		{`let h = {"a": 1}; delete(h, "b");`, "NULL", ""},
+		{`push(1, 2);`, "", ErrArgumentType},
+	}
+
+	runEvalTests(t, tests)
+
+	p := parser.New(lexer.New(`a?[0] = 1;`))
+	p.ParseProgram()
+	if len(p.Errors()) == 0 || p.Errors()[0].Code != parser.ErrInvalidAssign {
+		t.Errorf("expected %s for assignment to optional access. got=%v", parser.ErrInvalidAssign, p.Errors())
+	}
+}
+
+func TestShiftCount(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected int64
+	}{
+		{`1 << 62;`, 1 << 62},
+		{`(1 << 70) >> 68;`, 4},
+		{`-5 >> 100;`, -1},
+		{`(1 << 70) >> (1 << 70);`, 0},
+		{`-(1 << 70) >> (1 << 70);`, -1},
+	}
+	for _, tt := range tests {
+		testIntegerObject(t, tt.input, testEval(t, tt.input), tt.expected)
+	}
+
+	errors := []struct {
+		input string
+		code  string
+	}{
+		{`1 << 100000000000;`, ErrInvalidValue},
+		{`1 << (1 << 70);`, ErrInvalidValue},
+		{`(1 << 70) << 1048577;`, ErrInvalidValue},
+		{`1 << -1;`, ErrInvalidValue},
+		{`5 >> -(1 << 70);`, ErrInvalidValue},
+	}
+	for _, tt := range errors {
+		testErrorObject(t, tt.input, testEval(t, tt.input), tt.code)
+	}
+	if _, ok := testEval(t, `1 << 1048576;`).(*object.BigInt); !ok {
+		t.Errorf("shift by the limit should produce a BigInt")
+	}
+
+	// 移位的位数不是整数时为类型错误
+	for _, count := range []object.Object{&object.Float{Value: 1.5}, &object.String{Value: "a"}} {
+		result := evalShiftExpression("<<", &object.Integer{Value: 1}, count)
+		testErrorObject(t, "1 << "+count.Inspect(), result, ErrTypeMismatch)
+	}
+}
+
+// 浮点数与整数相同 除以零或对零取余时报错
+func TestDivisionByZero(t *testing.T) {
+	tests := []string{
+		`1 / 0;`,
+		`1 % 0;`,
+		`(1 << 70) / 0;`,
+		`1.5 / 0;`,
+		`1.5 % 0;`,
+		`1 / 0.0;`,
+		`1 % 0.0;`,
+		`0.0 / 0.0;`,
+		`-2.5 / -0.0;`,
+		`(1 << 70) / 0.0;`,
+	}
+	for _, input := range tests {
+		testErrorObject(t, input, testEval(t, input), ErrDivisionByZero)
+	}
+
+	if got := inspect(testEval(t, `7.5 % 2;`)); got != "1.5" {
+		t.Errorf("wrong float remainder. got=%s, want=1.5", got)
+	}
+}
+
+// 运行时错误记录出错表达式所在的位置
+func TestErrorPosition(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"let a = 1;\nlet b = a + \"x\";", "t.bam:2:9"},
+		{"let f = func() {\n  missing\n};\nf();", "t.bam:2:3"},
+		{"[1, 2][\"a\"];", "t.bam:1:1"},
+		{"let h = {};\nh[[1]] = 1;", "t.bam:2:1"},
+	}
+
+	for _, tt := range tests {
+		p := parser.New(lexer.NewFile("t.bam", tt.input))
+		program := p.ParseProgram()
+		if errs := p.Errors(); len(errs) != 0 {
+			t.Fatalf("parser errors for %q: %v", tt.input, errs[0].Message)
+		}
+		err, ok := Eval(program, object.NewEnvironment()).(*object.Error)
+		if !ok {
+			t.Errorf("%q: expected error", tt.input)
+			continue
+		}
+		if got := err.Span.String(); got != tt.expected {
+			t.Errorf("%q: wrong error position. got=%s, want=%s", tt.input, got, tt.expected)
+		}
+	}
+}
+
+func TestTryCatchFinally(t *testing.T) {
+	tests := []evalTest{
+		{`try { 1 / 0 } catch (e) { e["message"] };`, "division by zero", ""},
+		{`try { 1 / 0 } catch (e) { e["kind"] };`, "ZeroDivisionError", ""},
+		{`try { {}["a"] + 1 } catch (e) { e["kind"] };`, "TypeError", ""},
+		{`try { 5 } catch (e) { 0 };`, "5", ""},
+		{`try { 1 / 0 } catch { 3 };`, "3", ""},
+		{`let e = 1; try { 1 / 0 } catch (e) { 0 }; e;`, "1", ""},
+		// throw可以抛出任意值
+		{`try { throw "bad" } catch (e) { e["message"] + "!" };`, "bad!", ""},
+		{`try { throw 42 } catch (e) { e["value"] + 1 };`, "43", ""},
+		{`try { throw {"message": "m", "kind": "ValueError"} } catch (e) { e["kind"] + e["message"] };`, "ValueErrorm", ""},
+		{`try { try { 1 / 0 } catch (e) { throw e } } catch (e) { e["kind"] };`, "ZeroDivisionError", ""},
+		{`throw "x";`, "", ErrThrown},
+		{`try { 1 / 0 } catch (e) { 1 + "a" };`, "", ErrTypeMismatch},
+		// 捕获的错误记录位置和调用栈
+		{"try {\n  1 / 0\n} catch (e) { [e[\"line\"], e[\"column\"]] };", "[2, 3]", ""},
+		{`let f = func() { 1 / 0 }; let g = func() { f() }; try { g() } catch (e) { e["trace"][1]["function"] };`, "f", ""},
+		// finally总会执行 其中的返回值或错误覆盖之前的结果
+		{`let log = []; try { push(log, 1) } finally { push(log, 2) }; log;`, "[1, 2]", ""},
+		{`let log = []; try { 1 / 0 } catch (e) { push(log, "c") } finally { push(log, "f") }; log;`, "[c, f]", ""},
+		{`let log = []; let f = func() { try { 1 / 0 } finally { push(log, "f") } }; try { f() } catch (e) { push(log, e["kind"]) }; log;`, "[f, ZeroDivisionError]", ""},
+		{`let f = func() { try { return 1 } finally { return 2 } }; f();`, "2", ""},
+		{`let f = func() { try { return 1 } catch (e) { 0 }; 5 }; f();`, "1", ""},
+		{`try { 1 } finally { 1 / 0 };`, "", ErrDivisionByZero},
+		{`let s = 0; for (i in range(5)) { try { if (i == 3) { break; } s += i } finally { s += 10 } }; s;`, "43", ""},
+	}
+
+	runEvalTests(t, tests)
+}
+
+// 整数与浮点数混合运算时结果为浮点数 整数之间的除法仍为整数除法
+func TestFloats(t *testing.T) {
+	tests := []evalTest{
+		{`3.14 + 1;`, "4.140000000000001", ""},
+		{`0.1 + 0.2;`, "0.30000000000000004", ""},
+		{`.5 + .25;`, "0.75", ""},
+		{`2 * 0.5;`, "1.0", ""},
+		{`2.0 * 3;`, "6.0", ""},
+		{`1.0 / 4;`, "0.25", ""},
+		{`7 / 2;`, "3", ""},
+		{`7.5 % 2;`, "1.5", ""},
+		{`-7.5 % 2;`, "-1.5", ""},
+		{`-1.5;`, "-1.5", ""},
+		{`1e-9;`, "1e-09", ""},
+		{`1e21;`, "1e+21", ""},
+		{`2.5E3;`, "2500.0", ""},
+		{`(1 << 70) + 0.5;`, "1.1805916207174113e+21", ""},
+		{`3 == 3.0;`, "true", ""},
+		{`2.5 < 3;`, "true", ""},
+		{`2.5 >= 2.5;`, "true", ""},
+		{`1.5 != 1.5;`, "false", ""},
+		{`type(1.5);`, "Float", ""},
+		{`1.5 + "a";`, "", ErrTypeMismatch},
+		// 类型转换
+		{`float(3);`, "3.0", ""},
+		{`float("2.5");`, "2.5", ""},
+		{`float(1 << 70);`, "1.1805916207174113e+21", ""},
+		{`int(3.9);`, "3", ""},
+		{`int(-3.9);`, "-3", ""},
+		{`int("42");`, "42", ""},
+		{`int(1e30);`, "1000000000000000019884624838656", ""},
+		{`float("x");`, "", ErrInvalidValue},
+	}
+
+	runEvalTests(t, tests)
+}
+
+// 整数运算溢出时自动转为大整数 结果回到int64范围内时转回整数
+func TestBigIntPromotion(t *testing.T) {
+	tests := []evalTest{
+		{`9223372036854775807 + 1;`, "9223372036854775808", ""},
+		{`-9223372036854775808 - 1;`, "-9223372036854775809", ""},
+		{`4611686018427387904 * 2;`, "9223372036854775808", ""},
+		{`-(-9223372036854775808);`, "9223372036854775808", ""},
+		{`-9223372036854775808 / -1;`, "9223372036854775808", ""},
+		{`99999999999999999999;`, "99999999999999999999", ""},
+		{`99999999999999999999 / 3;`, "33333333333333333333", ""},
+		{`99999999999999999999 % 7;`, "1", ""},
+		{`9223372036854775808 == 9223372036854775808;`, "true", ""},
+		{`9223372036854775808 > 9223372036854775807;`, "true", ""},
+		{`type(9223372036854775807 + 1);`, "Integer", ""},
+		{`let f = func(n) { if (n < 2) { 1 } else { n * f(n - 1) } }; f(25);`, "15511210043330985984000000", ""},
+		// 相同的值无论大小形式都是同一个键
+		{`let h = {9223372036854775808: "big", 1: "one"}; h[9223372036854775807 + 1];`, "big", ""},
+		{`let h = {1: "one"}; h[(9223372036854775807 + 2) - 9223372036854775807 - 1];`, "one", ""},
+		{`99999999999999999999 + "a";`, "", ErrTypeMismatch},
+	}
+
+	runEvalTests(t, tests)
+
+	types := []struct {
+		input string
+		big   bool
+	}{
+		{`9223372036854775807 + 1;`, true},
+		{`(9223372036854775807 + 1) - 1;`, false},
+		{`99999999999999999999 / 99999999999999999999;`, false},
+		{`9223372036854775807;`, false},
+	}
+	for _, tt := range types {
+		evaluated := testEval(t, tt.input)
+		if _, ok := evaluated.(*object.BigInt); ok != tt.big {
+			t.Errorf("%q: wrong representation. got=%T, want BigInt=%t", tt.input, evaluated, tt.big)
+		}
+	}
+}
+
+func TestOperators(t *testing.T) {
+	tests := []evalTest{
+		// 取余的符号与被除数相同
+		{`[7 % 3, -7 % 3, 7 % -3];`, "[1, -1, 1]", ""},
+		{`[1 <= 1, 2 >= 3, 2.5 <= 3];`, "[true, false, true]", ""},
+		// 逻辑运算按真假值计算 结果为布尔值
+		{`[true && false, false || true, 1 && 2, 0 || "x", null || 3, null && 1];`, "[false, true, true, true, true, false]", ""},
+		{`let calls = 0; let f = func() { calls += 1; true }; false && f(); true || f(); calls;`, "0", ""},
+		{`let calls = 0; let f = func() { calls += 1; true }; true && f(); false || f(); calls;`, "2", ""},
+		{`false && 1 / 0;`, "false", ""},
+		{`true || undefinedName;`, "true", ""},
+		{`true && 1 / 0;`, "", ErrDivisionByZero},
+		// 位运算
+		{`[6 & 3, 6 | 1, 6 ^ 3, ~0, ~5];`, "[2, 7, 5, -1, -6]", ""},
+		{`[1 << 4, -16 >> 2, 1 << 64];`, "[16, -4, 18446744073709551616]", ""},
+		{`(1 << 70) & ((1 << 70) | 1);`, "1180591620717411303424", ""},
+		{`1 | 2 == 2;`, "", ErrTypeMismatch},
+		{`true & 1;`, "", ErrTypeMismatch},
+		{`1.5 & 1;`, "", ErrUnknownOperator},
+		{`~1.5;`, "", ErrUnknownOperator},
+	}
+
+	runEvalTests(t, tests)
+}
+
+// 赋值修改变量所在作用域中的绑定 let只在当前语句块中声明变量
+func TestAssignmentAndScoping(t *testing.T) {
+	tests := []evalTest{
+		{`let money = 100; let check = func(n) { money = money - n }; check(30); money;`, "70", ""},
+		{`let x = 1; if (true) { let x = 2; x = 3 }; x;`, "1", ""},
+		{`let y = 1; if (true) { y = 5 }; y;`, "5", ""},
+		{`let f = func() { let v = 1; let g = func() { v += 1 }; g(); g(); v }; f();`, "3", ""},
+		{`let s = 0; let i = 0; while (i < 3) { i += 1; let t = i * 2; s += t }; s;`, "12", ""},
+		{`let a = 2; a *= 3; a -= 1; a /= 2; a %= 2; a;`, "0", ""},
+		{`let a = 1; (a = 5) + 1;`, "6", ""},
+		{`let n = 0; for (i in range(3)) { let n = i }; n;`, "0", ""},
+		{`if (true) { let q = 1 }; q;`, "", ErrUnknownIdentifier},
+		{`let f = func() { let local = 1 }; f(); local;`, "", ErrUnknownIdentifier},
+		{`z = 1;`, "", ErrUnknownIdentifier},
+		{`let a = "x"; a -= 1;`, "", ErrTypeMismatch},
+	}
+
+	runEvalTests(t, tests)
+}
+
+// 常量不能赋值 在声明之前定义的函数中的赋值在运行时检查
+func TestConst(t *testing.T) {
+	tests := []evalTest{
+		{`const c = 1; c + 1;`, "2", ""},
+		{`const c = [1]; c[0] = 2; c;`, "[2]", ""},
+		{`const c = 1; if (true) { let c = 5; c = 6; c }`, "6", ""},
+		{`const c = 1; let f = func() { c * 10 }; f();`, "10", ""},
+		{`let f = func() { c = 2 }; const c = 1; f();`, "", ErrConstAssign},
+		{`let f = func() { c += 2 }; const c = 1; f();`, "", ErrConstAssign},
+		{`let f = func() { c = 2 }; const c = 1; try { f() } catch (e) { [e["kind"], c] };`, "[TypeError, 1]", ""},
+	}
+
+	runEvalTests(t, tests)
+}
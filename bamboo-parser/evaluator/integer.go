@@ -0,0 +1,153 @@
+package evaluator
+
+import (
+	"bamboo/object"
+	"math"
+	"math/big"
+)
+
+// 整数运算溢出时自动提升为任意精度整数
+// 大整数运算的结果能放入int64时再还原为普通整数 保证同一个值只有一种表示
+
+// 带溢出检查的整数加法
+func addInt(a, b int64) (int64, bool) {
+	c := a + b
+	return c, (c > a) == (b > 0)
+}
+
+// 带溢出检查的整数减法
+func subInt(a, b int64) (int64, bool) {
+	c := a - b
+	return c, (c < a) == (b > 0)
+}
+
+// 带溢出检查的整数乘法
+func mulInt(a, b int64) (int64, bool) {
+	if a == 0 || b == 0 {
+		return 0, true
+	}
+	c := a * b
+	if (a == -1 && b == math.MinInt64) || (b == -1 && a == math.MinInt64) {
+		return c, false
+	}
+	return c, c/b == a
+}
+
+// 判断对象是否为整数 包括大整数
+func isInteger(obj object.Object) bool {
+	switch obj.(type) {
+	case *object.Integer, *object.BigInt:
+		return true
+	}
+	return false
+}
+
+// 将整数转换为大整数
+func toBig(obj object.Object) *big.Int {
+	switch obj := obj.(type) {
+	case *object.Integer:
+		return big.NewInt(obj.Value)
+	case *object.BigInt:
+		return obj.Value
+	}
+	return new(big.Int)
+}
+
+// 将大整数规范化 能放入int64时返回普通整数
+func normalizeBig(value *big.Int) object.Object {
+	if value.IsInt64() {
+		return &object.Integer{Value: value.Int64()}
+	}
+	return &object.BigInt{Value: value}
+}
+
+// 计算大整数中缀表达式 至少有一个操作数超出int64范围
+func evalBigIntInfixExpression(operator string, left, right object.Object) object.Object {
+	leftVal := toBig(left)
+	rightVal := toBig(right)
+
+	switch operator {
+	case "+":
+		return normalizeBig(new(big.Int).Add(leftVal, rightVal))
+	case "-":
+		return normalizeBig(new(big.Int).Sub(leftVal, rightVal))
+	case "*":
+		return normalizeBig(new(big.Int).Mul(leftVal, rightVal))
+	case "/":
+		if rightVal.Sign() == 0 {
+			return newError(ErrDivisionByZero, "division by zero")
+		}
+		// 与int64除法一致 向零取整
+		return normalizeBig(new(big.Int).Quo(leftVal, rightVal))
+	case "%":
+		if rightVal.Sign() == 0 {
+			return newError(ErrDivisionByZero, "division by zero")
+		}
+		// 余数的符号与被除数相同
+		return normalizeBig(new(big.Int).Rem(leftVal, rightVal))
+	case "<":
+		return nativeBoolToBooleanObject(leftVal.Cmp(rightVal) < 0)
+	case ">":
+		return nativeBoolToBooleanObject(leftVal.Cmp(rightVal) > 0)
+	case "<=":
+		return nativeBoolToBooleanObject(leftVal.Cmp(rightVal) <= 0)
+	case ">=":
+		return nativeBoolToBooleanObject(leftVal.Cmp(rightVal) >= 0)
+	case "&":
+		return normalizeBig(new(big.Int).And(leftVal, rightVal))
+	case "|":
+		return normalizeBig(new(big.Int).Or(leftVal, rightVal))
+	case "^":
+		return normalizeBig(new(big.Int).Xor(leftVal, rightVal))
+	case "<<", ">>":
+		return evalShiftExpression(operator, left, right)
+	case "==":
+		return nativeBoolToBooleanObject(leftVal.Cmp(rightVal) == 0)
+	case "!=":
+		return nativeBoolToBooleanObject(leftVal.Cmp(rightVal) != 0)
+	default:
+		return newError(ErrUnknownOperator, "unknown operator: %s %s %s",
+			left.Type(), operator, right.Type())
+	}
+}
+
+// 左移的最大位数 防止构造过大的整数耗尽内存
+const maxShiftCount = 1 << 20
+
+// 计算移位运算 位运算按补码进行 左移溢出时提升为大整数
+// 右移的位数不受限制 超出整数的位数时结果为0或-1
+func evalShiftExpression(operator string, left, right object.Object) object.Object {
+	var n uint
+	switch count := right.(type) {
+	case *object.Integer:
+		if count.Value < 0 {
+			return newError(ErrInvalidValue, "negative shift count: %d", count.Value)
+		}
+		n = uint(count.Value)
+	case *object.BigInt:
+		if count.Value.Sign() < 0 {
+			return newError(ErrInvalidValue, "negative shift count: %s", count.Value)
+		}
+		n = math.MaxUint
+	default:
+		return newError(ErrTypeMismatch, "type mismatch: %s %s %s",
+			left.Type(), operator, right.Type())
+	}
+	if operator == "<<" && n > maxShiftCount {
+		return newError(ErrInvalidValue, "shift count too large: %s (limit %d)", right.Inspect(), maxShiftCount)
+	}
+
+	if value, ok := left.(*object.Integer); ok {
+		if operator == ">>" {
+			return &object.Integer{Value: value.Value >> n}
+		}
+		// 移回后与原值相同说明没有溢出
+		if shifted := value.Value << n; shifted>>n == value.Value {
+			return &object.Integer{Value: shifted}
+		}
+	}
+	if operator == ">>" {
+		return normalizeBig(new(big.Int).Rsh(toBig(left), n))
+	}
+	return normalizeBig(new(big.Int).Lsh(toBig(left), n))
+}
@@ -0,0 +1,92 @@
+package evaluator
+
+import (
+	"bamboo/object"
+	"bamboo/token"
+	"sort"
+)
+
+// 下面导出的函数供字节码虚拟机复用求值器的运算语义
+// 两种执行方式共用同一套运算规则和内置函数 保证求值结果一致
+
+// EvalInfix 计算中缀运算
+func EvalInfix(operator string, left, right object.Object) object.Object {
+	return evalInfixExpression(operator, left, right)
+}
+
+// EvalPrefix 计算前缀运算
+func EvalPrefix(operator string, right object.Object) object.Object {
+	return evalPrefixExpression(operator, right)
+}
+
+// EvalIndex 计算索引运算
+func EvalIndex(left, index object.Object) object.Object {
+	return evalIndexExpression(left, index)
+}
+
+// SetIndex 修改数组的元素或哈希表中键对应的值
+func SetIndex(left, index, val object.Object) object.Object {
+	return setIndex(left, index, val)
+}
+
+// EvalSlice 计算切片 省略的起止位置和步长为NULL
+func EvalSlice(left, start, stop, step object.Object) object.Object {
+	return slice(left, start, stop, step)
+}
+
+// AddInt 带溢出检查的整数加法 溢出时ok为false
+func AddInt(a, b int64) (int64, bool) {
+	return addInt(a, b)
+}
+
+// SubInt 带溢出检查的整数减法 溢出时ok为false
+func SubInt(a, b int64) (int64, bool) {
+	return subInt(a, b)
+}
+
+// MulInt 带溢出检查的整数乘法 溢出时ok为false
+func MulInt(a, b int64) (int64, bool) {
+	return mulInt(a, b)
+}
+
+// ArityError 检查调用函数时的实参个数 个数正确时返回nil
+// min为必须传入的实参个数 max为最多接受的实参个数 有剩余参数时max为-1
+func ArityError(name string, min, max, got int) *object.Error {
+	return arityError(name, min, max, got)
+}
+
+// TailFrame 记录尾调用的调用栈帧 prev为同一调用帧中之前的尾调用
+func TailFrame(prev *object.Frame, name string, span token.Span) *object.Frame {
+	return tailFrame(prev, name, span)
+}
+
+// Spread 将可迭代对象的各个值收集到数组中 用于展开实参
+func Spread(obj object.Object) object.Object {
+	return spread(obj)
+}
+
+// IsTruthy 判断对象在条件中是否为真
+func IsTruthy(obj object.Object) bool {
+	return isTruthy(obj)
+}
+
+// NewError 创建带有错误代码的错误对象
+func NewError(code string, format string, a ...interface{}) *object.Error {
+	return newError(code, format, a...)
+}
+
+// BuiltinNames 按字典序返回所有内置函数的名称
+func BuiltinNames() []string {
+	names := make([]string, 0, len(builtins))
+	for name := range builtins {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// LookupBuiltin 按名称查找内置函数
+func LookupBuiltin(name string) (*object.Builtin, bool) {
+	builtin, ok := builtins[name]
+	return builtin, ok
+}
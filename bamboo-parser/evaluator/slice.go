@@ -0,0 +1,125 @@
+package evaluator
+
+import (
+	"bamboo/ast"
+	"bamboo/object"
+)
+
+// 切片的规则与Python相同
+// a[start:stop:step] 依次取出下标为start start+step ... 的元素 不包含stop
+// 负数位置从末尾开始计数 越界的位置截断到有效范围内 步长为负数时从后向前取
+// 省略的部分或NULL取默认值: 步长为1 起止位置为整个序列
+
+// 求值切片表达式
+func evalSliceExpression(node *ast.SliceExpression, env *object.Environment) object.Object {
+	left := Eval(node.Left, env)
+	if interrupts(left) || left == skipChain {
+		return left
+	}
+	if node.Optional && left == NULL {
+		return skipChain
+	}
+
+	bounds := []object.Object{NULL, NULL, NULL}
+	for i, expr := range []ast.Expression{node.Start, node.Stop, node.Step} {
+		if expr == nil {
+			continue
+		}
+		bounds[i] = Eval(expr, env)
+		if interrupts(bounds[i]) {
+			return bounds[i]
+		}
+	}
+	return slice(left, bounds[0], bounds[1], bounds[2])
+}
+
+// 对数组或字符串切片 字符串按字符切片
+func slice(left, start, stop, step object.Object) object.Object {
+	switch left := left.(type) {
+	case *object.Array:
+		indices, err := sliceIndices(len(left.Elements), start, stop, step)
+		if err != nil {
+			return err
+		}
+		elements := make([]object.Object, len(indices))
+		for i, idx := range indices {
+			elements[i] = left.Elements[idx]
+		}
+		return &object.Array{Elements: elements}
+	case *object.String:
+		chars := []rune(left.Value)
+		indices, err := sliceIndices(len(chars), start, stop, step)
+		if err != nil {
+			return err
+		}
+		result := make([]rune, len(indices))
+		for i, idx := range indices {
+			result[i] = chars[idx]
+		}
+		return &object.String{Value: string(result)}
+	default:
+		return newError(ErrIndexUnsupported, "slice operator not supported: %s", left.Type())
+	}
+}
+
+// 计算切片依次取出的下标 length为序列的长度
+func sliceIndices(length int, start, stop, step object.Object) ([]int, *object.Error) {
+	values := []int64{0, 0, 1}
+	given := []bool{false, false, false}
+	for i, bound := range []object.Object{start, stop, step} {
+		switch bound := bound.(type) {
+		case *object.Integer:
+			values[i], given[i] = bound.Value, true
+		case *object.Null:
+		default:
+			return nil, newError(ErrIndexUnsupported, "slice indices must be INTEGER or NULL, got %s", bound.Type())
+		}
+	}
+
+	n := int64(length)
+	inc := values[2]
+	if inc == 0 {
+		return nil, newError(ErrInvalidValue, "slice step cannot be zero")
+	}
+	// 步长的绝对值超过长度时最多取出一个元素 截断以免计算时溢出
+	if inc > n+1 {
+		inc = n + 1
+	} else if inc < -(n + 1) {
+		inc = -(n + 1)
+	}
+
+	// 截断到有效范围 步长为负数时-1表示第一个元素之前
+	lower, upper := int64(0), n
+	if inc < 0 {
+		lower, upper = -1, n-1
+	}
+	adjust := func(v int64) int64 {
+		if v < 0 {
+			v += n
+			if v < lower {
+				v = lower
+			}
+		} else if v > upper {
+			v = upper
+		}
+		return v
+	}
+
+	// 省略起止位置时取整个序列
+	from, to := lower, upper
+	if inc < 0 {
+		from, to = upper, lower
+	}
+	if given[0] {
+		from = adjust(values[0])
+	}
+	if given[1] {
+		to = adjust(values[1])
+	}
+
+	var indices []int
+	for i := from; (inc > 0 && i < to) || (inc < 0 && i > to); i += inc {
+		indices = append(indices, int(i))
+	}
+	return indices, nil
+}
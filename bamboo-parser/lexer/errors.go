@@ -0,0 +1,10 @@
+package lexer
+
+// 词法错误代码
+const (
+	ErrUnterminatedComment = "L0001" // 块注释没有闭合
+	ErrUnterminatedString  = "L0002" // 字符串没有闭合
+	ErrInvalidEscape       = "L0003" // 无法识别的转义序列
+	ErrInvalidUTF8         = "L0004" // 源代码不是合法的UTF-8编码
+	ErrInvalidNumber       = "L0005" // 格式错误的数字字面量
+)
@@ -1,39 +1,94 @@
 package lexer
 
-import "bamboo/token"
+import (
+	"bamboo/diagnostic"
+	"bamboo/token"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
 
 // 词法分析是解释器要做的第一件事 lexical analysis
 // 词法分析器读入组成源程序的字符流 将其组织成有意义的lexeme序列
 // 对于每个lexeme 分析器将产生如下形式的token: <token-type,token-Literal>
 // 所产生的token被传给下一步骤: 语法分析
 // 同时 该步骤要过滤源程序中的注释和空白 将错误消息与源程序的位置联系起来
+// 源程序以UTF-8编码 词法分析器逐个读取字符(rune) 列号按字符计数
 
 type Lexer struct {
 	input        string
-	position     int  // 输入字符串的当前位置
-	readPosition int  // 当前字符下一个字符
-	ch           byte // 当前字符
+	filename     string // 源文件名 用于错误定位
+	position     int    // 输入字符串的当前位置
+	readPosition int    // 当前字符下一个字符
+	ch           rune   // 当前字符
+	line         int    // 当前字符所在行 从1开始
+	column       int    // 当前字符所在列 从1开始
+	invalid      bool   // 当前字符是非法的UTF-8编码 已记录错误 按空白跳过
+
+	keepComments bool                     // 是否将注释作为词法单元返回
+	errors       []*diagnostic.Diagnostic // 词法错误
 }
 
 // New 创建词法分析器
 func New(input string) *Lexer {
-	lexer := &Lexer{input: input}
+	return NewFile("", input)
+}
+
+// NewFile 创建词法分析器 并记录源文件名
+func NewFile(filename, input string) *Lexer {
+	lexer := &Lexer{input: input, filename: filename, line: 1}
 	lexer.readChar()
+	// 跳过开头的字节顺序标记
+	if lexer.ch == '\uFEFF' {
+		lexer.readChar()
+		lexer.column = 1
+	}
 	return lexer
 }
 
+// KeepComments 设置是否将注释作为COMMENT词法单元返回 默认跳过注释
+// 格式化和文档等工具可以借此保留注释
+func (lexer *Lexer) KeepComments(keep bool) {
+	lexer.keepComments = keep
+}
+
+// Errors 返回词法错误 出错时词法分析器仍会继续产生词法单元
+func (lexer *Lexer) Errors() []*diagnostic.Diagnostic {
+	return lexer.errors
+}
+
 // 读取input下一个字符 并前移在input中的位置
 func (lexer *Lexer) readChar() {
-	// 检查是否已经到达input末尾
-	if lexer.readPosition >= len(lexer.input) {
-		lexer.ch = 0
-	} else {
-		lexer.ch = lexer.input[lexer.readPosition]
+	// 已越过input末尾 位置不再前移
+	if lexer.readPosition > len(lexer.input) {
+		return
+	}
+	// 离开换行符时 行号加一 列号归零
+	if lexer.ch == '\n' {
+		lexer.line++
+		lexer.column = 0
 	}
+	lexer.column++
 	// 更新位置 readPosition始终指向下一个将读取的字符位置
 	// position始终指向刚刚读取的位置
 	lexer.position = lexer.readPosition
-	lexer.readPosition += 1
+	lexer.invalid = false
+	// 检查是否已经到达input末尾
+	if lexer.readPosition >= len(lexer.input) {
+		lexer.ch = 0
+		lexer.readPosition += 1
+		return
+	}
+	ch, width := utf8.DecodeRuneInString(lexer.input[lexer.readPosition:])
+	if ch == utf8.RuneError && width == 1 {
+		lexer.invalid = true
+		start := lexer.pos()
+		end := token.Position{Filename: start.Filename, Offset: start.Offset + 1, Line: start.Line, Column: start.Column + 1}
+		lexer.errors = append(lexer.errors, diagnostic.New(ErrInvalidUTF8, token.Span{Start: start, End: end},
+			"invalid UTF-8 encoding: byte 0x%02x", lexer.input[lexer.position]))
+	}
+	lexer.ch = ch
+	lexer.readPosition += width
 }
 
 // NextToken 检查当前正在查看的字符
@@ -41,38 +96,99 @@ func (lexer *Lexer) readChar() {
 func (lexer *Lexer) NextToken() token.Token {
 	var tok token.Token
 	lexer.skipWhiteSpace()
+	if lexer.atComment() {
+		return lexer.readComment()
+	}
+	start := lexer.pos()
 
 	switch lexer.ch {
 	case '=':
 		if lexer.peekChar() == '=' {
-			ch := lexer.ch
-			lexer.readChar()
-			literal := string(ch) + string(lexer.ch)
-			tok = token.Token{Type: token.EQ, Literal: literal}
+			tok = lexer.readTwoCharToken(token.EQ)
 		} else {
 			tok = newToken(token.ASSIGN, lexer.ch)
 		}
 	case '+':
-		tok = newToken(token.PLUS, lexer.ch)
+		if lexer.peekChar() == '=' {
+			tok = lexer.readTwoCharToken(token.PLUS_ASSIGN)
+		} else {
+			tok = newToken(token.PLUS, lexer.ch)
+		}
 	case '-':
-		tok = newToken(token.MINUS, lexer.ch)
+		if lexer.peekChar() == '=' {
+			tok = lexer.readTwoCharToken(token.MINUS_ASSIGN)
+		} else {
+			tok = newToken(token.MINUS, lexer.ch)
+		}
 	case '!':
 		if lexer.peekChar() == '=' {
-			ch := lexer.ch
-			lexer.readChar()
-			literal := string(ch) + string(lexer.ch)
-			tok = token.Token{Type: token.NOT_EQ, Literal: literal}
+			tok = lexer.readTwoCharToken(token.NOT_EQ)
 		} else {
 			tok = newToken(token.BANG, lexer.ch)
 		}
 	case '/':
-		tok = newToken(token.SLASH, lexer.ch)
+		if lexer.peekChar() == '=' {
+			tok = lexer.readTwoCharToken(token.SLASH_ASSIGN)
+		} else {
+			tok = newToken(token.SLASH, lexer.ch)
+		}
 	case '*':
-		tok = newToken(token.ASTERISK, lexer.ch)
+		if lexer.peekChar() == '=' {
+			tok = lexer.readTwoCharToken(token.ASTERISK_ASSIGN)
+		} else {
+			tok = newToken(token.ASTERISK, lexer.ch)
+		}
+	case '%':
+		if lexer.peekChar() == '=' {
+			tok = lexer.readTwoCharToken(token.PERCENT_ASSIGN)
+		} else {
+			tok = newToken(token.PERCENT, lexer.ch)
+		}
 	case '<':
-		tok = newToken(token.LT, lexer.ch)
+		switch lexer.peekChar() {
+		case '=':
+			tok = lexer.readTwoCharToken(token.LT_EQ)
+		case '<':
+			tok = lexer.readTwoCharToken(token.SHL)
+		default:
+			tok = newToken(token.LT, lexer.ch)
+		}
 	case '>':
-		tok = newToken(token.GT, lexer.ch)
+		switch lexer.peekChar() {
+		case '=':
+			tok = lexer.readTwoCharToken(token.GT_EQ)
+		case '>':
+			tok = lexer.readTwoCharToken(token.SHR)
+		default:
+			tok = newToken(token.GT, lexer.ch)
+		}
+	case '&':
+		if lexer.peekChar() == '&' {
+			tok = lexer.readTwoCharToken(token.AND)
+		} else {
+			tok = newToken(token.BIT_AND, lexer.ch)
+		}
+	case '|':
+		if lexer.peekChar() == '|' {
+			tok = lexer.readTwoCharToken(token.OR)
+		} else {
+			tok = newToken(token.BIT_OR, lexer.ch)
+		}
+	case '?':
+		switch lexer.peekChar() {
+		case '.':
+			tok = lexer.readTwoCharToken(token.QUESTION_DOT)
+		case '[':
+			tok = lexer.readTwoCharToken(token.QUESTION_LBRACKET)
+		case '?':
+			tok = lexer.readTwoCharToken(token.NULLISH)
+		default:
+			tok = newToken(token.ILLEGAL, lexer.ch)
+		}
+	case '^':
+		tok = newToken(token.BIT_XOR, lexer.ch)
+	case '~':
+		tok = newToken(token.BIT_NOT, lexer.ch)
 	case ';':
 		tok = newToken(token.SEMICOLON, lexer.ch)
 	case '(':
@@ -85,15 +201,29 @@ func (lexer *Lexer) NextToken() token.Token {
 		tok = newToken(token.LBRACE, lexer.ch)
 	case '}':
 		tok = newToken(token.RBRACE, lexer.ch)
-	case '"':
+	case '"', '`':
 		tok.Type = token.STRING
 		tok.Literal = lexer.readString()
+		tok.Span = lexer.spanFrom(start)
+		return tok
 	case '[':
 		tok = newToken(token.LBRACKET, lexer.ch)
 	case ']':
 		tok = newToken(token.RBRACKET, lexer.ch)
 	case ':':
 		tok = newToken(token.COLON, lexer.ch)
+	case '.':
+		if strings.HasPrefix(lexer.input[lexer.position:], "...") {
+			lexer.readChar()
+			lexer.readChar()
+			tok = token.Token{Type: token.ELLIPSIS, Literal: "..."}
+		} else if isDigit(lexer.peekChar()) {
+			tok.Type, tok.Literal = lexer.readNumber()
+			tok.Span = lexer.spanFrom(start)
+			return tok
+		} else {
+			tok = newToken(token.ILLEGAL, lexer.ch)
+		}
 	case 0:
 		tok.Literal = ""
 		tok.Type = token.EOF
@@ -101,80 +231,462 @@ func (lexer *Lexer) NextToken() token.Token {
 		if isLetter(lexer.ch) {
 			tok.Literal = lexer.readIdentifier()
 			tok.Type = token.LookupIdent(tok.Literal)
+			tok.Span = lexer.spanFrom(start)
 			return tok
 		} else if isDigit(lexer.ch) {
-			tok.Type = token.INT
-			tok.Literal = lexer.readNumber()
+			tok.Type, tok.Literal = lexer.readNumber()
+			tok.Span = lexer.spanFrom(start)
 			return tok
 		} else {
 			tok = newToken(token.ILLEGAL, lexer.ch)
 		}
 	}
 	lexer.readChar()
+	tok.Span = lexer.spanFrom(start)
 	return tok
 }
 
-func newToken(tokenType token.Type, ch byte) token.Token {
+// 读取由当前字符和下一个字符组成的词法单元 eg. == <=
+func (lexer *Lexer) readTwoCharToken(tokenType token.Type) token.Token {
+	ch := lexer.ch
+	lexer.readChar()
+	literal := string(ch) + string(lexer.ch)
+	return token.Token{Type: tokenType, Literal: literal}
+}
+
+// 返回当前字符的位置
+func (lexer *Lexer) pos() token.Position {
+	return token.Position{
+		Filename: lexer.filename,
+		Offset:   lexer.position,
+		Line:     lexer.line,
+		Column:   lexer.column,
+	}
+}
+
+// 返回从start到当前字符(不包含)的区间
+func (lexer *Lexer) spanFrom(start token.Position) token.Span {
+	return token.Span{Start: start, End: lexer.pos()}
+}
+
+func newToken(tokenType token.Type, ch rune) token.Token {
 	return token.Token{Type: tokenType, Literal: string(ch)}
 }
 
 // 读入一个标识符并前移词法分析器的扫描位置
 func (lexer *Lexer) readIdentifier() string {
 	position := lexer.position
-	// 遇见非字母字符时停止
-	for isLetter(lexer.ch) {
+	// 遇见不能构成标识符的字符时停止
+	for isIdentifierPart(lexer.ch) {
 		lexer.readChar()
 	}
 	return lexer.input[position:lexer.position]
 }
 
-// 跳过空白字符
+// 跳过空白字符 不保留注释时一并跳过注释
 func (lexer *Lexer) skipWhiteSpace() {
-	for lexer.ch == ' ' || lexer.ch == '\t' || lexer.ch == '\n' || lexer.ch == '\r' {
-		lexer.readChar()
+	for {
+		for lexer.ch == ' ' || lexer.ch == '\t' || lexer.ch == '\n' || lexer.ch == '\r' || lexer.invalid {
+			lexer.readChar()
+		}
+		if lexer.keepComments || !lexer.atComment() {
+			return
+		}
+		lexer.readComment()
 	}
 }
 
-// 读取整数
-func (lexer *Lexer) readNumber() string {
+// 判断当前字符是否为注释的开头
+// 行注释: // #  块注释: /* */
+func (lexer *Lexer) atComment() bool {
+	return lexer.ch == '#' || lexer.ch == '/' && (lexer.peekChar() == '/' || lexer.peekChar() == '*')
+}
+
+// 读取一条注释 字面量包括注释符号
+// 行注释到行尾为止 不包含换行符
+func (lexer *Lexer) readComment() token.Token {
+	start := lexer.pos()
+	if lexer.ch == '/' && lexer.peekChar() == '*' {
+		lexer.readBlockComment()
+	} else {
+		for lexer.ch != '\n' && lexer.ch != 0 {
+			lexer.readChar()
+		}
+	}
+	return token.Token{
+		Type:    token.COMMENT,
+		Literal: lexer.input[start.Offset:lexer.position],
+		Span:    lexer.spanFrom(start),
+	}
+}
+
+// 读取块注释 块注释可以嵌套 eg. /* a /* b */ c */
+// 直到输入结束仍未闭合时记录错误
+func (lexer *Lexer) readBlockComment() {
+	var opens []token.Span // 尚未闭合的"/*"
+	for {
+		switch {
+		case lexer.ch == '/' && lexer.peekChar() == '*':
+			start := lexer.pos()
+			lexer.readChar()
+			lexer.readChar()
+			opens = append(opens, lexer.spanFrom(start))
+		case lexer.ch == '*' && lexer.peekChar() == '/':
+			lexer.readChar()
+			lexer.readChar()
+			opens = opens[:len(opens)-1]
+			if len(opens) == 0 {
+				return
+			}
+		case lexer.ch == 0:
+			end := lexer.pos()
+			d := diagnostic.New(ErrUnterminatedComment, opens[0], "unterminated block comment")
+			if len(opens) > 1 {
+				d.WithRelated(opens[len(opens)-1], "nested comment opened here is not closed")
+			}
+			d.WithFix(token.Span{Start: end, End: end}, strings.Repeat("*/", len(opens)), "close the comment")
+			lexer.errors = append(lexer.errors, d)
+			return
+		default:
+			lexer.readChar()
+		}
+	}
+}
+
+// 读取数字 返回数字的类型和字面量
+// 整数: 123  0xFF  0o755  0b1010  浮点数: 3.14 .5 1e-9 2.5E3
+// 数字之间可以用下划线分隔 eg. 1_000_000  0xFF_FF
+// 格式错误的字面量整体作为一个词法单元 并记录错误 eg. 0x  12abc  1__0
+func (lexer *Lexer) readNumber() (token.Type, string) {
+	start := lexer.pos()
+	if lexer.ch == '0' && strings.ContainsRune("xXoObB", lexer.peekChar()) {
+		lexer.readPrefixedNumber(start)
+		return token.INT, lexer.input[start.Offset:lexer.position]
+	}
+
 	position := lexer.position
-	for isDigit(lexer.ch) {
+	var tokenType token.Type = token.INT
+
+	lexer.readDigits()
+
+	// 小数部分
+	if lexer.ch == '.' && isDigit(lexer.peekChar()) {
+		tokenType = token.FLOAT
 		lexer.readChar()
+		lexer.readDigits()
 	}
-	return lexer.input[position:lexer.position]
+
+	// 指数部分 e之后必须是数字或带符号的数字
+	if lexer.ch == 'e' || lexer.ch == 'E' {
+		next := lexer.peekCharAt(1)
+		if isDigit(next) || (next == '+' || next == '-') && isDigit(lexer.peekCharAt(2)) {
+			tokenType = token.FLOAT
+			lexer.readChar()
+			if lexer.ch == '+' || lexer.ch == '-' {
+				lexer.readChar()
+			}
+			lexer.readDigits()
+		}
+	}
+
+	// 紧跟在数字之后的字母
+	if isLetter(lexer.ch) || isMark(lexer.ch) {
+		suffix := lexer.pos()
+		for isIdentifierPart(lexer.ch) {
+			lexer.readChar()
+		}
+		lexer.numberError(lexer.spanFrom(suffix), "invalid suffix %q on number literal",
+			lexer.input[suffix.Offset:lexer.position])
+		return tokenType, lexer.input[position:lexer.position]
+	}
+
+	literal := lexer.input[position:lexer.position]
+	if !lexer.checkSeparators(literal, start, isDigit) {
+		return tokenType, literal
+	}
+	// 0755在许多语言中表示八进制 为避免歧义不允许十进制整数以0开头
+	if digits := strings.ReplaceAll(literal, "_", ""); tokenType == token.INT &&
+		len(digits) > 1 && digits[0] == '0' && strings.Trim(digits, "0") != "" {
+		lexer.numberError(lexer.spanFrom(start),
+			"leading zeros in decimal integer literals are not permitted; use a 0o prefix for octal")
+	}
+	return tokenType, literal
 }
 
-// 读取字符串
+// 读取带有进制前缀的整数 0x十六进制 0o八进制 0b二进制
+func (lexer *Lexer) readPrefixedNumber(start token.Position) {
+	var base rune
+	var name string
+	switch lexer.peekChar() {
+	case 'x', 'X':
+		base, name = 16, "hexadecimal"
+	case 'o', 'O':
+		base, name = 8, "octal"
+	default:
+		base, name = 2, "binary"
+	}
+	lexer.readChar()
+	lexer.readChar()
+
+	// 连同之后的字母一起读入 第一个不属于该进制的字符即为错误的位置
+	digits := 0
+	var invalid *token.Span
+	for isLetter(lexer.ch) || isMark(lexer.ch) || isDigit(lexer.ch) {
+		if lexer.ch != '_' {
+			if digitValue(lexer.ch) < base {
+				digits++
+			} else if invalid == nil {
+				at := lexer.pos()
+				lexer.readChar()
+				span := lexer.spanFrom(at)
+				invalid = &span
+				continue
+			}
+		}
+		lexer.readChar()
+	}
+
+	literal := lexer.input[start.Offset:lexer.position]
+	switch {
+	case invalid != nil:
+		lexer.numberError(*invalid, "invalid digit %q in %s literal",
+			lexer.input[invalid.Start.Offset:invalid.End.Offset], name)
+	case digits == 0:
+		lexer.numberError(lexer.spanFrom(start), "%s literal has no digits", name)
+	default:
+		lexer.checkSeparators(literal, start, func(ch rune) bool { return digitValue(ch) < base })
+	}
+}
+
+// 检查数字字面量中的下划线 下划线只能出现在两个数字之间或进制前缀与数字之间
+// start为字面量的起始位置 下划线有误时记录错误并返回false
+func (lexer *Lexer) checkSeparators(literal string, start token.Position, isDigit func(rune) bool) bool {
+	for i := 0; i < len(literal); i++ {
+		if literal[i] != '_' {
+			continue
+		}
+		prefix := i == 2 && literal[0] == '0' && !isDigit(rune(literal[1]))
+		if !(i > 0 && (isDigit(rune(literal[i-1])) || prefix)) ||
+			!(i+1 < len(literal) && isDigit(rune(literal[i+1]))) {
+			at := start
+			at.Offset += i
+			at.Column += i
+			end := at
+			end.Offset++
+			end.Column++
+			lexer.numberError(token.Span{Start: at, End: end}, "'_' must separate successive digits")
+			return false
+		}
+	}
+	return true
+}
+
+// 记录数字字面量的错误
+func (lexer *Lexer) numberError(span token.Span, format string, a ...interface{}) {
+	lexer.errors = append(lexer.errors, diagnostic.New(ErrInvalidNumber, span, format, a...))
+}
+
+// 读取连续的数字 数字之间可以有下划线
+func (lexer *Lexer) readDigits() {
+	for isDigit(lexer.ch) || lexer.ch == '_' {
+		lexer.readChar()
+	}
+}
+
+// 读取字符串 返回字符串的值 读取后当前字符为结束引号之后的字符
+// "..."      处理转义序列 不能跨行
+// """..."""  处理转义序列 可以跨行 紧跟在开头引号之后的换行不计入字符串
+// `...`      原始字符串 不处理转义序列 可以跨行
 func (lexer *Lexer) readString() string {
-	position := lexer.position + 1
+	start := lexer.pos()
+	quote := lexer.input[lexer.position : lexer.position+1]
+	if strings.HasPrefix(lexer.input[lexer.position:], `"""`) {
+		quote = `"""`
+	}
+	for range quote {
+		lexer.readChar()
+	}
+	multiline := quote != `"`
+	if quote == `"""` {
+		lexer.skipNewline()
+	}
+
+	var out strings.Builder
 	for {
+		switch {
+		case strings.HasPrefix(lexer.input[lexer.position:], quote):
+			for range quote {
+				lexer.readChar()
+			}
+			return out.String()
+		case lexer.ch == 0 || lexer.ch == '\n' && !multiline:
+			end := lexer.pos()
+			d := diagnostic.New(ErrUnterminatedString, lexer.spanFrom(start), "unterminated string literal")
+			d.WithFix(token.Span{Start: end, End: end}, quote, "close the string")
+			lexer.errors = append(lexer.errors, d)
+			return out.String()
+		case lexer.ch == '\\' && quote != "`":
+			lexer.readEscape(&out, multiline)
+		default:
+			out.WriteRune(lexer.ch)
+			lexer.readChar()
+		}
+	}
+}
+
+// 读取转义序列 将其表示的字符写入out
+// \n \t \r \0 \\ \" \' \u{1F600}
+// 多行字符串中 行末的反斜杠连同换行一起忽略
+func (lexer *Lexer) readEscape(out *strings.Builder, multiline bool) {
+	start := lexer.pos()
+	lexer.readChar()
+	switch lexer.ch {
+	case 'n':
+		out.WriteByte('\n')
+	case 't':
+		out.WriteByte('\t')
+	case 'r':
+		out.WriteByte('\r')
+	case '0':
+		out.WriteByte(0)
+	case '\\', '"', '\'':
+		out.WriteRune(lexer.ch)
+	case 'u':
+		lexer.readUnicodeEscape(out, start)
+		return
+	case '\r', '\n':
+		// 不能跨行的字符串由调用者报告未闭合
+		if multiline {
+			lexer.skipNewline()
+		}
+		return
+	case 0:
+		return
+	default:
 		lexer.readChar()
-		// 双引号和0为字符串的末尾
-		if lexer.ch == '"' || lexer.ch == 0 {
-			break
+		lexer.errors = append(lexer.errors, diagnostic.New(ErrInvalidEscape, lexer.spanFrom(start),
+			"unknown escape sequence: %s", lexer.input[start.Offset:lexer.position]))
+		return
+	}
+	lexer.readChar()
+}
+
+// 读取\u{...}形式的转义序列 花括号中为1到6位十六进制数
+// start为反斜杠的位置 当前字符为u
+func (lexer *Lexer) readUnicodeEscape(out *strings.Builder, start token.Position) {
+	lexer.readChar()
+	if lexer.ch != '{' {
+		lexer.errors = append(lexer.errors, diagnostic.New(ErrInvalidEscape, lexer.spanFrom(start),
+			"invalid unicode escape: expected \\u{...}"))
+		return
+	}
+	lexer.readChar()
+	var value rune
+	digits := 0
+	for isHexDigit(lexer.ch) {
+		if digits < 7 {
+			value = value<<4 | hexValue(lexer.ch)
 		}
+		digits++
+		lexer.readChar()
+	}
+	closed := lexer.ch == '}'
+	if closed {
+		lexer.readChar()
+	}
+	switch {
+	case !closed || digits == 0:
+		lexer.errors = append(lexer.errors, diagnostic.New(ErrInvalidEscape, lexer.spanFrom(start),
+			"invalid unicode escape: expected 1 to 6 hex digits in braces"))
+	case digits > 6 || !utf8.ValidRune(value):
+		lexer.errors = append(lexer.errors, diagnostic.New(ErrInvalidEscape, lexer.spanFrom(start),
+			"invalid unicode code point: %s", lexer.input[start.Offset:lexer.position]))
+	default:
+		out.WriteRune(value)
+	}
+}
+
+// 跳过一个换行 \r\n视为一个换行
+func (lexer *Lexer) skipNewline() {
+	if lexer.ch == '\r' && lexer.peekChar() == '\n' {
+		lexer.readChar()
+	}
+	if lexer.ch == '\n' {
+		lexer.readChar()
 	}
-	return lexer.input[position:lexer.position]
 }
 
 // 读取下一个字符但不前移
-func (lexer *Lexer) peekChar() byte {
+func (lexer *Lexer) peekChar() rune {
 	if lexer.readPosition >= len(lexer.input) {
 		return 0
-	} else {
-		return lexer.input[lexer.readPosition]
 	}
+	ch, _ := utf8.DecodeRuneInString(lexer.input[lexer.readPosition:])
+	return ch
+}
+
+// 读取当前字符之后第n个字符但不前移
+func (lexer *Lexer) peekCharAt(n int) rune {
+	pos := lexer.position
+	for i := 0; i < n && pos < len(lexer.input); i++ {
+		_, width := utf8.DecodeRuneInString(lexer.input[pos:])
+		pos += width
+	}
+	if pos >= len(lexer.input) {
+		return 0
+	}
+	ch, _ := utf8.DecodeRuneInString(lexer.input[pos:])
+	return ch
+}
+
+// 标识符的规则:
+// 以Unicode字母(类别L)或下划线开头 之后可以是字母 下划线 数字(类别Nd)或组合用字符(类别Mn Mc)
+// eg. count  _tmp  c1  蚌埠  变量2  café  नमस्ते
+// 判断给定的参数是否为字母 下划线视为字母
+func isLetter(ch rune) bool {
+	return 'a' <= ch && ch <= 'z' || 'A' <= ch && ch <= 'Z' || ch == '_' ||
+		ch >= utf8.RuneSelf && unicode.IsLetter(ch)
 }
 
-// 判断给定的参数是否为字母
-func isLetter(ch byte) bool {
-	return 'a' <= ch && ch <= 'z' || 'A' <= ch && ch <= 'Z' || ch == '_'
+// 判断给定的参数是否为组合用字符 如重音符号 只能出现在标识符的中间
+func isMark(ch rune) bool {
+	return ch >= utf8.RuneSelf && unicode.In(ch, unicode.Mn, unicode.Mc)
+}
+
+// 判断给定的参数能否出现在标识符的首字符之后
+func isIdentifierPart(ch rune) bool {
+	return isLetter(ch) || isMark(ch) || isDigit(ch) || ch >= utf8.RuneSelf && unicode.IsDigit(ch)
 }
 
 // 判断给定参数是否为数字
-func isDigit(ch byte) bool {
+func isDigit(ch rune) bool {
 	return '0' <= ch && ch <= '9'
 }
 
+// 判断给定参数是否为十六进制数字
+func isHexDigit(ch rune) bool {
+	return isDigit(ch) || 'a' <= ch && ch <= 'f' || 'A' <= ch && ch <= 'F'
+}
+
+// 返回字符作为数字的值 不是数字时返回一个大于任何进制的值
+func digitValue(ch rune) rune {
+	if isHexDigit(ch) {
+		return hexValue(ch)
+	}
+	return 36
+}
+
+// 返回十六进制数字的值
+func hexValue(ch rune) rune {
+	switch {
+	case isDigit(ch):
+		return ch - '0'
+	case 'a' <= ch && ch <= 'f':
+		return ch - 'a' + 10
+	default:
+		return ch - 'A' + 10
+	}
+}
+
 // 由上述定义的程序 解析一条语句:
 // let x = 1  ---> <LET,"let"> <IDENT,"x"> <ASSIGN,"="> <INT,1>
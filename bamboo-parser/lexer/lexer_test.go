@@ -0,0 +1,310 @@
+package lexer
+
+import (
+	"bamboo/diagnostic"
+	"bamboo/token"
+	"fmt"
+	"testing"
+)
+
+// 期望的词法单元 span为"起始行:列-结束行:列"
+type expectedToken struct {
+	typ     token.Type
+	literal string
+	span    string
+}
+
+// 读取全部词法单元 直到EOF(不包含)
+func lexAll(lexer *Lexer) ([]token.Token, []*diagnostic.Diagnostic) {
+	var tokens []token.Token
+	for {
+		tok := lexer.NextToken()
+		if tok.Type == token.EOF {
+			return tokens, lexer.Errors()
+		}
+		tokens = append(tokens, tok)
+	}
+}
+
+func spanString(span token.Span) string {
+	return fmt.Sprintf("%d:%d-%d:%d", span.Start.Line, span.Start.Column, span.End.Line, span.End.Column)
+}
+
+func testTokens(t *testing.T, input string, tokens []token.Token, expected []expectedToken) {
+	t.Helper()
+	if len(tokens) != len(expected) {
+		t.Errorf("%q: wrong number of tokens. got=%d, want=%d (%v)", input, len(tokens), len(expected), tokens)
+		return
+	}
+	for i, want := range expected {
+		tok := tokens[i]
+		if tok.Type != want.typ || tok.Literal != want.literal {
+			t.Errorf("%q: token %d wrong. got=%s %q, want=%s %q", input, i, tok.Type, tok.Literal, want.typ, want.literal)
+		}
+		if got := spanString(tok.Span); got != want.span {
+			t.Errorf("%q: token %d (%q) wrong span. got=%s, want=%s", input, i, tok.Literal, got, want.span)
+		}
+	}
+}
+
+// 检查只有一个错误 且错误代码和区间符合预期
+func testSingleError(t *testing.T, input string, errs []*diagnostic.Diagnostic, code, span string) {
+	t.Helper()
+	if len(errs) != 1 {
+		t.Errorf("%q: expected one %s error. got=%v", input, code, errs)
+		return
+	}
+	if errs[0].Code != code {
+		t.Errorf("%q: wrong error code. got=%s (%s), want=%s", input, errs[0].Code, errs[0].Message, code)
+	}
+	if got := spanString(errs[0].Span); got != span {
+		t.Errorf("%q: wrong error span. got=%s, want=%s", input, got, span)
+	}
+}
+
+func TestComments(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected []expectedToken
+	}{
+		{
+			"// line comment\nlet a = 6; # hash comment\na / 2;",
+			[]expectedToken{
+				{token.LET, "let", "2:1-2:4"},
+				{token.IDENT, "a", "2:5-2:6"},
+				{token.ASSIGN, "=", "2:7-2:8"},
+				{token.INT, "6", "2:9-2:10"},
+				{token.SEMICOLON, ";", "2:10-2:11"},
+				{token.IDENT, "a", "3:1-3:2"},
+				{token.SLASH, "/", "3:3-3:4"},
+				{token.INT, "2", "3:5-3:6"},
+				{token.SEMICOLON, ";", "3:6-3:7"},
+			},
+		},
+		{
+			"a /* inline */ + 2",
+			[]expectedToken{
+				{token.IDENT, "a", "1:1-1:2"},
+				{token.PLUS, "+", "1:16-1:17"},
+				{token.INT, "2", "1:18-1:19"},
+			},
+		},
+		{
+			"/* outer /* nested */ still a comment */ 7",
+			[]expectedToken{{token.INT, "7", "1:42-1:43"}},
+		},
+		{
+			"a // 2\n;",
+			[]expectedToken{
+				{token.IDENT, "a", "1:1-1:2"},
+				{token.SEMICOLON, ";", "2:1-2:2"},
+			},
+		},
+		{
+			"#!/usr/bin/env bamboo\n1",
+			[]expectedToken{{token.INT, "1", "2:1-2:2"}},
+		},
+	}
+
+	for _, tt := range tests {
+		tokens, errs := lexAll(New(tt.input))
+		if len(errs) != 0 {
+			t.Errorf("%q: unexpected errors: %v", tt.input, errs)
+		}
+		testTokens(t, tt.input, tokens, tt.expected)
+	}
+
+	// 保留注释时 注释作为词法单元产生 字面量包括注释符号
+	input := "# a\nx /* b /* c */ */ // d"
+	lexer := New(input)
+	lexer.KeepComments(true)
+	tokens, _ := lexAll(lexer)
+	testTokens(t, input, tokens, []expectedToken{
+		{token.COMMENT, "# a", "1:1-1:4"},
+		{token.IDENT, "x", "2:1-2:2"},
+		{token.COMMENT, "/* b /* c */ */", "2:3-2:18"},
+		{token.COMMENT, "// d", "2:19-2:23"},
+	})
+
+	// 未闭合的块注释 错误位于最外层的"/*"
+	input = "let a = 1; /* a /* b */"
+	_, errs := lexAll(New(input))
+	testSingleError(t, input, errs, ErrUnterminatedComment, "1:12-1:14")
+}
+
+func TestStringLiterals(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected []expectedToken
+	}{
+		{`"a\tb\nc"`, []expectedToken{{token.STRING, "a\tb\nc", "1:1-1:10"}}},
+		{`"say \"hi\" \\ 'x' \'y\'"`, []expectedToken{{token.STRING, `say "hi" \ 'x' 'y'`, "1:1-1:26"}}},
+		{`"\u{48}\u{1F600}"`, []expectedToken{{token.STRING, "H\U0001F600", "1:1-1:18"}}},
+		{"`raw \\n \"q\"`", []expectedToken{{token.STRING, `raw \n "q"`, "1:1-1:13"}}},
+		{"`two\nlines`", []expectedToken{{token.STRING, "two\nlines", "1:1-2:7"}}},
+		{
+			"\"\"\"\nfirst\n  \"second\"\\t\\\nthird\"\"\"",
+			[]expectedToken{{token.STRING, "first\n  \"second\"\tthird", "1:1-4:9"}},
+		},
+		{`"" "x"`, []expectedToken{{token.STRING, "", "1:1-1:3"}, {token.STRING, "x", "1:4-1:7"}}},
+	}
+
+	for _, tt := range tests {
+		tokens, errs := lexAll(New(tt.input))
+		if len(errs) != 0 {
+			t.Errorf("%q: unexpected errors: %v", tt.input, errs)
+		}
+		testTokens(t, tt.input, tokens, tt.expected)
+	}
+
+	errors := []struct {
+		input string
+		code  string
+		span  string
+	}{
+		{"let a = \"abc;\nlet b = 1;", ErrUnterminatedString, "1:9-1:14"},
+		{"`open", ErrUnterminatedString, "1:1-1:6"},
+		{`"""never closed"`, ErrUnterminatedString, "1:1-1:17"},
+		{`"\q"`, ErrInvalidEscape, "1:2-1:4"},
+		{`"\u{110000}"`, ErrInvalidEscape, "1:2-1:12"},
+		{`"\u41"`, ErrInvalidEscape, "1:2-1:4"},
+	}
+
+	for _, tt := range errors {
+		_, errs := lexAll(New(tt.input))
+		testSingleError(t, tt.input, errs, tt.code, tt.span)
+	}
+
+	// 未闭合的普通字符串在行尾结束 之后的代码仍正常读取
+	tokens, _ := lexAll(New("let a = \"abc;\nlet b = 1;"))
+	if last := tokens[len(tokens)-1]; last.Type != token.SEMICOLON || spanString(last.Span) != "2:10-2:11" {
+		t.Errorf("lexing did not resume after unterminated string. got=%s %s", last.Type, spanString(last.Span))
+	}
+}
+
+// 列号按字符计数 偏移量按字节计数
+func TestUnicode(t *testing.T) {
+	input := "let 蚌埠 = café;\nfunc 加(甲) { naïve }"
+	tokens, errs := lexAll(New(input))
+	if len(errs) != 0 {
+		t.Errorf("%q: unexpected errors: %v", input, errs)
+	}
+	testTokens(t, input, tokens, []expectedToken{
+		{token.LET, "let", "1:1-1:4"},
+		{token.IDENT, "蚌埠", "1:5-1:7"},
+		{token.ASSIGN, "=", "1:8-1:9"},
+		{token.IDENT, "café", "1:10-1:14"},
+		{token.SEMICOLON, ";", "1:14-1:15"},
+		{token.FUNCTION, "func", "2:1-2:5"},
+		{token.IDENT, "加", "2:6-2:7"},
+		{token.LPAREN, "(", "2:7-2:8"},
+		{token.IDENT, "甲", "2:8-2:9"},
+		{token.RPAREN, ")", "2:9-2:10"},
+		{token.LBRACE, "{", "2:11-2:12"},
+		{token.IDENT, "naïve", "2:13-2:18"},
+		{token.RBRACE, "}", "2:19-2:20"},
+	})
+	if offset := tokens[3].Span.Start.Offset; offset != 13 {
+		t.Errorf("wrong byte offset of %q. got=%d, want=13", tokens[3].Literal, offset)
+	}
+
+	// 首字符之后可以是数字
+	input = "let c1 = 变量2 + _9;"
+	tokens, errs = lexAll(New(input))
+	if len(errs) != 0 {
+		t.Errorf("%q: unexpected errors: %v", input, errs)
+	}
+	testTokens(t, input, tokens, []expectedToken{
+		{token.LET, "let", "1:1-1:4"},
+		{token.IDENT, "c1", "1:5-1:7"},
+		{token.ASSIGN, "=", "1:8-1:9"},
+		{token.IDENT, "变量2", "1:10-1:13"},
+		{token.PLUS, "+", "1:14-1:15"},
+		{token.IDENT, "_9", "1:16-1:18"},
+		{token.SEMICOLON, ";", "1:18-1:19"},
+	})
+
+	input = "let a = 1;\nlet b = \"\xff\";"
+	_, errs = lexAll(New(input))
+	testSingleError(t, input, errs, ErrInvalidUTF8, "2:10-2:11")
+}
+
+func TestNumberLiterals(t *testing.T) {
+	tests := []struct {
+		input   string
+		typ     token.Type
+		literal string
+	}{
+		{`0xFF`, token.INT, "0xFF"},
+		{`0Xff_ff`, token.INT, "0Xff_ff"},
+		{`0o755`, token.INT, "0o755"},
+		{`0b1010`, token.INT, "0b1010"},
+		{`0x_10`, token.INT, "0x_10"},
+		{`1_000_000`, token.INT, "1_000_000"},
+		{`00`, token.INT, "00"},
+		{`1_000.25`, token.FLOAT, "1_000.25"},
+		{`.5`, token.FLOAT, ".5"},
+		{`1e5`, token.FLOAT, "1e5"},
+		{`2.5E-3`, token.FLOAT, "2.5E-3"},
+	}
+
+	for _, tt := range tests {
+		tokens, errs := lexAll(New(tt.input))
+		if len(errs) != 0 {
+			t.Errorf("%q: unexpected errors: %v", tt.input, errs)
+		}
+		span := fmt.Sprintf("1:1-1:%d", len(tt.input)+1)
+		testTokens(t, tt.input, tokens, []expectedToken{{tt.typ, tt.literal, span}})
+	}
+
+	// 格式错误的字面量整体作为一个词法单元 错误指向出错的部分
+	errors := []struct {
+		input string
+		span  string
+	}{
+		{`0x`, "1:1-1:3"},
+		{`12abc`, "1:3-1:6"},
+		{`0b102`, "1:5-1:6"},
+		{`0o8`, "1:3-1:4"},
+		{`1__0`, "1:2-1:3"},
+		{`1_`, "1:2-1:3"},
+		{`3_.5`, "1:2-1:3"},
+		{`0755`, "1:1-1:5"},
+		{`1e`, "1:2-1:3"},
+	}
+
+	for _, tt := range errors {
+		tokens, errs := lexAll(New(tt.input))
+		if len(tokens) != 1 || tokens[0].Literal != tt.input {
+			t.Errorf("%q: expected a single token. got=%v", tt.input, tokens)
+		}
+		testSingleError(t, tt.input, errs, ErrInvalidNumber, tt.span)
+	}
+}
+
+func TestOperators(t *testing.T) {
+	input := "% <= >= && || & | ^ ~ << >> += -= *= /= %= ?? ?. ?[ ... < >"
+	expected := []token.Type{
+		token.PERCENT, token.LT_EQ, token.GT_EQ, token.AND, token.OR,
+		token.BIT_AND, token.BIT_OR, token.BIT_XOR, token.BIT_NOT, token.SHL, token.SHR,
+		token.PLUS_ASSIGN, token.MINUS_ASSIGN, token.ASTERISK_ASSIGN, token.SLASH_ASSIGN, token.PERCENT_ASSIGN,
+		token.NULLISH, token.QUESTION_DOT, token.QUESTION_LBRACKET, token.ELLIPSIS, token.LT, token.GT,
+	}
+
+	tokens, errs := lexAll(New(input))
+	if len(errs) != 0 {
+		t.Errorf("unexpected errors: %v", errs)
+	}
+	if len(tokens) != len(expected) {
+		t.Fatalf("wrong number of tokens. got=%d, want=%d", len(tokens), len(expected))
+	}
+	for i, typ := range expected {
+		if tokens[i].Type != typ || tokens[i].Literal != string(typ) {
+			t.Errorf("token %d wrong. got=%s %q, want=%s", i, tokens[i].Type, tokens[i].Literal, typ)
+		}
+	}
+	// 多字符运算符的区间覆盖其全部字符
+	if got := spanString(tokens[1].Span); got != "1:3-1:5" {
+		t.Errorf("wrong span of <=. got=%s, want=1:3-1:5", got)
+	}
+}
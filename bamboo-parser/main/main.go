@@ -13,8 +13,10 @@ func main() {
 		f, err := os.Open(os.Args[1])
 		if err != nil {
 			fmt.Println("no such file")
+			return
 		}
-		command.Start(f, os.Stdout, false)
+		defer f.Close()
+		command.StartFile(os.Args[1], f, os.Stdout)
 	} else {
 
 	}
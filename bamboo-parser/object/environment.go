@@ -1,13 +1,23 @@
 package object
 
+import "errors"
+
 // Environment 将值与名称关联
 // 使用关联的名称跟踪值
 // 本质上 环境是一个将字符串与对象相关联的哈希映射
 type Environment struct {
-	store map[string]Object
-	outer *Environment
+	store     map[string]Object
+	constants map[string]bool // 由const声明的只读变量
+	outer     *Environment
 }
 
+// Declare和Assign 可能返回的错误
+var (
+	ErrUndefined  = errors.New("identifier not found")        // 变量未声明
+	ErrConstant   = errors.New("assignment to constant")      // 变量为只读
+	ErrRedeclared = errors.New("identifier already declared") // 变量已在当前环境中声明
+)
+
 // NewEnclosedEnvironment 扩展已有环境
 // 将函数的参数添加到一个新的环境中
 func NewEnclosedEnvironment(outer *Environment) *Environment {
@@ -18,8 +28,7 @@ func NewEnclosedEnvironment(outer *Environment) *Environment {
 
 // NewEnvironment 创建环境
 func NewEnvironment() *Environment {
-	s := make(map[string]Object)
-	return &Environment{store: s, outer: nil}
+	return &Environment{store: nil, outer: nil}
 }
 
 // Get 从环境中获取变量的值
@@ -31,8 +40,58 @@ func (e *Environment) Get(name string) (Object, bool) {
 	return obj, ok
 }
 
-// Set 将名称与值关联
+// Set 在当前环境中将名称与值关联 即声明变量
 func (e *Environment) Set(name string, val Object) Object {
+	// 大部分语句块不声明变量 在第一次声明时才分配存储
+	if e.store == nil {
+		e.store = make(map[string]Object)
+	}
 	e.store[name] = val
 	return val
 }
+
+// SetConst 在当前环境中声明只读变量
+func (e *Environment) SetConst(name string, val Object) Object {
+	if e.constants == nil {
+		e.constants = make(map[string]bool)
+	}
+	e.constants[name] = true
+	return e.Set(name, val)
+}
+
+// IsConst 判断当前环境(不含外层环境)中的变量是否为只读
+func (e *Environment) IsConst(name string) bool {
+	return e.constants[name]
+}
+
+// Declare 在当前环境中声明变量 constant为true时变量只读
+// 变量已在当前环境(不含外层环境)中声明时不做修改 只读变量返回ErrConstant 其他返回ErrRedeclared
+func (e *Environment) Declare(name string, val Object, constant bool) error {
+	if _, ok := e.store[name]; ok {
+		if e.constants[name] {
+			return ErrConstant
+		}
+		return ErrRedeclared
+	}
+	if constant {
+		e.SetConst(name, val)
+	} else {
+		e.Set(name, val)
+	}
+	return nil
+}
+
+// Assign 修改已声明的变量 沿外层环境查找 在变量所在的环境中修改
+// 变量未声明时返回ErrUndefined 变量为只读时返回ErrConstant
+func (e *Environment) Assign(name string, val Object) error {
+	for env := e; env != nil; env = env.outer {
+		if _, ok := env.store[name]; ok {
+			if env.constants[name] {
+				return ErrConstant
+			}
+			env.store[name] = val
+			return nil
+		}
+	}
+	return ErrUndefined
+}
@@ -0,0 +1,202 @@
+package object
+
+import (
+	"fmt"
+	"math/big"
+	"sort"
+	"unicode/utf8"
+)
+
+// 迭代协议 for-in循环通过Iterator依次取出集合中的元素
+// 实现了Iterable接口的对象都可以被for-in循环遍历
+
+// Iterator 迭代器
+type Iterator interface {
+	// Next 返回下一个元素的键和值 没有更多元素时ok为false
+	Next() (key, value Object, ok bool)
+}
+
+// Iterable 可迭代的对象
+type Iterable interface {
+	Iterator() Iterator
+}
+
+// 数组的迭代器 键为下标
+type arrayIterator struct {
+	array *Array
+	index int
+}
+
+func (it *arrayIterator) Next() (Object, Object, bool) {
+	if it.index >= len(it.array.Elements) {
+		return nil, nil, false
+	}
+	key := &Integer{Value: int64(it.index)}
+	value := it.array.Elements[it.index]
+	it.index++
+	return key, value, true
+}
+
+// Iterator 按下标顺序遍历数组元素
+func (a *Array) Iterator() Iterator {
+	return &arrayIterator{array: a}
+}
+
+// 哈希表的迭代器 遍历开始时的键值对快照
+type hashIterator struct {
+	pairs []HashPair
+	index int
+}
+
+func (it *hashIterator) Next() (Object, Object, bool) {
+	if it.index >= len(it.pairs) {
+		return nil, nil, false
+	}
+	pair := it.pairs[it.index]
+	it.index++
+	return pair.Key, pair.Value, true
+}
+
+// Iterator 按键的顺序遍历哈希表的键值对
+func (h *Hash) Iterator() Iterator {
+	return &hashIterator{pairs: h.SortedPairs()}
+}
+
+// 字符串的迭代器 按字符遍历 键为字符的序号
+type stringIterator struct {
+	value  string
+	offset int // 下一个字符的字节偏移
+	index  int // 下一个字符的序号
+}
+
+func (it *stringIterator) Next() (Object, Object, bool) {
+	if it.offset >= len(it.value) {
+		return nil, nil, false
+	}
+	_, size := utf8.DecodeRuneInString(it.value[it.offset:])
+	key := &Integer{Value: int64(it.index)}
+	value := &String{Value: it.value[it.offset : it.offset+size]}
+	it.offset += size
+	it.index++
+	return key, value, true
+}
+
+// Iterator 按字符遍历字符串
+func (s *String) Iterator() Iterator {
+	return &stringIterator{value: s.Value}
+}
+
+// Range 整数区间 由内置函数range创建 遍历时才依次产生元素
+type Range struct {
+	Start int64
+	Stop  int64 // 不包含
+	Step  int64 // 不为0
+}
+
+func (r *Range) Type() Type {
+	return RANGE_OBJ
+}
+
+func (r *Range) Inspect() string {
+	return fmt.Sprintf("range(%d, %d, %d)", r.Start, r.Stop, r.Step)
+}
+
+// 区间的迭代器 键为元素的序号
+type rangeIterator struct {
+	r       *Range
+	current int64
+	index   int64
+	done    bool
+}
+
+func (it *rangeIterator) Next() (Object, Object, bool) {
+	r := it.r
+	if it.done || (r.Step > 0 && it.current >= r.Stop) || (r.Step < 0 && it.current <= r.Stop) {
+		return nil, nil, false
+	}
+	key := &Integer{Value: it.index}
+	value := &Integer{Value: it.current}
+	// 下一个元素溢出时结束遍历
+	next := it.current + r.Step
+	if (next > it.current) != (r.Step > 0) {
+		it.done = true
+	}
+	it.current = next
+	it.index++
+	return key, value, true
+}
+
+// Iterator 依次产生区间中的整数
+func (r *Range) Iterator() Iterator {
+	return &rangeIterator{r: r, current: r.Start}
+}
+
+// SortedPairs 按键排序返回所有键值对 使遍历和输出的顺序确定
+// 不同类型的键依次为布尔值 数字 字符串 数字按数值排序
+func (h *Hash) SortedPairs() []HashPair {
+	pairs := make([]HashPair, 0, len(h.Pairs))
+	for _, pair := range h.Pairs {
+		pairs = append(pairs, pair)
+	}
+	sort.Slice(pairs, func(i, j int) bool {
+		return compareKeys(pairs[i].Key, pairs[j].Key) < 0
+	})
+	return pairs
+}
+
+// 键的类别 用于不同类型键之间的排序
+func keyRank(key Object) int {
+	switch key.(type) {
+	case *Boolean:
+		return 0
+	case *Integer, *BigInt, *Float:
+		return 1
+	case *String:
+		return 2
+	}
+	return 3
+}
+
+// 比较两个键的大小
+func compareKeys(a, b Object) int {
+	if ra, rb := keyRank(a), keyRank(b); ra != rb {
+		return ra - rb
+	}
+	switch a := a.(type) {
+	case *Boolean:
+		if a.Value == b.(*Boolean).Value {
+			return 0
+		} else if a.Value {
+			return 1
+		}
+		return -1
+	case *String:
+		bs := b.(*String).Value
+		if a.Value < bs {
+			return -1
+		} else if a.Value > bs {
+			return 1
+		}
+		return 0
+	case *Integer, *BigInt, *Float:
+		return exactNumber(a).Cmp(exactNumber(b))
+	}
+	return 0
+}
+
+// 将数字转换为精确的big.Float 用于比较不同类型的数字
+func exactNumber(obj Object) *big.Float {
+	switch obj := obj.(type) {
+	case *Integer:
+		return new(big.Float).SetInt64(obj.Value)
+	case *BigInt:
+		return new(big.Float).SetInt(obj.Value)
+	case *Float:
+		// NaN不能转换 按0处理
+		if obj.Value != obj.Value {
+			return new(big.Float)
+		}
+		return new(big.Float).SetFloat64(obj.Value)
+	}
+	return new(big.Float)
+}
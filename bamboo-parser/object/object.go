@@ -2,9 +2,14 @@ package object
 
 import (
 	"bamboo/ast"
+	"bamboo/diagnostic"
+	"bamboo/token"
 	"bytes"
 	"fmt"
 	"hash/fnv"
+	"math"
+	"math/big"
+	"strconv"
 	"strings"
 )
 
@@ -16,8 +21,13 @@ type Type string
 
 const (
 	INTEGER_OBJ      = "INTEGER"
+	FLOAT_OBJ        = "FLOAT"
+	BIGINT_OBJ       = "BIGINT"
 	BOOLEAN_OBJ      = "BOOLEAN"
 	RETURN_VALUE_OBJ = "RETURN_VALUE"
+	BREAK_OBJ        = "BREAK"
+	CONTINUE_OBJ     = "CONTINUE"
+	TAIL_CALL_OBJ    = "TAIL_CALL"
 	NULL_OBJ         = "NULL"
 	ERROR_OBJ        = "ERROR"
 	FUNCTION_OBJ     = "FUNCTION"
@@ -25,6 +35,8 @@ const (
 	BUILTIN_OBJ      = "BUILTIN"
 	ARRAY_OBJ        = "ARRAY"
 	HASH_OBJ         = "HASH"
+	EXCEPTION_OBJ    = "EXCEPTION"
+	RANGE_OBJ        = "RANGE"
 )
 
 // object的类型是接口
@@ -36,9 +48,22 @@ type Object interface {
 }
 
 // Error 错误对象
-// 一个Error包含一条错误信息
+// 一个Error包含一条错误信息及出错的位置
+// 错误从函数调用中传出时 依次记录经过的调用帧
 type Error struct {
+	Code    string // 错误代码
+	Kind    string // 错误类别 如TypeError
 	Message string
+	Span    token.Span // 产生错误的节点区间
+	Trace   []Frame    // 调用栈 最内层的调用在前
+	Value   Object     // throw抛出的值 运行时错误为nil
+}
+
+// Frame 调用栈中的一帧
+type Frame struct {
+	Function string     // 被调用的函数名 匿名函数为<anonymous>
+	Span     token.Span // 调用处的区间
+	Caller   string     // 调用处所在的函数名 为空时即上一帧中被调用的函数
 }
 
 func (e *Error) Type() Type {
@@ -46,9 +71,31 @@ func (e *Error) Type() Type {
 }
 
 func (e *Error) Inspect() string {
+	if e.Span.IsValid() {
+		return "ERROR: " + e.Span.String() + ": " + e.Message
+	}
 	return "ERROR: " + e.Message
 }
 
+// Diagnostic 将错误转换为诊断信息
+func (e *Error) Diagnostic() *diagnostic.Diagnostic {
+	return diagnostic.New(e.Code, e.Span, "%s", e.Message)
+}
+
+// Exception 被try表达式捕获的错误
+// Error会中断求值 而捕获后的错误是一个普通的值 可以保存、传递和再次抛出
+type Exception struct {
+	Err *Error
+}
+
+func (ex *Exception) Type() Type {
+	return EXCEPTION_OBJ
+}
+
+func (ex *Exception) Inspect() string {
+	return ex.Err.Kind + ": " + ex.Err.Message
+}
+
 // Integer 整数类型
 type Integer struct {
 	Value int64
@@ -62,6 +109,37 @@ func (i *Integer) Type() Type {
 	return INTEGER_OBJ
 }
 
+// BigInt 任意精度整数类型 仅在数值超出int64范围时使用
+type BigInt struct {
+	Value *big.Int
+}
+
+func (b *BigInt) Inspect() string {
+	return b.Value.String()
+}
+
+func (b *BigInt) Type() Type {
+	return BIGINT_OBJ
+}
+
+// Float 浮点数类型
+type Float struct {
+	Value float64
+}
+
+// Inspect 整数值的浮点数保留小数点 以便与整数区分 eg. 3.0
+func (f *Float) Inspect() string {
+	s := strconv.FormatFloat(f.Value, 'g', -1, 64)
+	if !strings.ContainsAny(s, ".eIN") {
+		s += ".0"
+	}
+	return s
+}
+
+func (f *Float) Type() Type {
+	return FLOAT_OBJ
+}
+
 // Boolean 布尔类型 封装单个bool值结构体
 type Boolean struct {
 	Value bool
@@ -99,8 +177,49 @@ func (rv *ReturnValue) Inspect() string {
 	return rv.Value.Inspect()
 }
 
+// Break break语句产生的信号 逐层传出语句块直到所在的循环
+type Break struct{}
+
+func (b *Break) Type() Type {
+	return BREAK_OBJ
+}
+
+func (b *Break) Inspect() string {
+	return "break"
+}
+
+// Continue continue语句产生的信号 逐层传出语句块直到所在的循环
+type Continue struct{}
+
+func (c *Continue) Type() Type {
+	return CONTINUE_OBJ
+}
+
+func (c *Continue) Inspect() string {
+	return "continue"
+}
+
+// TailCall 尾部位置的函数调用 传出函数体后由调用者所在的循环执行 不增加调用栈的深度
+type TailCall struct {
+	Function Object
+	Args     []Object
+	Name     string     // 被调用函数的名称
+	Span     token.Span // 调用表达式的位置
+}
+
+func (tc *TailCall) Type() Type {
+	return TAIL_CALL_OBJ
+}
+
+func (tc *TailCall) Inspect() string {
+	return "tail call " + tc.Name
+}
+
 type Function struct {
+	Name       string // 函数名 匿名函数为空
 	Parameters []*ast.Identifier
+	Defaults   []ast.Expression // 各参数的默认值 没有默认值时为nil
+	Variadic   bool             // 最后一个参数是否为剩余参数
 	Body       *ast.BlockStatement
 	Env        *Environment
 }
@@ -112,14 +231,12 @@ func (f *Function) Type() Type {
 func (f *Function) Inspect() string {
 	var out bytes.Buffer
 
-	var params []string
-	for _, p := range f.Parameters {
-		params = append(params, p.String())
-	}
-
 	out.WriteString("fn")
+	if f.Name != "" {
+		out.WriteString(" " + f.Name)
+	}
 	out.WriteString("(")
-	out.WriteString(strings.Join(params, ", "))
+	out.WriteString(ast.FormatParameters(f.Parameters, f.Defaults, f.Variadic))
 	out.WriteString(") {\n")
 	out.WriteString(f.Body.String())
 	out.WriteString("\n}")
@@ -184,7 +301,7 @@ func (h *Hash) Inspect() string {
 	var out bytes.Buffer
 
 	var pairs []string
-	for _, pair := range h.Pairs {
+	for _, pair := range h.SortedPairs() {
 		pairs = append(pairs, fmt.Sprintf("%s: %s",
 			pair.Key.Inspect(), pair.Value.Inspect()))
 	}
@@ -216,6 +333,37 @@ func (i *Integer) HashKey() HashKey {
 	return HashKey{Type: i.Type(), Value: uint64(i.Value)}
 }
 
+// HashKey 大整数与相同值的整数具有相同的键
+func (b *BigInt) HashKey() HashKey {
+	return bigHashKey(b.Value)
+}
+
+// HashKey 值为整数的浮点数与对应的整数具有相同的键 eg. h[1.0]与h[1]等价
+func (f *Float) HashKey() HashKey {
+	if f.Value == math.Trunc(f.Value) && !math.IsInf(f.Value, 0) {
+		if math.Abs(f.Value) < 1<<63 {
+			return HashKey{Type: INTEGER_OBJ, Value: uint64(int64(f.Value))}
+		}
+		i, _ := big.NewFloat(f.Value).Int(nil)
+		return bigHashKey(i)
+	}
+	return HashKey{Type: f.Type(), Value: math.Float64bits(f.Value)}
+}
+
+// 计算整数值的键 int64范围内的值与Integer一致
+// 超出范围的值取其字节的哈希 以BIGINT类型区分 不会与Integer的键相同
+func bigHashKey(i *big.Int) HashKey {
+	if i.IsInt64() {
+		return HashKey{Type: INTEGER_OBJ, Value: uint64(i.Int64())}
+	}
+	h := fnv.New64a()
+	if i.Sign() < 0 {
+		h.Write([]byte{'-'})
+	}
+	h.Write(i.Bytes())
+	return HashKey{Type: BIGINT_OBJ, Value: h.Sum64()} // 存在哈希碰撞可能性
+}
+
 func (s *String) HashKey() HashKey {
 	h := fnv.New64a()
 	h.Write([]byte(s.Value))
@@ -0,0 +1,50 @@
+package object
+
+import (
+	"hash/fnv"
+	"math"
+	"math/big"
+	"testing"
+)
+
+func TestHashKey(t *testing.T) {
+	big70 := new(big.Int).Lsh(big.NewInt(1), 70)
+	same := []struct {
+		name string
+		a, b Hashable
+	}{
+		{"integer", &Integer{Value: 42}, &Integer{Value: 42}},
+		{"string", &String{Value: "bamboo"}, &String{Value: "bamboo"}},
+		{"bigint", &BigInt{Value: big70}, &BigInt{Value: new(big.Int).Set(big70)}},
+		{"bigint in int64 range", &BigInt{Value: big.NewInt(-7)}, &Integer{Value: -7}},
+		{"integral float", &Float{Value: 1}, &Integer{Value: 1}},
+		{"large integral float", &Float{Value: math.Ldexp(1, 70)}, &BigInt{Value: big70}},
+	}
+	for _, tt := range same {
+		if tt.a.HashKey() != tt.b.HashKey() {
+			t.Errorf("%s: keys differ. got=%v and %v", tt.name, tt.a.HashKey(), tt.b.HashKey())
+		}
+	}
+
+	// 超出int64范围的大整数的键不会与某个Integer的键相同
+	h := fnv.New64a()
+	h.Write(big70.Bytes())
+	collision := &Integer{Value: int64(h.Sum64())}
+
+	different := []struct {
+		name string
+		a, b Hashable
+	}{
+		{"integer", &Integer{Value: 1}, &Integer{Value: 2}},
+		{"integer and string", &Integer{Value: 1}, &String{Value: "1"}},
+		{"integer and boolean", &Integer{Value: 1}, &Boolean{Value: true}},
+		{"fractional float", &Float{Value: 1.5}, &Integer{Value: 1}},
+		{"bigint sign", &BigInt{Value: big70}, &BigInt{Value: new(big.Int).Neg(big70)}},
+		{"bigint and integer", &BigInt{Value: big70}, collision},
+	}
+	for _, tt := range different {
+		if tt.a.HashKey() == tt.b.HashKey() {
+			t.Errorf("%s: keys should differ. got=%v", tt.name, tt.a.HashKey())
+		}
+	}
+}
@@ -21,7 +21,19 @@ func (p *Parser) expectPeek(t token.Type) bool {
 		p.nextToken()
 		return true
 	} else {
-		p.peekError(t)
+		p.fail(p.peekError(t))
+		return false
+	}
+}
+
+// 判断下一个token是否为与open配对的闭合符号 并作移动
+// 不匹配时在错误中指出open的位置
+func (p *Parser) expectClose(t token.Type, open token.Token) bool {
+	if p.peekTokenIs(t) {
+		p.nextToken()
+		return true
+	} else {
+		p.fail(p.peekError(t).WithRelated(open.Span, "unclosed %s opened here", open.Literal))
 		return false
 	}
 }
@@ -1,17 +1,60 @@
 package parser
 
 import (
+	"bamboo/diagnostic"
 	"bamboo/token"
-	"fmt"
 )
 
-func (p *Parser) peekError(t token.Type) {
-	msg := fmt.Sprintf("expected next token "+
-		"to be %s, got %s instead", t, p.peekToken.Type)
-	p.errors = append(p.errors, msg)
+// 语法错误代码
+const (
+	ErrUnexpectedToken  = "P0001" // 下一个词法单元不符合预期
+	ErrExpectedExpr     = "P0002" // 缺失表达式 即没有对应的前缀解析函数
+	ErrInvalidInteger   = "P0003" // 无法解析的整数字面量
+	ErrInvalidFloat     = "P0004" // 无法解析的浮点数字面量
+	ErrRedeclared       = "P0005" // 同一作用域中重复声明
+	ErrInvalidAssign    = "P0006" // 赋值运算符左侧不是变量或索引表达式
+	ErrConstAssign      = "P0007" // 对常量赋值
+	ErrOutsideLoop      = "P0008" // break或continue不在循环体中
+	ErrInvalidParameter = "P0009" // 参数列表不合法 如剩余参数之后还有参数
+)
+
+// 可以直接插入修正的闭合符号
+var closers = map[token.Type]bool{
+	token.RPAREN:   true,
+	token.RBRACKET: true,
+	token.RBRACE:   true,
+}
+
+// 出现语法错误时 解析函数通过panic(bailout{})放弃当前语句
+// 由parseStatementSafely捕获后跳至下一个语句边界继续解析
+type bailout struct{}
+
+// 记录一条语法错误 并放弃解析当前语句
+// 上一条错误位于该错误的区间中时不再记录 如词法分析器已报告的格式错误的字面量
+func (p *Parser) fail(d *diagnostic.Diagnostic) {
+	if n := len(p.errors); n == 0 || !contains(d.Span, p.errors[n-1].Span.Start) {
+		p.errors = append(p.errors, d)
+	}
+	panic(bailout{})
+}
+
+// 判断位置是否在区间中
+func contains(span token.Span, pos token.Position) bool {
+	return pos.Offset == span.Start.Offset ||
+		pos.Offset > span.Start.Offset && pos.Offset < span.End.Offset
+}
+
+func (p *Parser) peekError(t token.Type) *diagnostic.Diagnostic {
+	d := diagnostic.New(ErrUnexpectedToken, p.peekToken.Span,
+		"expected next token to be %s, got %s instead", t, p.peekToken.Type)
+	if closers[t] {
+		at := token.Span{Start: p.peekToken.Span.Start, End: p.peekToken.Span.Start}
+		d.WithFix(at, string(t), "insert the missing delimiter")
+	}
+	return d
 }
 
 func (p *Parser) noPrefixParseFnError(t token.Type) {
-	msg := fmt.Sprintf("no prefix parse function for %s found", t)
-	p.errors = append(p.errors, msg)
+	p.fail(diagnostic.New(ErrExpectedExpr, p.curToken.Span,
+		"no prefix parse function for %s found", t))
 }
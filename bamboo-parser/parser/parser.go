@@ -2,9 +2,10 @@ package parser
 
 import (
 	"bamboo/ast"
+	"bamboo/diagnostic"
 	"bamboo/lexer"
 	"bamboo/token"
-	"fmt"
+	"math/big"
 	"strconv"
 )
 
@@ -16,21 +17,35 @@ import (
 const (
 	_ int = iota
 	LOWEST
-	EQUALS
-	LESSGREATER
-	SUM
-	PRODUCT
+	ASSIGNMENT  // = += -= *= /= %=
+	COALESCE    // ??
+	LOGICALOR   // ||
+	LOGICALAND  // &&
+	BITOR       // |
+	BITXOR      // ^
+	BITAND      // &
+	EQUALS      // == !=
+	LESSGREATER // < > <= >=
+	SHIFT       // << >>
+	SUM         // + -
+	PRODUCT     // * / %
 	PREFIX
 	CALL
 	INDEX
 )
 
 type Parser struct {
-	lex    *lexer.Lexer // 词法分析器
-	errors []string
+	lex    *lexer.Lexer             // 词法分析器
+	errors []*diagnostic.Diagnostic // 语法错误
 
 	curToken  token.Token // 当前token 已经读到的token
 	peekToken token.Token // 下一token 也就是将要读取的token
+	depth     int         // 截至curToken尚未闭合的'{'个数 用于错误恢复
+	scope     *scope      // 当前作用域 用于检查重复声明
+	loops     int         // 当前函数中包围curToken的循环层数 用于检查break和continue
+
+	comments  []token.Token // 词法分析器保留注释时 按顺序记录跳过的注释
+	lexErrors int           // 已加入errors的词法错误个数
 
 	prefixParseFns map[token.Type]prefixParseFn // 前缀解析函数关联表
 	infixParseFns  map[token.Type]infixParseFn  // 后缀解析函数关联表
@@ -38,24 +53,44 @@ type Parser struct {
 
 // 优先级表 优先级依次升高
 var precedences = map[token.Type]int{
-	token.EQ:       EQUALS,
-	token.NOT_EQ:   EQUALS,
-	token.LT:       LESSGREATER,
-	token.GT:       LESSGREATER,
-	token.PLUS:     SUM,
-	token.MINUS:    SUM,
-	token.SLASH:    PRODUCT,
-	token.ASTERISK: PRODUCT,
-	token.LPAREN:   CALL,
-	token.LBRACKET: INDEX,
+	token.ASSIGN:            ASSIGNMENT,
+	token.PLUS_ASSIGN:       ASSIGNMENT,
+	token.MINUS_ASSIGN:      ASSIGNMENT,
+	token.ASTERISK_ASSIGN:   ASSIGNMENT,
+	token.SLASH_ASSIGN:      ASSIGNMENT,
+	token.PERCENT_ASSIGN:    ASSIGNMENT,
+	token.NULLISH:           COALESCE,
+	token.OR:                LOGICALOR,
+	token.AND:               LOGICALAND,
+	token.BIT_OR:            BITOR,
+	token.BIT_XOR:           BITXOR,
+	token.BIT_AND:           BITAND,
+	token.EQ:                EQUALS,
+	token.NOT_EQ:            EQUALS,
+	token.LT:                LESSGREATER,
+	token.GT:                LESSGREATER,
+	token.LT_EQ:             LESSGREATER,
+	token.GT_EQ:             LESSGREATER,
+	token.SHL:               SHIFT,
+	token.SHR:               SHIFT,
+	token.PLUS:              SUM,
+	token.MINUS:             SUM,
+	token.SLASH:             PRODUCT,
+	token.ASTERISK:          PRODUCT,
+	token.PERCENT:           PRODUCT,
+	token.LPAREN:            CALL,
+	token.LBRACKET:          INDEX,
+	token.QUESTION_DOT:      INDEX,
+	token.QUESTION_LBRACKET: INDEX,
 }
 
 // New 初始化一个语法分析器
 func New(lexer *lexer.Lexer) *Parser {
 	p := &Parser{
 		lex:    lexer,
-		errors: []string{},
+		errors: []*diagnostic.Diagnostic{},
 	}
+	p.openScope() // 顶层作用域
 
 	// 注册即构建解析函数与对应tokenType的映射
 	// 当遇到这一类token时 就去调用关联的解析函数
@@ -65,9 +100,11 @@ func New(lexer *lexer.Lexer) *Parser {
 	// 注册前缀表达式解析函数
 	p.registerPrefix(token.IDENT, p.parseIdentifier)
 	p.registerPrefix(token.INT, p.parseIntegerLiteral)
+	p.registerPrefix(token.FLOAT, p.parseFloatLiteral)
 
 	p.registerPrefix(token.BANG, p.parsePrefixExpression)
 	p.registerPrefix(token.MINUS, p.parsePrefixExpression)
+	p.registerPrefix(token.BIT_NOT, p.parsePrefixExpression)
 
 	p.infixParseFns = make(map[token.Type]infixParseFn)
 
@@ -81,9 +118,29 @@ func New(lexer *lexer.Lexer) *Parser {
 	p.registerInfix(token.NOT_EQ, p.parseInfixExpression)
 	p.registerInfix(token.LT, p.parseInfixExpression)
 	p.registerInfix(token.GT, p.parseInfixExpression)
+	p.registerInfix(token.PERCENT, p.parseInfixExpression)
+	p.registerInfix(token.LT_EQ, p.parseInfixExpression)
+	p.registerInfix(token.GT_EQ, p.parseInfixExpression)
+	p.registerInfix(token.AND, p.parseInfixExpression)
+	p.registerInfix(token.OR, p.parseInfixExpression)
+	p.registerInfix(token.NULLISH, p.parseInfixExpression)
+	p.registerInfix(token.BIT_AND, p.parseInfixExpression)
+	p.registerInfix(token.BIT_OR, p.parseInfixExpression)
+	p.registerInfix(token.BIT_XOR, p.parseInfixExpression)
+	p.registerInfix(token.SHL, p.parseInfixExpression)
+	p.registerInfix(token.SHR, p.parseInfixExpression)
+
+	// 注册赋值表达式的解析函数
+	p.registerInfix(token.ASSIGN, p.parseAssignExpression)
+	p.registerInfix(token.PLUS_ASSIGN, p.parseAssignExpression)
+	p.registerInfix(token.MINUS_ASSIGN, p.parseAssignExpression)
+	p.registerInfix(token.ASTERISK_ASSIGN, p.parseAssignExpression)
+	p.registerInfix(token.SLASH_ASSIGN, p.parseAssignExpression)
+	p.registerInfix(token.PERCENT_ASSIGN, p.parseAssignExpression)
 
 	// 注册布尔解析函数
 	p.registerPrefix(token.TRUE, p.parseBoolean)
+	p.registerPrefix(token.NULL, p.parseNullLiteral)
 	p.registerPrefix(token.FALSE, p.parseBoolean)
 
 	// 注册分组表达式解析函数
@@ -106,12 +163,18 @@ func New(lexer *lexer.Lexer) *Parser {
 
 	// 注册索引解析函数
 	p.registerInfix(token.LBRACKET, p.parseIndexExpression)
+	p.registerInfix(token.QUESTION_DOT, p.parseOptionalChain)
+	p.registerInfix(token.QUESTION_LBRACKET, p.parseOptionalChain)
 
 	// 注册哈希表解析函数
 	p.registerPrefix(token.LBRACE, p.parseHashLiteral)
 
 	// 注册循环语句解析函数
 	p.registerPrefix(token.WHILE, p.parseWhileExpression)
+	p.registerPrefix(token.FOR, p.parseForExpression)
+
+	// 注册异常处理解析函数
+	p.registerPrefix(token.TRY, p.parseTryExpression)
 
 	// 读取两个词法单元
 	// 初始化curToken和peekToken
@@ -121,14 +184,38 @@ func New(lexer *lexer.Lexer) *Parser {
 	return p
 }
 
-func (p *Parser) Errors() []string {
+// Errors 返回语法分析过程中产生的诊断
+func (p *Parser) Errors() []*diagnostic.Diagnostic {
 	return p.errors
 }
 
-// 更新token
+// Comments 返回源代码中的注释 仅在词法分析器保留注释时非空
+func (p *Parser) Comments() []token.Token {
+	return p.comments
+}
+
+// 更新token 跳过注释
+// 词法错误按出现的顺序加入语法错误中
 func (p *Parser) nextToken() {
 	p.curToken = p.peekToken
 	p.peekToken = p.lex.NextToken()
+	for p.peekToken.Type == token.COMMENT {
+		p.comments = append(p.comments, p.peekToken)
+		p.peekToken = p.lex.NextToken()
+	}
+	if errs := p.lex.Errors(); len(errs) > p.lexErrors {
+		p.errors = append(p.errors, errs[p.lexErrors:]...)
+		p.lexErrors = len(errs)
+	}
+
+	switch p.curToken.Type {
+	case token.LBRACE:
+		p.depth++
+	case token.RBRACE:
+		if p.depth > 0 {
+			p.depth--
+		}
+	}
 }
 
 /* 下面实现的是对源代码的语法分析
@@ -146,7 +233,7 @@ func (p *Parser) ParseProgram() *ast.Program {
 
 	// 遍历到EOF则终止
 	for p.curToken.Type != token.EOF {
-		stmt := p.parseStatement()
+		stmt := p.parseStatementSafely()
 		if stmt != nil {
 			program.Statements = append(program.Statements, stmt)
 		}
@@ -158,15 +245,99 @@ func (p *Parser) ParseProgram() *ast.Program {
 // 根据当前token的type 交由相关函数进行解析
 func (p *Parser) parseStatement() ast.Statement {
 	switch p.curToken.Type {
-	case token.LET:
+	case token.LET, token.CONST:
 		return p.parseLetStatement()
 	case token.RETURN:
 		return p.parseReturnStatement()
+	case token.THROW:
+		return p.parseThrowStatement()
+	case token.BREAK, token.CONTINUE:
+		return p.parseBranchStatement()
+	case token.FUNCTION:
+		// func后紧跟函数名时为函数声明 否则为函数字面量
+		if p.peekTokenIs(token.IDENT) {
+			return p.parseFunctionDeclaration()
+		}
+		return p.parseExpressionStatement()
 	default:
 		return p.parseExpressionStatement()
 	}
 }
 
+/* 错误恢复采用恐慌模式(panic mode)
+解析函数遇到语法错误时记录诊断并放弃当前语句
+随后跳过余下的词法单元 直到遇到语句边界: 同层的';' 闭合语句块的'}'
+或者下一个语句的起始关键字 然后从边界处继续解析
+这样一处错误只报告一次 同一文件中互不相关的错误也能一次全部报告
+*/
+
+// 可能作为语句开头的关键字
+var statementStarts = map[token.Type]bool{
+	token.LET:      true,
+	token.CONST:    true,
+	token.RETURN:   true,
+	token.IF:       true,
+	token.WHILE:    true,
+	token.FOR:      true,
+	token.BREAK:    true,
+	token.CONTINUE: true,
+	token.TRY:      true,
+	token.THROW:    true,
+}
+
+// 可以紧跟在'}'之后延续同一语句的关键字
+var continuations = map[token.Type]bool{
+	token.ELSE:    true,
+	token.CATCH:   true,
+	token.FINALLY: true,
+}
+
+// 解析语句 出错时恢复到下一个语句边界并返回nil
+func (p *Parser) parseStatementSafely() (stmt ast.Statement) {
+	// 语句所在语句块的嵌套层数
+	depth := p.depth
+	if p.curTokenIs(token.LBRACE) {
+		depth--
+	}
+
+	defer func() {
+		if r := recover(); r != nil {
+			if _, ok := r.(bailout); !ok {
+				panic(r)
+			}
+			stmt = nil
+			p.synchronize(depth)
+		}
+	}()
+	return p.parseStatement()
+}
+
+// 跳过出错语句余下的词法单元
+// 结束时curToken为出错语句的最后一个词法单元 与正常解析一样由调用者前移
+func (p *Parser) synchronize(depth int) {
+	for !p.curTokenIs(token.EOF) && !p.peekTokenIs(token.EOF) {
+		// 当前的'}'已经闭合了语句所在的语句块
+		if p.depth < depth {
+			return
+		}
+		if p.depth == depth {
+			switch {
+			case p.curTokenIs(token.SEMICOLON):
+				return
+			case p.curTokenIs(token.RBRACE) && !continuations[p.peekToken.Type]:
+				// 紧跟在'}'后的分号同属出错的语句
+				if p.peekTokenIs(token.SEMICOLON) {
+					p.nextToken()
+				}
+				return
+			case p.peekTokenIs(token.RBRACE) || statementStarts[p.peekToken.Type]:
+				return
+			}
+		}
+		p.nextToken()
+	}
+}
+
 // 为各种类型的token定义对应的解析函数
 // 所有解析函数都将返回一个statement结构 作为AST上的节点
 
@@ -189,6 +360,13 @@ func (p *Parser) parseLetStatement() *ast.LetStatement {
 	p.nextToken()
 	stmt.Value = p.parseExpression(LOWEST)
 
+	// 绑定到变量的匿名函数以变量名作为函数名
+	if lit, ok := stmt.Value.(*ast.FunctionLiteral); ok && lit.Name == "" {
+		lit.Name = stmt.Name.Value
+	}
+	// 语句解析成功后才声明变量 解析失败的语句不会导致之后的声明重复
+	p.declare(stmt.Name, stmt.IsConst())
+
 	// 遍历到分号之后
 	for p.peekTokenIs(token.SEMICOLON) {
 		p.nextToken()
@@ -203,7 +381,7 @@ func (p *Parser) parseReturnStatement() *ast.ReturnStatement {
 	p.nextToken()
 	stmt.ReturnValue = p.parseExpression(LOWEST)
 
-	for !p.curTokenIs(token.SEMICOLON) {
+	if p.peekTokenIs(token.SEMICOLON) {
 		p.nextToken()
 	}
 	return stmt
@@ -215,79 +393,171 @@ func (p *Parser) parseIntegerLiteral() ast.Expression {
 
 	value, err := strconv.ParseInt(p.curToken.Literal, 0, 64)
 	if err != nil {
-		msg := fmt.Sprintf("could not parse %q as integer", p.curToken.Literal)
-		p.errors = append(p.errors, msg)
-		return nil
+		// 超出int64范围的字面量按大整数解析
+		n, ok := new(big.Int).SetString(p.curToken.Literal, 0)
+		if !ok {
+			p.fail(diagnostic.New(ErrInvalidInteger, p.curToken.Span,
+				"could not parse %q as integer", p.curToken.Literal))
+			return nil
+		}
+		i.Big = n
+		return i
 	}
 	i.Value = value
 
 	return i
 }
 
+// 解析浮点数
+func (p *Parser) parseFloatLiteral() ast.Expression {
+	f := &ast.FloatLiteral{Token: p.curToken}
+
+	value, err := strconv.ParseFloat(p.curToken.Literal, 64)
+	if err != nil {
+		p.fail(diagnostic.New(ErrInvalidFloat, p.curToken.Span,
+			"could not parse %q as float", p.curToken.Literal))
+		return nil
+	}
+	f.Value = value
+
+	return f
+}
+
 // 解析布尔值
 func (p *Parser) parseBoolean() ast.Expression {
 	return &ast.Boolean{Token: p.curToken, Value: p.curTokenIs(token.TRUE)}
 }
 
+// 解析空值
+func (p *Parser) parseNullLiteral() ast.Expression {
+	return &ast.NullLiteral{Token: p.curToken}
+}
+
 // 解析函数参数
-func (p *Parser) parseFunctionParameters() []*ast.Identifier {
-	var identifiers []*ast.Identifier
+func (p *Parser) parseFunctionParameters(lit *ast.FunctionLiteral) {
+	open := p.curToken
 
 	if p.peekTokenIs(token.RPAREN) {
 		p.nextToken()
-		return identifiers
+		return
 	}
 
-	p.nextToken()
+	p.parseFunctionParameter(lit)
+	for p.peekTokenIs(token.COMMA) {
+		p.nextToken()
+		p.parseFunctionParameter(lit)
+	}
 
+	p.expectClose(token.RPAREN, open)
+}
+
+// 解析一个参数 <标识符> | <标识符> = <默认值> | ...<标识符>
+func (p *Parser) parseFunctionParameter(lit *ast.FunctionLiteral) {
+	if lit.Variadic {
+		p.fail(diagnostic.New(ErrInvalidParameter, p.peekToken.Span,
+			"rest parameter must be the last parameter"))
+	}
+
+	variadic := p.peekTokenIs(token.ELLIPSIS)
+	if variadic {
+		p.nextToken()
+	}
+	if !p.expectPeek(token.IDENT) {
+		return
+	}
 	ident := &ast.Identifier{Token: p.curToken, Value: p.curToken.Literal}
-	identifiers = append(identifiers, ident)
 
-	for p.peekTokenIs(token.COMMA) {
+	var value ast.Expression
+	if !variadic && p.peekTokenIs(token.ASSIGN) {
 		p.nextToken()
 		p.nextToken()
-		ident := &ast.Identifier{Token: p.curToken, Value: p.curToken.Literal}
-		identifiers = append(identifiers, ident)
+		value = p.parseExpression(LOWEST)
+	} else if !variadic && len(lit.Defaults) > 0 && lit.Defaults[len(lit.Defaults)-1] != nil {
+		p.fail(diagnostic.New(ErrInvalidParameter, ident.Span(),
+			"parameter %s without default follows parameter with default", ident.Value))
 	}
 
-	if !p.expectPeek(token.RPAREN) {
-		return nil
-	}
-	return identifiers
+	lit.Parameters = append(lit.Parameters, ident)
+	lit.Defaults = append(lit.Defaults, value)
+	lit.Variadic = variadic
 }
 
 // 解析函数表达式
 func (p *Parser) parseFunctionLiteral() ast.Expression {
 	lit := &ast.FunctionLiteral{Token: p.curToken}
+	p.parseFunction(lit)
+	return lit
+}
 
+// 解析函数声明 函数名与let声明的变量一样属于所在的作用域
+func (p *Parser) parseFunctionDeclaration() *ast.FunctionDeclaration {
+	stmt := &ast.FunctionDeclaration{Token: p.curToken}
+
+	p.nextToken()
+	stmt.Name = &ast.Identifier{Token: p.curToken, Value: p.curToken.Literal}
+	p.declare(stmt.Name, false)
+
+	stmt.Function = &ast.FunctionLiteral{Token: stmt.Token, Name: stmt.Name.Value}
+	p.parseFunction(stmt.Function)
+
+	if p.peekTokenIs(token.SEMICOLON) {
+		p.nextToken()
+	}
+	return stmt
+}
+
+// 解析函数的参数列表和函数体 curToken为参数列表之前的词法单元
+func (p *Parser) parseFunction(lit *ast.FunctionLiteral) {
 	// 缺失左括号 返回错误
 	if !p.expectPeek(token.LPAREN) {
-		return nil
+		return
 	}
-	lit.Parameters = p.parseFunctionParameters() // 解析函数参数
+	// break和continue不能跨越函数作用于外层的循环
+	loops := p.loops
+	p.loops = 0
+	defer func() { p.loops = loops }()
+
+	p.parseFunctionParameters(lit) // 解析函数参数
 
 	if !p.expectPeek(token.LBRACE) {
-		return nil
+		return
 	}
-	lit.Body = p.parseBlockStatement() // 解析函数体
-
-	return lit
+	lit.Body = p.parseBlockStatement(lit.Parameters...) // 解析函数体 参数与函数体同属一个作用域
+	markTailCalls(lit.Body)
 }
 
-// 解析语句块
-func (p *Parser) parseBlockStatement() *ast.BlockStatement {
+// 解析语句块 语句块是一个新的作用域 params为在该作用域中预先声明的标识符
+func (p *Parser) parseBlockStatement(params ...*ast.Identifier) *ast.BlockStatement {
+	p.openScope()
+	defer p.closeScope()
+	for _, param := range params {
+		p.declare(param, false)
+	}
+
 	block := &ast.BlockStatement{Token: p.curToken}
 	block.Statements = []ast.Statement{}
+	depth := p.depth
 
 	p.nextToken()
 	// 循环 直到遇到右花括号或EOF
 	for !p.curTokenIs(token.RBRACE) && !p.curTokenIs(token.EOF) {
-		stmt := p.parseStatement()
+		stmt := p.parseStatementSafely()
 		if stmt != nil {
 			block.Statements = append(block.Statements, stmt)
 		}
+		// 出错的语句恢复时已经越过了语句块的'}'
+		if p.depth < depth {
+			break
+		}
 		p.nextToken()
 	}
+	// 到达文件末尾仍未闭合
+	if p.curTokenIs(token.EOF) {
+		p.fail(diagnostic.New(ErrUnexpectedToken, p.curToken.Span,
+			"expected next token to be }, got EOF instead").
+			WithRelated(block.Token.Span, "unclosed { opened here"))
+	}
+	block.Rbrace = p.curToken
 	return block
 }
 
@@ -372,16 +642,56 @@ func (p *Parser) parseInfixExpression(left ast.Expression) ast.Expression {
 	return expression
 }
 
+// 解析赋值表达式 赋值运算符为右结合 eg. a = b = 1 即 a = (b = 1)
+func (p *Parser) parseAssignExpression(left ast.Expression) ast.Expression {
+	// 对索引表达式赋值 可选访问的结果不能被赋值
+	if target, ok := left.(*ast.IndexExpression); ok && !target.Optional {
+		expression := &ast.IndexAssignExpression{
+			Token:    p.curToken,
+			Target:   target,
+			Operator: p.curToken.Literal,
+		}
+		p.nextToken()
+		expression.Value = p.parseExpression(LOWEST)
+		return expression
+	}
+
+	name, ok := left.(*ast.Identifier)
+	if !ok {
+		p.fail(diagnostic.New(ErrInvalidAssign, p.curToken.Span,
+			"cannot assign to %s", left.String()).
+			WithRelated(left.Span(), "assignment target must be a variable or an index expression"))
+		return nil
+	}
+	expression := &ast.AssignExpression{
+		Token:    p.curToken,
+		Name:     name,
+		Operator: p.curToken.Literal,
+	}
+	// 静态检查对常量的赋值 在声明之前定义的函数中的赋值只能在运行时检查
+	if decl, ok := p.resolve(name.Value); ok && decl.constant {
+		p.errors = append(p.errors, diagnostic.New(ErrConstAssign, name.Span(),
+			"cannot assign to constant %s", name.Value).
+			WithRelated(decl.span, "`%s` declared as constant here", name.Value))
+	}
+	p.nextToken()
+	expression.Value = p.parseExpression(LOWEST)
+
+	return expression
+}
+
 // 解析调用表达式
 func (p *Parser) parseCallExpression(function ast.Expression) ast.Expression {
 	exp := &ast.CallExpression{Token: p.curToken, Function: function}
-	exp.Arguments = p.parseExpressionList(token.RPAREN)
+	exp.Arguments = p.parseCallArguments()
+	exp.Rparen = p.curToken
 	return exp
 }
 
 // 解析调用参数
 func (p *Parser) parseCallArguments() []ast.Expression {
 	var args []ast.Expression
+	open := p.curToken
 
 	// 遇到右括号停止
 	if p.peekTokenIs(token.RPAREN) {
@@ -390,27 +700,39 @@ func (p *Parser) parseCallArguments() []ast.Expression {
 	}
 
 	p.nextToken()
-	args = append(args, p.parseExpression(LOWEST)) // 获取第一个参数
+	args = append(args, p.parseCallArgument()) // 获取第一个参数
 
 	// 如果有逗号 说明列表中含有多个参数
 	// 直至遇到最后一个逗号后 停止获取参数
 	for p.peekTokenIs(token.COMMA) {
 		p.nextToken()
 		p.nextToken()
-		args = append(args, p.parseExpression(LOWEST)) // 将参数添加进列表
+		args = append(args, p.parseCallArgument()) // 将参数添加进列表
 	}
 
-	if !p.expectPeek(token.RPAREN) {
+	if !p.expectClose(token.RPAREN, open) {
 		return nil
 	}
 	return args
 }
 
+// 解析一个实参 以...开头时展开可迭代对象
+func (p *Parser) parseCallArgument() ast.Expression {
+	if !p.curTokenIs(token.ELLIPSIS) {
+		return p.parseExpression(LOWEST)
+	}
+	spread := &ast.SpreadExpression{Token: p.curToken}
+	p.nextToken()
+	spread.Value = p.parseExpression(LOWEST)
+	return spread
+}
+
 // 解析分组表达式
 func (p *Parser) parseGroupedExpression() ast.Expression {
+	open := p.curToken
 	p.nextToken()
 	exp := p.parseExpression(LOWEST)
-	if !p.expectPeek(token.RPAREN) {
+	if !p.expectClose(token.RPAREN, open) {
 		return nil
 	}
 
@@ -425,11 +747,12 @@ func (p *Parser) parseIfExpression() ast.Expression {
 	if !p.expectPeek(token.LPAREN) {
 		return nil
 	}
+	open := p.curToken
 	p.nextToken()
 	expression.Condition = p.parseExpression(LOWEST) // 解析条件表达式
 
 	// 右括号缺失 返回错误
-	if !p.expectPeek(token.RPAREN) {
+	if !p.expectClose(token.RPAREN, open) {
 		return nil
 	}
 
@@ -464,12 +787,14 @@ func (p *Parser) parseStringLiteral() ast.Expression {
 func (p *Parser) parseArrayLiteral() ast.Expression {
 	array := &ast.ArrayLiteral{Token: p.curToken}
 	array.Elements = p.parseExpressionList(token.RBRACKET)
+	array.Rbracket = p.curToken
 	return array
 }
 
 // 解析参数列表
 func (p *Parser) parseExpressionList(end token.Type) []ast.Expression {
 	var list []ast.Expression
+	open := p.curToken
 
 	if p.peekTokenIs(end) {
 		p.nextToken()
@@ -485,7 +810,7 @@ func (p *Parser) parseExpressionList(end token.Type) []ast.Expression {
 		list = append(list, p.parseExpression(LOWEST))
 	}
 
-	if !p.expectPeek(end) {
+	if !p.expectClose(end, open) {
 		return nil
 	}
 
@@ -494,14 +819,86 @@ func (p *Parser) parseExpressionList(end token.Type) []ast.Expression {
 
 // 解析索引表达式
 func (p *Parser) parseIndexExpression(left ast.Expression) ast.Expression {
-	exp := &ast.IndexExpression{Token: p.curToken, Left: left}
+	open := p.curToken
+	if p.peekTokenIs(token.COLON) {
+		return p.parseSliceExpression(open, left, nil)
+	}
 
 	p.nextToken()
-	exp.Index = p.parseExpression(LOWEST)
+	index := p.parseExpression(LOWEST)
+	if p.peekTokenIs(token.COLON) {
+		return p.parseSliceExpression(open, left, index)
+	}
+
+	exp := &ast.IndexExpression{Token: open, Left: left, Index: index}
+	if !p.expectClose(token.RBRACKET, exp.Token) {
+		return nil
+	}
+	exp.Rbracket = p.curToken
+	return exp
+}
+
+// 解析切片 start为已解析的起始位置 当前词法单元为':'之前的词法单元
+func (p *Parser) parseSliceExpression(open token.Token, left, start ast.Expression) ast.Expression {
+	exp := &ast.SliceExpression{Token: open, Left: left, Start: start}
+
+	p.nextToken() // ':'
+	if !p.peekTokenIs(token.COLON) && !p.peekTokenIs(token.RBRACKET) {
+		p.nextToken()
+		exp.Stop = p.parseExpression(LOWEST)
+	}
+	if p.peekTokenIs(token.COLON) {
+		p.nextToken()
+		if !p.peekTokenIs(token.RBRACKET) {
+			p.nextToken()
+			exp.Step = p.parseExpression(LOWEST)
+		}
+	}
 
-	if !p.expectPeek(token.RBRACKET) {
+	if !p.expectClose(token.RBRACKET, exp.Token) {
 		return nil
 	}
+	exp.Rbracket = p.curToken
+	return exp
+}
+
+// 解析可选链 从第一个可选访问开始 继续解析其后的索引和调用
+// 整个链包装为OptionalChain 可选访问短路时跳过的范围到链的末尾为止
+func (p *Parser) parseOptionalChain(left ast.Expression) ast.Expression {
+	exp := p.parseOptionalAccess(left)
+	for {
+		switch p.peekToken.Type {
+		case token.QUESTION_DOT, token.QUESTION_LBRACKET:
+			p.nextToken()
+			exp = p.parseOptionalAccess(exp)
+		case token.LBRACKET:
+			p.nextToken()
+			exp = p.parseIndexExpression(exp)
+		case token.LPAREN:
+			p.nextToken()
+			exp = p.parseCallExpression(exp)
+		default:
+			return &ast.OptionalChain{Expression: exp}
+		}
+	}
+}
+
+// 解析一次可选访问 a?[b] a?[b:c] a?.b
+func (p *Parser) parseOptionalAccess(left ast.Expression) ast.Expression {
+	if p.curTokenIs(token.QUESTION_LBRACKET) {
+		switch exp := p.parseIndexExpression(left).(type) {
+		case *ast.IndexExpression:
+			exp.Optional = true
+			return exp
+		case *ast.SliceExpression:
+			exp.Optional = true
+			return exp
+		}
+	}
+	exp := &ast.IndexExpression{Token: p.curToken, Left: left, Optional: true}
+	p.expectPeek(token.IDENT)
+	exp.Index = &ast.StringLiteral{Token: p.curToken, Value: p.curToken.Literal}
+	exp.Rbracket = p.curToken
 	return exp
 }
 
@@ -526,9 +923,10 @@ func (p *Parser) parseHashLiteral() ast.Expression {
 			return nil
 		}
 	}
-	if !p.expectPeek(token.RBRACE) {
+	if !p.expectClose(token.RBRACE, hash.Token) {
 		return nil
 	}
+	hash.Rbrace = p.curToken
 	return hash
 }
 
@@ -540,19 +938,161 @@ func (p *Parser) parseWhileExpression() ast.Expression {
 	if !p.expectPeek(token.LPAREN) {
 		return nil
 	}
+	open := p.curToken
 	p.nextToken()
 	expression.Condition = p.parseExpression(LOWEST) // 解析条件表达式
 
 	// 右括号缺失 返回错误
-	if !p.expectPeek(token.RPAREN) {
+	if !p.expectClose(token.RPAREN, open) {
+		return nil
+	}
+
+	// 左花括号缺失 返回错误
+	if !p.expectPeek(token.LBRACE) {
+		return nil
+	}
+	expression.Body = p.parseLoopBody() // 填充循环体
+
+	return expression
+}
+
+// 解析for表达式
+func (p *Parser) parseForExpression() ast.Expression {
+	expression := &ast.ForExpression{Token: p.curToken}
+
+	// 缺失左括号 返回错误
+	if !p.expectPeek(token.LPAREN) {
+		return nil
+	}
+	open := p.curToken
+
+	// 一个标识符绑定值 两个标识符分别绑定键和值
+	if !p.expectPeek(token.IDENT) {
+		return nil
+	}
+	expression.Value = &ast.Identifier{Token: p.curToken, Value: p.curToken.Literal}
+	if p.peekTokenIs(token.COMMA) {
+		p.nextToken()
+		if !p.expectPeek(token.IDENT) {
+			return nil
+		}
+		expression.Key = expression.Value
+		expression.Value = &ast.Identifier{Token: p.curToken, Value: p.curToken.Literal}
+	}
+
+	if !p.expectPeek(token.IN) {
+		return nil
+	}
+	p.nextToken()
+	expression.Iterable = p.parseExpression(LOWEST) // 解析被遍历的表达式
+
+	// 右括号缺失 返回错误
+	if !p.expectClose(token.RPAREN, open) {
+		return nil
+	}
+
+	// 左花括号缺失 返回错误
+	if !p.expectPeek(token.LBRACE) {
 		return nil
 	}
+	// 循环变量与循环体属于同一个作用域
+	if expression.Key != nil {
+		expression.Body = p.parseLoopBody(expression.Key, expression.Value)
+	} else {
+		expression.Body = p.parseLoopBody(expression.Value)
+	}
+
+	return expression
+}
+
+// 解析循环体 循环体中可以使用break和continue
+func (p *Parser) parseLoopBody(params ...*ast.Identifier) *ast.BlockStatement {
+	p.loops++
+	defer func() { p.loops-- }()
+	return p.parseBlockStatement(params...)
+}
+
+// 解析break和continue语句 二者只能出现在循环体中
+func (p *Parser) parseBranchStatement() ast.Statement {
+	var stmt ast.Statement
+	if p.curTokenIs(token.BREAK) {
+		stmt = &ast.BreakStatement{Token: p.curToken}
+	} else {
+		stmt = &ast.ContinueStatement{Token: p.curToken}
+	}
+
+	if p.loops == 0 {
+		p.errors = append(p.errors, diagnostic.New(ErrOutsideLoop, p.curToken.Span,
+			"`%s` outside loop", p.curToken.Literal))
+	}
+
+	if p.peekTokenIs(token.SEMICOLON) {
+		p.nextToken()
+	}
+	return stmt
+}
+
+// 解析throw语句
+func (p *Parser) parseThrowStatement() *ast.ThrowStatement {
+	stmt := &ast.ThrowStatement{Token: p.curToken}
+
+	p.nextToken()
+	stmt.Value = p.parseExpression(LOWEST)
+
+	if p.peekTokenIs(token.SEMICOLON) {
+		p.nextToken()
+	}
+	return stmt
+}
+
+// 解析try表达式
+func (p *Parser) parseTryExpression() ast.Expression {
+	expression := &ast.TryExpression{Token: p.curToken}
 
 	// 左花括号缺失 返回错误
 	if !p.expectPeek(token.LBRACE) {
 		return nil
 	}
-	expression.Body = p.parseBlockStatement() // 填充if语句块
+	expression.Block = p.parseBlockStatement()
+
+	if p.peekTokenIs(token.CATCH) {
+		p.nextToken()
 
+		// 绑定错误的标识符可以省略
+		if p.peekTokenIs(token.LPAREN) {
+			p.nextToken()
+			open := p.curToken
+			if !p.expectPeek(token.IDENT) {
+				return nil
+			}
+			expression.Param = &ast.Identifier{Token: p.curToken, Value: p.curToken.Literal}
+			if !p.expectClose(token.RPAREN, open) {
+				return nil
+			}
+		}
+		if !p.expectPeek(token.LBRACE) {
+			return nil
+		}
+		// 填充catch语句块 错误参数在catch语句块的作用域中
+		if expression.Param != nil {
+			expression.Catch = p.parseBlockStatement(expression.Param)
+		} else {
+			expression.Catch = p.parseBlockStatement()
+		}
+	}
+
+	if p.peekTokenIs(token.FINALLY) {
+		p.nextToken()
+		if !p.expectPeek(token.LBRACE) {
+			return nil
+		}
+		expression.Finally = p.parseBlockStatement() // 填充finally语句块
+	}
+
+	// catch和finally至少出现一个
+	if expression.Catch == nil && expression.Finally == nil {
+		p.fail(diagnostic.New(ErrUnexpectedToken, p.peekToken.Span,
+			"expected catch or finally after try block, got %s instead", p.peekToken.Type))
+	}
 	return expression
 }
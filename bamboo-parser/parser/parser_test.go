@@ -0,0 +1,319 @@
+package parser
+
+import (
+	"bamboo/ast"
+	"bamboo/lexer"
+	"fmt"
+	"testing"
+)
+
+func testParse(t *testing.T, input string) *ast.Program {
+	t.Helper()
+	p := New(lexer.New(input))
+	program := p.ParseProgram()
+	if errs := p.Errors(); len(errs) != 0 {
+		t.Fatalf("parser errors for %q: %v", input, errs[0].Message)
+	}
+	return program
+}
+
+// 返回只有一条表达式语句的程序中的表达式
+func singleExpression(t *testing.T, input string) ast.Expression {
+	t.Helper()
+	program := testParse(t, input)
+	if len(program.Statements) != 1 {
+		t.Fatalf("%q: expected 1 statement. got=%d", input, len(program.Statements))
+	}
+	stmt, ok := program.Statements[0].(*ast.ExpressionStatement)
+	if !ok {
+		t.Fatalf("%q: statement is not ExpressionStatement. got=%T", input, program.Statements[0])
+	}
+	return stmt.Expression
+}
+
+func TestNumberLiteralValues(t *testing.T) {
+	integers := []struct {
+		input    string
+		expected int64
+	}{
+		{`0xFF;`, 255},
+		{`0Xff_ff;`, 65535},
+		{`0o755;`, 493},
+		{`0b1010;`, 10},
+		{`0x_10;`, 16},
+		{`1_000_000;`, 1000000},
+		{`00;`, 0},
+	}
+
+	for _, tt := range integers {
+		lit, ok := singleExpression(t, tt.input).(*ast.IntegerLiteral)
+		if !ok {
+			t.Errorf("%q: expression is not IntegerLiteral", tt.input)
+			continue
+		}
+		if lit.Value != tt.expected || lit.Big != nil {
+			t.Errorf("%q: wrong value. got=%d, want=%d", tt.input, lit.Value, tt.expected)
+		}
+	}
+
+	lit, ok := singleExpression(t, `1_000.25;`).(*ast.FloatLiteral)
+	if !ok || lit.Value != 1000.25 {
+		t.Errorf("wrong float with separators. got=%v", lit)
+	}
+
+	// 超出int64范围的整数字面量
+	big, ok := singleExpression(t, `0x1_0000_0000_0000_0000;`).(*ast.IntegerLiteral)
+	if !ok || big.Big == nil || big.Big.String() != "18446744073709551616" {
+		t.Errorf("wrong big integer literal. got=%v", big)
+	}
+}
+
+// 语句出错后跳至下一条语句继续解析 每条错误的语句只报告一个错误
+func TestErrorRecovery(t *testing.T) {
+	tests := []struct {
+		input      string
+		codes      []string
+		statements int // 解析成功的语句数
+	}{
+		{"let a = ;\nlet b = 1;", []string{ErrExpectedExpr}, 1},
+		{"let = 1; let b = 2; let c 3; c;", []string{ErrUnexpectedToken, ErrUnexpectedToken}, 2},
+		{"let a = 1 +; let b = * 2; a + b;", []string{ErrExpectedExpr, ErrExpectedExpr}, 1},
+		{"func f() { let x = ; x } f();", []string{ErrExpectedExpr}, 2},
+		{"if (true) { 1 +; 2 } 3;", []string{ErrExpectedExpr}, 2},
+		{"let a = [1, 2; let b = 3;", []string{ErrUnexpectedToken}, 1},
+		{"let a = 0x; let b = 1;", []string{"L0005"}, 1},
+		{"let a = 1; let a = 2; let a = 3;", []string{ErrRedeclared, ErrRedeclared}, 3},
+		// 解析失败的let语句不声明变量 之后的声明不重复
+		{"let a = ;\nlet a = 1;", []string{ErrExpectedExpr}, 1},
+		{"const c = 1 +; c = 2;", []string{ErrExpectedExpr}, 1},
+		{"1 = 2; break; let a = 1;", []string{ErrInvalidAssign, ErrOutsideLoop}, 2},
+		// '}'后的分号属于出错的语句 不再单独报错
+		{"let x = 1; if (x { 1 }; x;", []string{ErrUnexpectedToken}, 2},
+		{"let f = func(a b) { a }; let g = 1;", []string{ErrUnexpectedToken}, 1},
+		{"let h = {1: }; let g = 1;", []string{ErrExpectedExpr}, 1},
+	}
+
+	for _, tt := range tests {
+		p := New(lexer.New(tt.input))
+		program := p.ParseProgram()
+		errs := p.Errors()
+		var codes []string
+		for _, err := range errs {
+			codes = append(codes, err.Code)
+		}
+		if fmt.Sprint(codes) != fmt.Sprint(tt.codes) {
+			t.Errorf("%q: wrong errors. got=%v, want=%v", tt.input, codes, tt.codes)
+			for _, err := range errs {
+				t.Logf("  %s %s: %s", err.Code, err.Span, err.Message)
+			}
+		}
+		if len(program.Statements) != tt.statements {
+			t.Errorf("%q: wrong number of statements. got=%d, want=%d", tt.input, len(program.Statements), tt.statements)
+		}
+	}
+}
+
+// 节点的区间 以"起始位置-结束行:列"表示
+func spanString(node ast.Node) string {
+	span := node.Span()
+	return fmt.Sprintf("%s-%d:%d", span.Start, span.End.Line, span.End.Column)
+}
+
+func TestNodeSpans(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{`a + b * 2;`, "t.bam:1:1-1:10"},
+		{`f(1, [2, 3]);`, "t.bam:1:1-1:13"},
+		{`-x;`, "t.bam:1:1-1:3"},
+		{`func(a) { a };`, "t.bam:1:1-1:14"},
+		{`x?.y["k"];`, "t.bam:1:1-1:10"},
+		{`if (x) { 1 } else { 2 };`, "t.bam:1:1-1:24"},
+		{`{"a": 1};`, "t.bam:1:1-1:9"},
+		{`x += 1;`, "t.bam:1:1-1:7"},
+		{`a[1:2];`, "t.bam:1:1-1:7"},
+	}
+
+	for _, tt := range tests {
+		p := New(lexer.NewFile("t.bam", tt.input))
+		program := p.ParseProgram()
+		if len(p.Errors()) != 0 || len(program.Statements) != 1 {
+			t.Fatalf("%q: unexpected parse result: %v", tt.input, p.Errors())
+		}
+		expr := program.Statements[0].(*ast.ExpressionStatement).Expression
+		if got := spanString(expr); got != tt.expected {
+			t.Errorf("%q: wrong span. got=%s, want=%s", tt.input, got, tt.expected)
+		}
+	}
+
+	// 跨行的语句
+	p := New(lexer.NewFile("t.bam", "let a = 1;\n  let total = a +\n    2;\nreturn total;"))
+	program := p.ParseProgram()
+	expected := []string{"t.bam:1:1-1:10", "t.bam:2:3-3:6", "t.bam:4:1-4:13"}
+	if len(program.Statements) != len(expected) {
+		t.Fatalf("wrong number of statements. got=%d", len(program.Statements))
+	}
+	for i, want := range expected {
+		if got := spanString(program.Statements[i]); got != want {
+			t.Errorf("statement %d (%s): wrong span. got=%s, want=%s", i, program.Statements[i], got, want)
+		}
+	}
+}
+
+// 语法错误以file:line:col的形式报告位置
+func TestErrorPositions(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"let x = (1 + 2;", "t.bam:1:15: error[P0001]: expected next token to be ), got ; instead"},
+		{"let x = 1;\nlet y = ;", "t.bam:2:9: error[P0002]: no prefix parse function for ; found"},
+		{"let 5 = 1;", "t.bam:1:5: error[P0001]: expected next token to be IDENT, got INT instead"},
+	}
+
+	for _, tt := range tests {
+		p := New(lexer.NewFile("t.bam", tt.input))
+		p.ParseProgram()
+		errs := p.Errors()
+		if len(errs) != 1 {
+			t.Errorf("%q: expected one error. got=%v", tt.input, errs)
+			continue
+		}
+		if got := errs[0].Error(); got != tt.expected {
+			t.Errorf("%q: wrong error. got=%q, want=%q", tt.input, got, tt.expected)
+		}
+	}
+}
+
+func TestTryExpression(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{`try { a } catch (e) { b } finally { c }`, "try acatch (e) bfinally c"},
+		{`try { a } finally { b }`, "try afinally b"},
+		{`throw a + 1;`, "throw (a + 1);"},
+	}
+	for _, tt := range tests {
+		if got := testParse(t, tt.input).String(); got != tt.expected {
+			t.Errorf("%q: wrong program string. got=%q, want=%q", tt.input, got, tt.expected)
+		}
+	}
+
+	errors := []struct {
+		input string
+		code  string
+	}{
+		{`try { a }`, ErrUnexpectedToken},
+		{`try { a } catch (1) { }`, ErrUnexpectedToken},
+		{`catch (e) { }`, ErrExpectedExpr},
+	}
+	for _, tt := range errors {
+		p := New(lexer.New(tt.input))
+		p.ParseProgram()
+		if errs := p.Errors(); len(errs) != 1 || errs[0].Code != tt.code {
+			t.Errorf("%q: expected one %s error. got=%v", tt.input, tt.code, errs)
+		}
+	}
+}
+
+func TestOperatorPrecedence(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{`a ?? b || c`, "(a ?? (b || c))"},
+		{`a || b && c`, "(a || (b && c))"},
+		{`a && b == c`, "(a && (b == c))"},
+		{`a | b ^ c & d`, "(a | (b ^ (c & d)))"},
+		{`a == b | c`, "((a == b) | c)"},
+		{`a & b == c`, "(a & (b == c))"},
+		{`a <= b >= c`, "((a <= b) >= c)"},
+		{`a < b << 1`, "(a < (b << 1))"},
+		{`a << 1 + 2`, "(a << (1 + 2))"},
+		{`a >> b >> c`, "((a >> b) >> c)"},
+		{`a % b * c`, "((a % b) * c)"},
+		{`~a + b`, "((~a) + b)"},
+		{`!a && b`, "((!a) && b)"},
+		{`-a << 2`, "((-a) << 2)"},
+	}
+
+	for _, tt := range tests {
+		if got := testParse(t, tt.input).String(); got != tt.expected {
+			t.Errorf("%q: wrong precedence. got=%q, want=%q", tt.input, got, tt.expected)
+		}
+	}
+}
+
+// let在同一作用域中重复声明时报错 内层作用域可以遮蔽外层的变量
+func TestDeclarations(t *testing.T) {
+	tests := []struct {
+		input string
+		codes []string
+	}{
+		{`let a = 1; if (true) { let a = 2; }`, nil},
+		{`let a = 1; let f = func(a) { a };`, nil},
+		{`let a = 1; a = 2; a += 3;`, nil},
+		{`let a = 1; let a = 2;`, []string{ErrRedeclared}},
+		{`let f = func(a) { let a = 2; };`, []string{ErrRedeclared}},
+		{`let f = func(a, a) { a };`, []string{ErrRedeclared}},
+		{`func f() { } let f = 1;`, []string{ErrRedeclared}},
+		{`for (i in [1]) { let i = 2; }`, []string{ErrRedeclared}},
+		{`1 = 2;`, []string{ErrInvalidAssign}},
+		{`f() += 1;`, []string{ErrInvalidAssign}},
+	}
+
+	for _, tt := range tests {
+		p := New(lexer.New(tt.input))
+		p.ParseProgram()
+		var codes []string
+		for _, err := range p.Errors() {
+			codes = append(codes, err.Code)
+		}
+		if fmt.Sprint(codes) != fmt.Sprint(tt.codes) {
+			t.Errorf("%q: wrong errors. got=%v, want=%v", tt.input, codes, tt.codes)
+		}
+	}
+
+	// 重复声明的错误指向第一次声明的位置
+	p := New(lexer.New("let a = 1;\nlet a = 2;"))
+	p.ParseProgram()
+	errs := p.Errors()
+	if len(errs) != 1 || len(errs[0].Related) != 1 || errs[0].Related[0].Span.Start.Line != 1 {
+		t.Errorf("redeclaration should point at the first declaration. got=%v", errs)
+	}
+}
+
+// 能够静态确定的对常量的赋值在语法分析时报错
+func TestConstAssignment(t *testing.T) {
+	tests := []struct {
+		input string
+		codes []string
+	}{
+		{`const c = 1; c = 2;`, []string{ErrConstAssign}},
+		{`const c = 1; c += 1;`, []string{ErrConstAssign}},
+		{`const c = 1; let f = func() { c = 2 };`, []string{ErrConstAssign}},
+		{`const c = 1; let c = 3;`, []string{ErrRedeclared}},
+		{`const c = 1; func c() { }`, []string{ErrRedeclared}},
+		{`const c = 1; if (true) { let c = 2; c = 3; }`, nil},
+		{`let f = func() { c = 2 }; const c = 1;`, nil},
+	}
+
+	for _, tt := range tests {
+		p := New(lexer.New(tt.input))
+		p.ParseProgram()
+		var codes []string
+		for _, err := range p.Errors() {
+			codes = append(codes, err.Code)
+		}
+		if fmt.Sprint(codes) != fmt.Sprint(tt.codes) {
+			t.Errorf("%q: wrong errors. got=%v, want=%v", tt.input, codes, tt.codes)
+		}
+	}
+
+	stmt := testParse(t, `const c = 1;`).Statements[0].(*ast.LetStatement)
+	if !stmt.IsConst() || stmt.String() != "const c = 1;" {
+		t.Errorf("wrong const statement. const=%t, string=%q", stmt.IsConst(), stmt.String())
+	}
+}
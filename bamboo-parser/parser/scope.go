@@ -0,0 +1,54 @@
+package parser
+
+import (
+	"bamboo/ast"
+	"bamboo/diagnostic"
+	"bamboo/token"
+)
+
+// 语法分析时记录每个作用域中声明的标识符 用于检查重复声明和对常量的赋值
+// 顶层代码为一个作用域 每个语句块为一个作用域
+// 函数参数与函数体 catch的参数与catch语句块属于同一个作用域
+
+type scope struct {
+	outer *scope
+	names map[string]declaration
+}
+
+// 标识符的声明
+type declaration struct {
+	span     token.Span // 声明的位置
+	constant bool       // 是否由const声明
+}
+
+// 进入新的作用域
+func (p *Parser) openScope() {
+	p.scope = &scope{outer: p.scope, names: make(map[string]declaration)}
+}
+
+// 离开当前作用域
+func (p *Parser) closeScope() {
+	p.scope = p.scope.outer
+}
+
+// 在当前作用域中声明标识符 同一作用域中重复声明时记录错误
+// 该错误不影响后续解析 因此不放弃当前语句
+func (p *Parser) declare(ident *ast.Identifier, constant bool) {
+	if prev, ok := p.scope.names[ident.Value]; ok {
+		p.errors = append(p.errors, diagnostic.New(ErrRedeclared, ident.Token.Span,
+			"`%s` is already declared in this scope", ident.Value).
+			WithRelated(prev.span, "`%s` first declared here", ident.Value))
+		return
+	}
+	p.scope.names[ident.Value] = declaration{span: ident.Token.Span, constant: constant}
+}
+
+// 由内向外查找标识符的声明
+func (p *Parser) resolve(name string) (declaration, bool) {
+	for s := p.scope; s != nil; s = s.outer {
+		if decl, ok := s.names[name]; ok {
+			return decl, true
+		}
+	}
+	return declaration{}, false
+}
@@ -0,0 +1,46 @@
+package parser
+
+import "bamboo/ast"
+
+// 尾调用
+// 调用的结果直接作为所在函数的返回值时 该调用处于尾部位置
+// 求值器和编译器在尾部位置调用函数时复用当前函数的调用帧 因此尾递归的深度不受宿主栈的限制
+// 尾部位置包括: return语句的值 函数体的最后一条表达式语句
+// 以及处于尾部位置的if表达式各分支的最后一条表达式语句
+// try表达式需要在返回前处理错误 其中的调用都不处于尾部位置
+
+// 标记函数体中处于尾部位置的调用
+func markTailCalls(body *ast.BlockStatement) {
+	markTailBlock(body, true)
+}
+
+// 遍历语句块 tail表示语句块的值是否为函数的返回值
+func markTailBlock(block *ast.BlockStatement, tail bool) {
+	if block == nil {
+		return
+	}
+	for i, stmt := range block.Statements {
+		switch stmt := stmt.(type) {
+		case *ast.ReturnStatement:
+			markTailExpression(stmt.ReturnValue, true)
+		case *ast.ExpressionStatement:
+			markTailExpression(stmt.Expression, tail && i == len(block.Statements)-1)
+		}
+	}
+}
+
+// 遍历表达式 tail表示表达式的值是否为函数的返回值
+// 不处于尾部位置的if和循环中仍可能有return语句
+func markTailExpression(expr ast.Expression, tail bool) {
+	switch expr := expr.(type) {
+	case *ast.CallExpression:
+		expr.Tail = tail
+	case *ast.IfExpression:
+		markTailBlock(expr.Consequence, tail)
+		markTailBlock(expr.Alternative, tail)
+	case *ast.WhileExpression:
+		markTailBlock(expr.Body, false)
+	case *ast.ForExpression:
+		markTailBlock(expr.Body, false)
+	}
+}
@@ -1,11 +1,58 @@
 package token
 
+import "fmt"
+
 type Type string
 
 // Token 词法单元结构
 type Token struct {
 	Type    Type
 	Literal string
+	Span    Span // 词法单元在源代码中的区间
+}
+
+// Position 源代码中的位置
+type Position struct {
+	Filename string // 文件名 可以为空
+	Offset   int    // 字节偏移量 从0开始
+	Line     int    // 行号 从1开始
+	Column   int    // 列号 从1开始 按字符计数
+}
+
+// IsValid 判断位置是否有效
+func (pos Position) IsValid() bool {
+	return pos.Line > 0
+}
+
+// String 以file:line:col的形式输出位置
+func (pos Position) String() string {
+	s := pos.Filename
+	if pos.IsValid() {
+		if s != "" {
+			s += ":"
+		}
+		s += fmt.Sprintf("%d:%d", pos.Line, pos.Column)
+	}
+	if s == "" {
+		s = "-"
+	}
+	return s
+}
+
+// Span 源代码中的一段区间 Start为起始位置 End为结束位置(不包含)
+type Span struct {
+	Start Position
+	End   Position
+}
+
+// IsValid 判断区间是否有效
+func (s Span) IsValid() bool {
+	return s.Start.IsValid()
+}
+
+// String 输出区间的起始位置
+func (s Span) String() string {
+	return s.Start.String()
 }
 
 const (
@@ -14,8 +61,11 @@ const (
 
 	IDENT  = "IDENT"
 	INT    = "INT"
+	FLOAT  = "FLOAT"
 	STRING = "STRING"
 
+	COMMENT = "COMMENT" // 仅在词法分析器保留注释时产生
+
 	LBRACKET = "["
 	RBRACKET = "]"
 
@@ -25,15 +75,39 @@ const (
 	BANG     = "!"
 	ASTERISK = "*"
 	SLASH    = "/"
+	PERCENT  = "%"
 	LT       = "<"
 	GT       = ">"
 
 	EQ     = "=="
 	NOT_EQ = "!="
+	LT_EQ  = "<="
+	GT_EQ  = ">="
+
+	AND     = "&&"
+	OR      = "||"
+	NULLISH = "??"
+
+	BIT_AND = "&"
+	BIT_OR  = "|"
+	BIT_XOR = "^"
+	BIT_NOT = "~"
+	SHL     = "<<"
+	SHR     = ">>"
+
+	PLUS_ASSIGN     = "+="
+	MINUS_ASSIGN    = "-="
+	ASTERISK_ASSIGN = "*="
+	SLASH_ASSIGN    = "/="
+	PERCENT_ASSIGN  = "%="
 
 	COMMA     = ","
 	SEMICOLON = ";"
 	COLON     = ":"
+	ELLIPSIS  = "..."
+
+	QUESTION_DOT      = "?."
+	QUESTION_LBRACKET = "?["
 
 	LPAREN = "("
 	RPAREN = ")"
@@ -42,23 +116,43 @@ const (
 
 	FUNCTION = "FUNCTION"
 	LET      = "LET"
+	CONST    = "CONST"
 	TRUE     = "TRUE"
 	FALSE    = "FALSE"
+	NULL     = "NULL"
 	IF       = "IF"
 	ELSE     = "ELSE"
 	WHILE    = "WHILE"
+	FOR      = "FOR"
+	IN       = "IN"
+	BREAK    = "BREAK"
+	CONTINUE = "CONTINUE"
 	RETURN   = "RETURN"
+	TRY      = "TRY"
+	CATCH    = "CATCH"
+	FINALLY  = "FINALLY"
+	THROW    = "THROW"
 )
 
 var keywords = map[string]Type{
-	"func":   FUNCTION,
-	"let":    LET,
-	"true":   TRUE,
-	"false":  FALSE,
-	"if":     IF,
-	"else":   ELSE,
-	"while":  WHILE,
-	"return": RETURN,
+	"func":     FUNCTION,
+	"let":      LET,
+	"const":    CONST,
+	"true":     TRUE,
+	"false":    FALSE,
+	"null":     NULL,
+	"if":       IF,
+	"else":     ELSE,
+	"while":    WHILE,
+	"for":      FOR,
+	"in":       IN,
+	"break":    BREAK,
+	"continue": CONTINUE,
+	"return":   RETURN,
+	"try":      TRY,
+	"catch":    CATCH,
+	"finally":  FINALLY,
+	"throw":    THROW,
 }
 
 // LookupIdent 检查关键字表判断给定标识符是否为关键字
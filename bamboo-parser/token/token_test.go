@@ -0,0 +1,32 @@
+package token
+
+import "testing"
+
+func TestPositionString(t *testing.T) {
+	tests := []struct {
+		pos      Position
+		expected string
+	}{
+		{Position{Filename: "test.bam", Offset: 10, Line: 2, Column: 5}, "test.bam:2:5"},
+		{Position{Line: 1, Column: 1}, "1:1"},
+		{Position{Filename: "test.bam"}, "test.bam"},
+		{Position{}, "-"},
+	}
+
+	for _, tt := range tests {
+		if got := tt.pos.String(); got != tt.expected {
+			t.Errorf("wrong position string for %+v. got=%q, want=%q", tt.pos, got, tt.expected)
+		}
+		if tt.pos.IsValid() != (tt.pos.Line > 0) {
+			t.Errorf("wrong validity for %+v", tt.pos)
+		}
+	}
+
+	span := Span{Start: Position{Line: 3, Column: 7}, End: Position{Line: 3, Column: 9}}
+	if !span.IsValid() || span.String() != "3:7" {
+		t.Errorf("wrong span. valid=%t, string=%q", span.IsValid(), span.String())
+	}
+	if (Span{}).IsValid() {
+		t.Errorf("zero span should be invalid")
+	}
+}